@@ -0,0 +1,344 @@
+// Package amqp091 runs SASL mechanisms over the AMQP 0-9-1 connection
+// negotiation methods Connection.Start, StartOk, Secure and SecureOk
+// (https://www.rabbitmq.com/resources/specs/amqp0-9-1.pdf).
+package amqp091
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// ProtocolHeader is sent by the client before the server sends
+// Connection.Start.
+const ProtocolHeader = "AMQP\x00\x00\x09\x01"
+
+// Reply codes sent in Connection.Close when authentication fails.
+const (
+	ReplyAccessRefused  uint16 = 403
+	ReplyCommandInvalid uint16 = 503
+)
+
+const (
+	frameMethod = 1
+	frameEnd    = 0xce
+
+	// maxFrameLen bounds the size of a frame read before Connection.Tune has
+	// negotiated the frame size.
+	maxFrameLen = 1 << 20
+
+	classConnection = 10
+
+	methodStart    = 10
+	methodStartOk  = 11
+	methodSecure   = 20
+	methodSecureOk = 21
+	methodTune     = 30
+	methodClose    = 50
+)
+
+// Table is an AMQP field table. Values may be of type string, bool, int8,
+// uint8, int16, uint16, int32, uint32, int64, float32, float64, time.Time,
+// []byte or Table.
+type Table map[string]interface{}
+
+// CloseError is returned when the peer closes the connection during
+// authentication.
+type CloseError struct {
+	Code uint16
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("amqp091: connection closed with reply code %d: %s", e.Code, e.Text)
+}
+
+// Tune holds the arguments of Connection.Tune, which the server sends once
+// authentication succeeds.
+type Tune struct {
+	ChannelMax uint16
+	FrameMax   uint32
+	Heartbeat  uint16
+}
+
+// StartOk holds the arguments of Connection.StartOk other than the initial
+// response.
+type StartOk struct {
+	ClientProperties Table
+	Mechanism        string
+	Locale           string
+}
+
+type method struct {
+	classID  uint16
+	methodID uint16
+	args     []byte
+}
+
+func readMethod(r io.Reader) (*method, error) {
+	var header [7]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[3:])
+	if size > maxFrameLen {
+		return nil, fmt.Errorf("amqp091: frame of %d bytes exceeds %d", size, maxFrameLen)
+	}
+
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if payload[size] != frameEnd {
+		return nil, fmt.Errorf("amqp091: invalid frame end")
+	}
+	if header[0] != frameMethod || size < 4 {
+		return nil, fmt.Errorf("amqp091: expected a method frame, but got frame type %d", header[0])
+	}
+
+	return &method{
+		classID:  binary.BigEndian.Uint16(payload),
+		methodID: binary.BigEndian.Uint16(payload[2:]),
+		args:     payload[4:size],
+	}, nil
+}
+
+func writeMethod(w io.Writer, methodID uint16, args []byte) error {
+	b := []byte{frameMethod, 0, 0}
+	b = binary.BigEndian.AppendUint32(b, uint32(4+len(args)))
+	b = binary.BigEndian.AppendUint16(b, classConnection)
+	b = binary.BigEndian.AppendUint16(b, methodID)
+	b = append(b, args...)
+	_, err := w.Write(append(b, frameEnd))
+	return err
+}
+
+func writeClose(w io.Writer, code uint16, text string) error {
+	var e encoder
+	e.short(code)
+	e.shortstr(text)
+	e.short(0)
+	e.short(0)
+	return writeMethod(w, methodClose, e.b)
+}
+
+func parseClose(args []byte) error {
+	d := decoder{b: args}
+	e := &CloseError{Code: d.short(), Text: d.shortstr()}
+	if d.err != nil {
+		return d.err
+	}
+	return e
+}
+
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) octet(v uint8) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) short(v uint16) {
+	e.b = binary.BigEndian.AppendUint16(e.b, v)
+}
+
+func (e *encoder) long(v uint32) {
+	e.b = binary.BigEndian.AppendUint32(e.b, v)
+}
+
+func (e *encoder) longlong(v uint64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, v)
+}
+
+func (e *encoder) shortstr(s string) {
+	e.octet(uint8(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) longstr(b []byte) {
+	e.long(uint32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+func (e *encoder) table(t Table) error {
+	var fields encoder
+	for name, value := range t {
+		fields.shortstr(name)
+		if err := fields.field(value); err != nil {
+			return err
+		}
+	}
+	e.longstr(fields.b)
+	return nil
+}
+
+func (e *encoder) field(value interface{}) error {
+	switch v := value.(type) {
+	case bool:
+		e.octet('t')
+		if v {
+			e.octet(1)
+		} else {
+			e.octet(0)
+		}
+	case int8:
+		e.octet('b')
+		e.octet(uint8(v))
+	case uint8:
+		e.octet('B')
+		e.octet(v)
+	case int16:
+		e.octet('s')
+		e.short(uint16(v))
+	case uint16:
+		e.octet('u')
+		e.short(v)
+	case int32:
+		e.octet('I')
+		e.long(uint32(v))
+	case uint32:
+		e.octet('i')
+		e.long(v)
+	case int64:
+		e.octet('l')
+		e.longlong(uint64(v))
+	case float32:
+		e.octet('f')
+		e.long(math.Float32bits(v))
+	case float64:
+		e.octet('d')
+		e.longlong(math.Float64bits(v))
+	case time.Time:
+		e.octet('T')
+		e.longlong(uint64(v.Unix()))
+	case string:
+		e.octet('S')
+		e.longstr([]byte(v))
+	case []byte:
+		e.octet('x')
+		e.longstr(v)
+	case Table:
+		e.octet('F')
+		return e.table(v)
+	case nil:
+		e.octet('V')
+	default:
+		return fmt.Errorf("amqp091: unsupported field value of type %T", value)
+	}
+	return nil
+}
+
+var errTruncated = errors.New("amqp091: truncated method")
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errTruncated
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) octet() uint8 {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) short() uint16 {
+	if b := d.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) long() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) longlong() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) shortstr() string {
+	return string(d.next(int(d.octet())))
+}
+
+func (d *decoder) longstr() []byte {
+	return append([]byte{}, d.next(int(d.long()))...)
+}
+
+func (d *decoder) table() Table {
+	fields := decoder{b: d.next(int(d.long()))}
+	t := Table{}
+	for d.err == nil && fields.err == nil && len(fields.b) > 0 {
+		name := fields.shortstr()
+		t[name] = fields.field()
+	}
+	if d.err == nil {
+		d.err = fields.err
+	}
+	return t
+}
+
+func (d *decoder) field() interface{} {
+	switch t := d.octet(); t {
+	case 't':
+		return d.octet() != 0
+	case 'b':
+		return int8(d.octet())
+	case 'B':
+		return d.octet()
+	case 's':
+		return int16(d.short())
+	case 'u':
+		return d.short()
+	case 'I':
+		return int32(d.long())
+	case 'i':
+		return d.long()
+	case 'l':
+		return int64(d.longlong())
+	case 'f':
+		return math.Float32frombits(d.long())
+	case 'd':
+		return math.Float64frombits(d.longlong())
+	case 'T':
+		return time.Unix(int64(d.longlong()), 0)
+	case 'S':
+		return string(d.longstr())
+	case 'x':
+		return d.longstr()
+	case 'F':
+		return d.table()
+	case 'V':
+		return nil
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("amqp091: unsupported field type %q", t)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package amqp091_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/amqp091"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+func TestAuthenticate(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{
+			Salt:       []byte("blah"),
+			Iterations: 100,
+			StoredKey:  storedKey,
+			ServerKey:  serverKey,
+		}, nil
+	}
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	serverProvider := func(mechName string) sasl.ServerMech {
+		switch mechName {
+		case plain.MechName:
+			return plain.NewServerMech(userPassVerifier, nil)
+		case scramsha1.MechName:
+			return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		mechanisms []string
+		password   string
+		clientErr  string
+		serverErr  string
+	}{
+		{"plain", []string{"AMQPLAIN", plain.MechName}, "mcjack", "", ""},
+		{"plain-wrong", []string{plain.MechName}, "wrong",
+			"amqp091: connection closed with reply code 403: ACCESS_REFUSED - Login was refused using authentication mechanism PLAIN",
+			"amqp091: sasl mechanism PLAIN: invalid username or password"},
+		{"scram", []string{scramsha1.MechName, plain.MechName}, "mcjack", "", ""},
+		{"scram-wrong", []string{scramsha1.MechName}, "wrong",
+			"amqp091: connection closed with reply code 403: ACCESS_REFUSED - Login was refused using authentication mechanism SCRAM-SHA-1",
+			"amqp091: sasl mechanism SCRAM-SHA-1: invalid response: client key mismatch"},
+		{"unsupported", []string{"AMQPLAIN"}, "mcjack",
+			"amqp091: none of the offered sasl mechanisms are supported: AMQPLAIN",
+			"EOF"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				defer serverConn.Close()
+				header := make([]byte, len(amqp091.ProtocolHeader))
+				if _, err := io.ReadFull(serverConn, header); err != nil {
+					serverErr <- err
+					return
+				}
+
+				mech, startOk, err := amqp091.Serve(context.Background(), serverConn, test.mechanisms, serverProvider, amqp091.Table{"product": "test"})
+				if err == nil {
+					if startOk.ClientProperties["product"] != "go-sasl" {
+						err = errors.New("client properties were not received")
+					} else if mech.Completed() {
+						// Connection.Tune: channel-max, frame-max, heartbeat.
+						_, err = serverConn.Write([]byte{1, 0, 0, 0, 0, 0, 12, 0, 10, 0, 30, 0, 0, 0, 2, 0, 0, 0, 60, 0xce})
+					}
+				}
+				serverErr <- err
+			}()
+
+			io.WriteString(clientConn, amqp091.ProtocolHeader)
+			tune, clientErr := amqp091.Authenticate(context.Background(), clientConn, func(mechName string) sasl.ClientMech {
+				switch mechName {
+				case plain.MechName:
+					return plain.NewClientMech("", "jack", test.password)
+				case scramsha1.MechName:
+					return scramsha1.NewClientMech("", "jack", test.password, 16, mr)
+				}
+				return nil
+			}, amqp091.Table{"product": "go-sasl", "capabilities": amqp091.Table{"authentication_failure_close": true}}, "en_US")
+			clientConn.Close()
+
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, <-serverErr)
+
+			if clientErr == nil && tune.Heartbeat != 60 {
+				t.Fatalf("expected a heartbeat of 60, but got %d", tune.Heartbeat)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package amqp091
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ClientMechProvider returns a new client mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ClientMechProvider func(mechName string) sasl.ClientMech
+
+// Authenticate conducts the connection negotiation as a client up to
+// Connection.Tune, which is returned. The caller has already sent
+// ProtocolHeader. The first mechanism offered by the server in
+// Connection.Start that provider supports is used.
+func Authenticate(ctx context.Context, rw io.ReadWriter, provider ClientMechProvider, clientProperties Table, locale string) (*Tune, error) {
+	m, err := readMethod(rw)
+	if err != nil {
+		return nil, err
+	}
+	if m.classID != classConnection || m.methodID != methodStart {
+		return nil, fmt.Errorf("amqp091: expected Connection.Start, but got method %d.%d", m.classID, m.methodID)
+	}
+
+	d := decoder{b: m.args}
+	d.octet()
+	d.octet()
+	d.table()
+	offered := strings.Fields(string(d.longstr()))
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	var mech sasl.ClientMech
+	for _, name := range offered {
+		if mech = provider(name); mech != nil {
+			break
+		}
+	}
+	if mech == nil {
+		return nil, fmt.Errorf("amqp091: none of the offered sasl mechanisms are supported: %s", strings.Join(offered, ", "))
+	}
+
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("amqp091: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	var e encoder
+	if err = e.table(clientProperties); err != nil {
+		return nil, err
+	}
+	e.shortstr(mechName)
+	e.longstr(response)
+	e.shortstr(locale)
+	if err = writeMethod(rw, methodStartOk, e.b); err != nil {
+		return nil, err
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if m, err = readMethod(rw); err != nil {
+			return nil, err
+		}
+		if m.classID != classConnection {
+			return nil, fmt.Errorf("amqp091: unexpected method %d.%d", m.classID, m.methodID)
+		}
+
+		d := decoder{b: m.args}
+		switch m.methodID {
+		case methodSecure:
+			challenge := d.longstr()
+			if d.err != nil {
+				return nil, d.err
+			}
+
+			if response, err = mech.Next(ctx, challenge); err != nil {
+				return nil, fmt.Errorf("amqp091: sasl mechanism %s: client failed to provide response: %v", mechName, err)
+			}
+
+			var e encoder
+			e.longstr(response)
+			if err = writeMethod(rw, methodSecureOk, e.b); err != nil {
+				return nil, err
+			}
+		case methodTune:
+			tune := &Tune{ChannelMax: d.short(), FrameMax: d.long(), Heartbeat: d.short()}
+			if d.err != nil {
+				return nil, d.err
+			}
+			if !mech.Completed() {
+				return nil, fmt.Errorf("amqp091: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return tune, nil
+		case methodClose:
+			return nil, parseClose(m.args)
+		default:
+			return nil, fmt.Errorf("amqp091: unexpected method %d.%d", m.classID, m.methodID)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package amqp091
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ServerMechProvider returns a new server mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ServerMechProvider func(mechName string) sasl.ServerMech
+
+// Serve conducts the connection negotiation as a server, sending
+// Connection.Start with the mechanisms in order of preference. The caller has
+// already read ProtocolHeader. On success the completed mechanism and the
+// client's StartOk arguments are returned and the caller continues by sending
+// Connection.Tune; on failure Connection.Close is sent.
+func Serve(ctx context.Context, rw io.ReadWriter, mechanisms []string, provider ServerMechProvider, serverProperties Table) (sasl.ServerMech, *StartOk, error) {
+	var e encoder
+	e.octet(0)
+	e.octet(9)
+	if err := e.table(serverProperties); err != nil {
+		return nil, nil, err
+	}
+	e.longstr([]byte(strings.Join(mechanisms, " ")))
+	e.longstr([]byte("en_US"))
+	if err := writeMethod(rw, methodStart, e.b); err != nil {
+		return nil, nil, err
+	}
+
+	m, err := readMethod(rw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m.classID != classConnection || m.methodID != methodStartOk {
+		return nil, nil, fmt.Errorf("amqp091: expected Connection.StartOk, but got method %d.%d", m.classID, m.methodID)
+	}
+
+	d := decoder{b: m.args}
+	startOk := &StartOk{ClientProperties: d.table(), Mechanism: d.shortstr()}
+	response := d.longstr()
+	startOk.Locale = d.shortstr()
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+
+	var mech sasl.ServerMech
+	for _, name := range mechanisms {
+		if name == startOk.Mechanism {
+			mech = provider(name)
+		}
+	}
+	if mech == nil {
+		writeClose(rw, ReplyCommandInvalid, "COMMAND_INVALID - unknown authentication mechanism "+startOk.Mechanism)
+		return nil, nil, fmt.Errorf("amqp091: sasl mechanism %s is not supported", startOk.Mechanism)
+	}
+
+	mechName, challenge, err := mech.Start(ctx, response)
+	for {
+		if err != nil {
+			writeClose(rw, ReplyAccessRefused, "ACCESS_REFUSED - Login was refused using authentication mechanism "+mechName)
+			return nil, nil, fmt.Errorf("amqp091: sasl mechanism %s: %v", mechName, err)
+		}
+
+		if mech.Completed() && len(challenge) == 0 {
+			return mech, startOk, nil
+		}
+
+		var e encoder
+		e.longstr(challenge)
+		if err = writeMethod(rw, methodSecure, e.b); err != nil {
+			return nil, nil, err
+		}
+
+		if m, err = readMethod(rw); err != nil {
+			return nil, nil, err
+		}
+		if m.classID != classConnection || m.methodID != methodSecureOk {
+			return nil, nil, fmt.Errorf("amqp091: expected Connection.SecureOk, but got method %d.%d", m.classID, m.methodID)
+		}
+
+		d := decoder{b: m.args}
+		response = d.longstr()
+		if d.err != nil {
+			return nil, nil, d.err
+		}
+
+		if mech.Completed() {
+			// the final challenge carried additional data, which the
+			// client acknowledges with an empty response.
+			return mech, startOk, nil
+		}
+
+		challenge, err = mech.Next(ctx, response)
+	}
+}
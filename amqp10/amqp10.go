@@ -0,0 +1,344 @@
+// Package amqp10 runs SASL mechanisms over the AMQP 1.0 SASL layer
+// (http://docs.oasis-open.org/amqp/core/v1.0/os/amqp-core-security-v1.0-os.html#section-sasl).
+package amqp10
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ProtocolHeader announces the SASL layer. It is exchanged by both peers
+// before the SASL frames.
+const ProtocolHeader = "AMQP\x03\x01\x00\x00"
+
+// OutcomeCode is the code of a sasl-outcome frame.
+type OutcomeCode uint8
+
+// Outcome codes.
+const (
+	OutcomeOK      OutcomeCode = 0
+	OutcomeAuth    OutcomeCode = 1
+	OutcomeSys     OutcomeCode = 2
+	OutcomeSysPerm OutcomeCode = 3
+	OutcomeSysTemp OutcomeCode = 4
+)
+
+// OutcomeError is returned when the exchange completes with an outcome other
+// than OutcomeOK.
+type OutcomeError struct {
+	Code OutcomeCode
+}
+
+func (e *OutcomeError) Error() string {
+	switch e.Code {
+	case OutcomeAuth:
+		return "amqp10: authentication failed"
+	case OutcomeSysPerm:
+		return "amqp10: authentication failed due to a permanent system error"
+	case OutcomeSysTemp:
+		return "amqp10: authentication failed due to a transient system error"
+	default:
+		return fmt.Sprintf("amqp10: authentication failed due to a system error (outcome %d)", e.Code)
+	}
+}
+
+// Temporary indicates if the failure is transient and authentication may be
+// retried later.
+func (e *OutcomeError) Temporary() bool {
+	return e.Code == OutcomeSysTemp
+}
+
+// Descriptor codes of the SASL performatives.
+const (
+	descriptorMechanisms = 0x40
+	descriptorInit       = 0x41
+	descriptorChallenge  = 0x42
+	descriptorResponse   = 0x43
+	descriptorOutcome    = 0x44
+)
+
+// AMQP type constructors.
+const (
+	typeDescribed  = 0x00
+	typeNull       = 0x40
+	typeTrue       = 0x41
+	typeFalse      = 0x42
+	typeUint0      = 0x43
+	typeUlong0     = 0x44
+	typeList0      = 0x45
+	typeSmallUint  = 0x52
+	typeSmallUlong = 0x53
+	typeUbyte      = 0x50
+	typeBool       = 0x56
+	typeUint       = 0x70
+	typeUlong      = 0x80
+	typeVbin8      = 0xa0
+	typeStr8       = 0xa1
+	typeSym8       = 0xa3
+	typeVbin32     = 0xb0
+	typeStr32      = 0xb1
+	typeSym32      = 0xb3
+	typeList8      = 0xc0
+	typeList32     = 0xd0
+	typeArray8     = 0xe0
+	typeArray32    = 0xf0
+)
+
+const (
+	frameTypeSASL = 0x01
+
+	// maxFrameLen bounds the size of a single frame read from the wire.
+	maxFrameLen = 1 << 20
+)
+
+// symbol distinguishes decoded symbols from strings.
+type symbol string
+
+// performative is a decoded SASL frame body.
+type performative struct {
+	descriptor uint64
+	fields     []interface{}
+}
+
+func (p *performative) field(i int) interface{} {
+	if i < len(p.fields) {
+		return p.fields[i]
+	}
+	return nil
+}
+
+func (p *performative) binary(i int) []byte {
+	b, _ := p.field(i).([]byte)
+	return b
+}
+
+func readHeader(r io.Reader) error {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	if string(header[:]) != ProtocolHeader {
+		return fmt.Errorf("amqp10: unexpected protocol header %q", header[:])
+	}
+	return nil
+}
+
+func readFrame(r io.Reader) (*performative, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	doff := int(header[4]) * 4
+	if size > maxFrameLen || doff < 8 || int(size) < doff {
+		return nil, fmt.Errorf("amqp10: invalid frame size %d", size)
+	}
+	if header[5] != frameTypeSASL {
+		return nil, fmt.Errorf("amqp10: expected a SASL frame, but got frame type %d", header[5])
+	}
+
+	frame := make([]byte, size-8)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+
+	d := decoder{b: frame[doff-8:]}
+	if d.octet() != typeDescribed {
+		return nil, fmt.Errorf("amqp10: expected a described performative")
+	}
+
+	p := &performative{}
+	switch v := d.value().(type) {
+	case uint64:
+		p.descriptor = v
+	default:
+		if d.err == nil {
+			return nil, fmt.Errorf("amqp10: unsupported performative descriptor %v", v)
+		}
+	}
+
+	fields, ok := d.value().([]interface{})
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !ok {
+		return nil, fmt.Errorf("amqp10: expected a list of performative fields")
+	}
+	p.fields = fields
+	return p, nil
+}
+
+// writeFrame writes a SASL frame holding the described list of fields. The
+// fields are already encoded.
+func writeFrame(w io.Writer, descriptor uint8, fields ...[]byte) error {
+	var list []byte
+	for _, f := range fields {
+		list = append(list, f...)
+	}
+
+	body := []byte{typeDescribed, typeSmallUlong, descriptor, typeList32}
+	body = binary.BigEndian.AppendUint32(body, uint32(4+len(list)))
+	body = binary.BigEndian.AppendUint32(body, uint32(len(fields)))
+	body = append(body, list...)
+
+	frame := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	frame = append(frame, 2, frameTypeSASL, 0, 0)
+	_, err := w.Write(append(frame, body...))
+	return err
+}
+
+func encodeNull() []byte {
+	return []byte{typeNull}
+}
+
+func encodeUbyte(v uint8) []byte {
+	return []byte{typeUbyte, v}
+}
+
+func encodeBinary(b []byte) []byte {
+	if b == nil {
+		return encodeNull()
+	}
+	return append(binary.BigEndian.AppendUint32([]byte{typeVbin32}, uint32(len(b))), b...)
+}
+
+func encodeString(s string) []byte {
+	if s == "" {
+		return encodeNull()
+	}
+	return append(binary.BigEndian.AppendUint32([]byte{typeStr32}, uint32(len(s))), s...)
+}
+
+func encodeSymbol(s string) []byte {
+	return append(binary.BigEndian.AppendUint32([]byte{typeSym32}, uint32(len(s))), s...)
+}
+
+func encodeSymbolArray(symbols []string) []byte {
+	var elems []byte
+	for _, s := range symbols {
+		elems = binary.BigEndian.AppendUint32(elems, uint32(len(s)))
+		elems = append(elems, s...)
+	}
+
+	b := binary.BigEndian.AppendUint32([]byte{typeArray32}, uint32(4+1+len(elems)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(symbols)))
+	return append(append(b, typeSym32), elems...)
+}
+
+var errTruncated = errors.New("amqp10: truncated frame")
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errTruncated
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) octet() uint8 {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) value() interface{} {
+	return d.valueOf(d.octet())
+}
+
+func (d *decoder) valueOf(constructor uint8) interface{} {
+	switch constructor {
+	case typeNull:
+		return nil
+	case typeTrue:
+		return true
+	case typeFalse:
+		return false
+	case typeBool:
+		return d.octet() != 0
+	case typeUbyte:
+		return d.octet()
+	case typeUint0:
+		return uint32(0)
+	case typeSmallUint:
+		return uint32(d.octet())
+	case typeUint:
+		return d.uint32()
+	case typeUlong0:
+		return uint64(0)
+	case typeSmallUlong:
+		return uint64(d.octet())
+	case typeUlong:
+		if b := d.next(8); b != nil {
+			return binary.BigEndian.Uint64(b)
+		}
+		return uint64(0)
+	case typeVbin8:
+		return append([]byte{}, d.next(int(d.octet()))...)
+	case typeVbin32:
+		return append([]byte{}, d.next(int(d.uint32()))...)
+	case typeStr8:
+		return string(d.next(int(d.octet())))
+	case typeStr32:
+		return string(d.next(int(d.uint32())))
+	case typeSym8:
+		return symbol(d.next(int(d.octet())))
+	case typeSym32:
+		return symbol(d.next(int(d.uint32())))
+	case typeList0:
+		return []interface{}{}
+	case typeList8, typeList32, typeArray8, typeArray32:
+		var size, count int
+		if constructor == typeList8 || constructor == typeArray8 {
+			size, count = int(d.octet()), int(d.octet())
+			size--
+		} else {
+			size, count = int(d.uint32()), int(d.uint32())
+			size -= 4
+		}
+
+		items := decoder{b: d.next(size)}
+		var elemConstructor uint8
+		if constructor == typeArray8 || constructor == typeArray32 {
+			elemConstructor = items.octet()
+		}
+
+		var values []interface{}
+		for i := 0; i < count && items.err == nil; i++ {
+			if elemConstructor != 0 {
+				values = append(values, items.valueOf(elemConstructor))
+			} else {
+				values = append(values, items.value())
+			}
+		}
+		if d.err == nil {
+			d.err = items.err
+		}
+		return values
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("amqp10: unsupported type constructor 0x%02x", constructor)
+		}
+		return nil
+	}
+}
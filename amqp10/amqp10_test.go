@@ -0,0 +1,136 @@
+package amqp10_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/amqp10"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "directory unavailable" }
+func (temporaryError) Temporary() bool { return true }
+
+func TestAuthenticate(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		switch {
+		case username == "busy":
+			return temporaryError{}
+		case username != "jack" || password != "mcjack":
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{
+			Salt:       []byte("blah"),
+			Iterations: 100,
+			StoredKey:  storedKey,
+			ServerKey:  serverKey,
+		}, nil
+	}
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	serverProvider := func(mechName string) sasl.ServerMech {
+		switch mechName {
+		case plain.MechName:
+			return plain.NewServerMech(userPassVerifier, nil)
+		case scramsha1.MechName:
+			return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		mechanisms []string
+		username   string
+		password   string
+		clientErr  string
+		serverErr  string
+	}{
+		{"plain", []string{"MSSBCBS", plain.MechName}, "jack", "mcjack", "", ""},
+		{"plain-wrong", []string{plain.MechName}, "jack", "wrong",
+			"amqp10: authentication failed",
+			"amqp10: sasl mechanism PLAIN: invalid username or password"},
+		{"plain-temporary", []string{plain.MechName}, "busy", "mcjack",
+			"amqp10: authentication failed due to a transient system error",
+			"amqp10: sasl mechanism PLAIN: directory unavailable"},
+		{"scram", []string{scramsha1.MechName, plain.MechName}, "jack", "mcjack", "", ""},
+		{"scram-wrong", []string{scramsha1.MechName}, "jack", "wrong",
+			"amqp10: authentication failed",
+			"amqp10: sasl mechanism SCRAM-SHA-1: invalid response: client key mismatch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				defer serverConn.Close()
+				_, err := amqp10.Serve(context.Background(), serverConn, test.mechanisms, serverProvider)
+				serverErr <- err
+			}()
+
+			clientErr := amqp10.Authenticate(context.Background(), clientConn, func(mechName string) sasl.ClientMech {
+				switch mechName {
+				case plain.MechName:
+					return plain.NewClientMech("", test.username, test.password)
+				case scramsha1.MechName:
+					return scramsha1.NewClientMech("", test.username, test.password, 16, mr)
+				}
+				return nil
+			}, "localhost")
+
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, <-serverErr)
+		})
+	}
+}
+
+func TestAuthenticateCompactEncoding(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go func() {
+		defer serverConn.Close()
+		header := make([]byte, 8)
+		io.ReadFull(serverConn, header)
+		io.WriteString(serverConn, amqp10.ProtocolHeader)
+
+		// sasl-mechanisms with a list8 holding an array8 of sym8.
+		serverConn.Write([]byte{
+			0, 0, 0, 0x18, 2, 1, 0, 0,
+			0x00, 0x53, 0x40, 0xc0, 0x0b, 0x01, 0xe0, 0x08, 0x01, 0xa3, 0x05, 'P', 'L', 'A', 'I', 'N',
+		})
+
+		// read the sasl-init frame.
+		size := make([]byte, 4)
+		io.ReadFull(serverConn, size)
+		io.ReadFull(serverConn, make([]byte, int(size[2])<<8|int(size[3])-4))
+
+		// sasl-outcome with a list8 holding the ok code.
+		serverConn.Write([]byte{0, 0, 0, 0x10, 2, 1, 0, 0, 0x00, 0x53, 0x44, 0xc0, 0x03, 0x01, 0x50, 0x00})
+	}()
+
+	err := amqp10.Authenticate(context.Background(), clientConn, func(mechName string) sasl.ClientMech {
+		return plain.NewClientMech("", "jack", "mcjack")
+	}, "")
+	testhelpers.VerifyError(t, "client", "", err)
+}
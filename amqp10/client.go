@@ -0,0 +1,106 @@
+package amqp10
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ClientMechProvider returns a new client mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ClientMechProvider func(mechName string) sasl.ClientMech
+
+// Authenticate exchanges ProtocolHeader with the server and conducts the SASL
+// layer as a client, using the first mechanism offered in sasl-mechanisms that
+// provider supports. The hostname, when not empty, is sent in sasl-init. Once
+// Authenticate returns the caller continues with the AMQP protocol header.
+func Authenticate(ctx context.Context, rw io.ReadWriter, provider ClientMechProvider, hostname string) error {
+	if _, err := io.WriteString(rw, ProtocolHeader); err != nil {
+		return err
+	}
+	if err := readHeader(rw); err != nil {
+		return err
+	}
+
+	p, err := readFrame(rw)
+	if err != nil {
+		return err
+	}
+	if p.descriptor != descriptorMechanisms {
+		return fmt.Errorf("amqp10: expected sasl-mechanisms, but got descriptor 0x%02x", p.descriptor)
+	}
+
+	var offered []string
+	switch v := p.field(0).(type) {
+	case symbol:
+		offered = append(offered, string(v))
+	case []interface{}:
+		for _, s := range v {
+			if s, ok := s.(symbol); ok {
+				offered = append(offered, string(s))
+			}
+		}
+	}
+
+	var mech sasl.ClientMech
+	for _, name := range offered {
+		if mech = provider(name); mech != nil {
+			break
+		}
+	}
+	if mech == nil {
+		return fmt.Errorf("amqp10: none of the offered sasl mechanisms are supported: %s", strings.Join(offered, ", "))
+	}
+
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("amqp10: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	if err = writeFrame(rw, descriptorInit, encodeSymbol(mechName), encodeBinary(response), encodeString(hostname)); err != nil {
+		return err
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if p, err = readFrame(rw); err != nil {
+			return err
+		}
+
+		switch p.descriptor {
+		case descriptorChallenge:
+			if response, err = mech.Next(ctx, p.binary(0)); err != nil {
+				return fmt.Errorf("amqp10: sasl mechanism %s: client failed to provide response: %v", mechName, err)
+			}
+			if response == nil {
+				response = []byte{}
+			}
+			if err = writeFrame(rw, descriptorResponse, encodeBinary(response)); err != nil {
+				return err
+			}
+		case descriptorOutcome:
+			code, _ := p.field(0).(uint8)
+			if OutcomeCode(code) != OutcomeOK {
+				return &OutcomeError{Code: OutcomeCode(code)}
+			}
+
+			if data := p.binary(1); len(data) > 0 || !mech.Completed() {
+				if _, err = mech.Next(ctx, data); err != nil {
+					return fmt.Errorf("amqp10: sasl mechanism %s: unable to verify server: %v", mechName, err)
+				}
+			}
+			if !mech.Completed() {
+				return fmt.Errorf("amqp10: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return nil
+		default:
+			return fmt.Errorf("amqp10: unexpected descriptor 0x%02x", p.descriptor)
+		}
+	}
+}
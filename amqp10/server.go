@@ -0,0 +1,91 @@
+package amqp10
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ServerMechProvider returns a new server mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ServerMechProvider func(mechName string) sasl.ServerMech
+
+// Serve exchanges ProtocolHeader with the client and conducts the SASL layer
+// as a server, offering the mechanisms in order of preference. The completed
+// mechanism is returned on success. Mechanism errors that report themselves
+// as temporary are sent as OutcomeSysTemp; all other failures as OutcomeAuth.
+func Serve(ctx context.Context, rw io.ReadWriter, mechanisms []string, provider ServerMechProvider) (sasl.ServerMech, error) {
+	if err := readHeader(rw); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(rw, ProtocolHeader); err != nil {
+		return nil, err
+	}
+
+	if err := writeFrame(rw, descriptorMechanisms, encodeSymbolArray(mechanisms)); err != nil {
+		return nil, err
+	}
+
+	p, err := readFrame(rw)
+	if err != nil {
+		return nil, err
+	}
+	if p.descriptor != descriptorInit {
+		return nil, fmt.Errorf("amqp10: expected sasl-init, but got descriptor 0x%02x", p.descriptor)
+	}
+
+	mechName, _ := p.field(0).(symbol)
+	var mech sasl.ServerMech
+	for _, name := range mechanisms {
+		if name == string(mechName) {
+			mech = provider(name)
+		}
+	}
+	if mech == nil {
+		writeFrame(rw, descriptorOutcome, encodeUbyte(uint8(OutcomeAuth)))
+		return nil, fmt.Errorf("amqp10: sasl mechanism %s is not supported", mechName)
+	}
+
+	_, challenge, err := mech.Start(ctx, p.binary(1))
+	for {
+		if err != nil {
+			code := OutcomeAuth
+			var temp interface{ Temporary() bool }
+			if errors.As(err, &temp) && temp.Temporary() {
+				code = OutcomeSysTemp
+			}
+			writeFrame(rw, descriptorOutcome, encodeUbyte(uint8(code)))
+			return nil, fmt.Errorf("amqp10: sasl mechanism %s: %v", mechName, err)
+		}
+
+		if mech.Completed() {
+			if len(challenge) == 0 {
+				challenge = nil
+			}
+			if err = writeFrame(rw, descriptorOutcome, encodeUbyte(uint8(OutcomeOK)), encodeBinary(challenge)); err != nil {
+				return nil, err
+			}
+			return mech, nil
+		}
+
+		if challenge == nil {
+			challenge = []byte{}
+		}
+		if err = writeFrame(rw, descriptorChallenge, encodeBinary(challenge)); err != nil {
+			return nil, err
+		}
+
+		if p, err = readFrame(rw); err != nil {
+			return nil, err
+		}
+		if p.descriptor != descriptorResponse {
+			writeFrame(rw, descriptorOutcome, encodeUbyte(uint8(OutcomeSysPerm)))
+			return nil, fmt.Errorf("amqp10: expected sasl-response, but got descriptor 0x%02x", p.descriptor)
+		}
+
+		challenge, err = mech.Next(ctx, p.binary(0))
+	}
+}
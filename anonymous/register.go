@@ -0,0 +1,33 @@
+package anonymous
+
+import "github.com/craiggwilson/go-sasl"
+
+// ServerConfig configures the ServerMechs created by
+// sasl.NewServerWithDefaults. Without it, any trace information is accepted.
+type ServerConfig struct {
+	Verifier AuthzVerifier
+}
+
+// MechName implements sasl.MechConfig.
+func (c *ServerConfig) MechName() string {
+	return MechName
+}
+
+func init() {
+	sasl.RegisterServerMech(MechName, sasl.MechStrengthAnonymous, sasl.MechAnonymous, func(opts *sasl.ServerOptions) sasl.ServerMechFactory {
+		var verifier AuthzVerifier
+		if config, _ := opts.Config(MechName).(*ServerConfig); config != nil {
+			verifier = config.Verifier
+		}
+		return func(*sasl.ConnState) sasl.ServerMech {
+			return NewServerMech(verifier)
+		}
+	})
+
+	sasl.RegisterClientMech(MechName, sasl.MechStrengthAnonymous, sasl.MechAnonymous, func(opts *sasl.ClientOptions) sasl.ClientMechFactory {
+		trace := opts.Trace
+		return func(*sasl.ConnState) sasl.ClientMech {
+			return NewClientMech(trace)
+		}
+	})
+}
@@ -3,6 +3,8 @@ package anonymous
 import (
 	"context"
 	"fmt"
+
+	"github.com/craiggwilson/go-sasl"
 )
 
 // AuthzVerifier verifies the client's authorization identity.
@@ -57,3 +59,12 @@ func (m *ServerMech) Next(ctx context.Context, response []byte) ([]byte, error)
 func (m *ServerMech) Completed() bool {
 	return m.done
 }
+
+// Result returns the result of the completed exchange. The trace information
+// sent by the client is available as the "trace" attribute.
+func (m *ServerMech) Result() *sasl.Result {
+	return &sasl.Result{
+		Mechanism:  MechName,
+		Attributes: map[string]string{"trace": m.Authz},
+	}
+}
@@ -0,0 +1,160 @@
+// Package cassandra runs SASL mechanisms over the Cassandra native protocol's
+// AUTHENTICATE, AUTH_RESPONSE, AUTH_CHALLENGE and AUTH_SUCCESS messages
+// (https://github.com/apache/cassandra/blob/trunk/doc/native_protocol_v4.spec).
+// Only the v3 and v4 frame format is supported; v5 connections switch to
+// segment framing before authentication starts.
+package cassandra
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Opcodes used during authentication.
+const (
+	OpError         byte = 0x00
+	OpStartup       byte = 0x01
+	OpReady         byte = 0x02
+	OpAuthenticate  byte = 0x03
+	OpAuthChallenge byte = 0x0E
+	OpAuthResponse  byte = 0x0F
+	OpAuthSuccess   byte = 0x10
+)
+
+// Error codes used during authentication.
+const (
+	ErrorCodeProtocol       int32 = 0x000A
+	ErrorCodeBadCredentials int32 = 0x0100
+)
+
+// PasswordAuthenticator is the authenticator class name announced by servers
+// using Cassandra's built-in password authentication, which speaks PLAIN.
+const PasswordAuthenticator = "org.apache.cassandra.auth.PasswordAuthenticator"
+
+// responseFlag is set in the version byte of frames sent by the server.
+const responseFlag = 0x80
+
+const headerLen = 9
+
+// maxBodyLen bounds the size of a single frame body read from the wire.
+const maxBodyLen = 1 << 20
+
+var errTruncated = errors.New("cassandra: truncated frame")
+
+// Frame is a single protocol frame.
+type Frame struct {
+	Version byte
+	Flags   byte
+	Stream  int16
+	Opcode  byte
+	Body    []byte
+}
+
+// ReadFrame reads a single frame from r.
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	f := &Frame{
+		Version: header[0],
+		Flags:   header[1],
+		Stream:  int16(binary.BigEndian.Uint16(header[2:])),
+		Opcode:  header[4],
+	}
+	if v := f.Version &^ responseFlag; v < 3 || v > 4 {
+		return nil, fmt.Errorf("cassandra: unsupported protocol version %d", v)
+	}
+
+	n := binary.BigEndian.Uint32(header[5:])
+	if n > maxBodyLen {
+		return nil, fmt.Errorf("cassandra: invalid frame length %d", n)
+	}
+
+	f.Body = make([]byte, n)
+	if _, err := io.ReadFull(r, f.Body); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// WriteFrame writes a single frame to w.
+func WriteFrame(w io.Writer, f *Frame) error {
+	b := make([]byte, headerLen, headerLen+len(f.Body))
+	b[0] = f.Version
+	b[1] = f.Flags
+	binary.BigEndian.PutUint16(b[2:], uint16(f.Stream))
+	b[4] = f.Opcode
+	binary.BigEndian.PutUint32(b[5:], uint32(len(f.Body)))
+	_, err := w.Write(append(b, f.Body...))
+	return err
+}
+
+// Error is an ERROR message.
+type Error struct {
+	Code    int32
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cassandra: error 0x%04x: %s", e.Code, e.Message)
+}
+
+func parseError(body []byte) error {
+	if len(body) < 4 {
+		return errTruncated
+	}
+	message, _, err := readString(body[4:])
+	if err != nil {
+		return err
+	}
+	return &Error{Code: int32(binary.BigEndian.Uint32(body)), Message: message}
+}
+
+func errorBody(e *Error) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(e.Code))
+	return appendString(b, e.Message)
+}
+
+// readBytes reads a [bytes] value, which is nil when the length is negative.
+func readBytes(b []byte) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errTruncated
+	}
+	n := int32(binary.BigEndian.Uint32(b))
+	if n < 0 {
+		return nil, nil
+	}
+	if int(n) > len(b)-4 {
+		return nil, errTruncated
+	}
+	return b[4 : 4+n], nil
+}
+
+func appendBytes(b, value []byte) []byte {
+	if value == nil {
+		return binary.BigEndian.AppendUint32(b, 0xffffffff)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(value)))
+	return append(b, value...)
+}
+
+// readString reads a [string] value.
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errTruncated
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if n > len(b)-2 {
+		return "", nil, errTruncated
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
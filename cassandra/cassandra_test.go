@@ -0,0 +1,95 @@
+package cassandra_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/cassandra"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+const scramAuthenticator = "com.example.auth.ScramAuthenticator"
+
+func TestAuthenticate(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{
+			Salt:       []byte("blah"),
+			Iterations: 100,
+			StoredKey:  storedKey,
+			ServerKey:  serverKey,
+		}, nil
+	}
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		name          string
+		authenticator string
+		serverMech    sasl.ServerMech
+		password      string
+		clientErr     string
+		serverErr     string
+	}{
+		{"plain", cassandra.PasswordAuthenticator, plain.NewServerMech(userPassVerifier, nil), "mcjack", "", ""},
+		{"plain-wrong", cassandra.PasswordAuthenticator, plain.NewServerMech(userPassVerifier, nil), "wrong",
+			"cassandra: error 0x0100: Provided username and/or password are incorrect",
+			"cassandra: sasl mechanism PLAIN: invalid username or password"},
+		{"scram", scramAuthenticator, scramsha1.NewServerMech(storedUserProvider, nil, 16, mr), "mcjack", "", ""},
+		{"scram-wrong", scramAuthenticator, scramsha1.NewServerMech(storedUserProvider, nil, 16, mr), "wrong",
+			"cassandra: error 0x0100: Provided username and/or password are incorrect",
+			"cassandra: sasl mechanism SCRAM-SHA-1: invalid response: client key mismatch"},
+		{"unsupported", "com.example.auth.KerberosAuthenticator", plain.NewServerMech(userPassVerifier, nil), "mcjack",
+			"cassandra: authenticator com.example.auth.KerberosAuthenticator is not supported",
+			"EOF"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				defer serverConn.Close()
+				startup, err := cassandra.ReadFrame(serverConn)
+				if err == nil {
+					err = cassandra.Serve(context.Background(), serverConn, startup, test.authenticator, test.serverMech)
+				}
+				serverErr <- err
+			}()
+
+			startup := &cassandra.Frame{Version: 4, Stream: 1, Opcode: cassandra.OpStartup, Body: []byte{0, 1, 0, 11, 'C', 'Q', 'L', '_', 'V', 'E', 'R', 'S', 'I', 'O', 'N', 0, 5, '3', '.', '0', '.', '0'}}
+			clientErr := cassandra.WriteFrame(clientConn, startup)
+			if clientErr == nil {
+				clientErr = cassandra.Authenticate(context.Background(), clientConn, nil, func(authenticator string) sasl.ClientMech {
+					switch authenticator {
+					case cassandra.PasswordAuthenticator:
+						return plain.NewClientMech("", "jack", test.password)
+					case scramAuthenticator:
+						return scramsha1.NewClientMech("", "jack", test.password, 16, mr)
+					}
+					return nil
+				})
+			}
+			clientConn.Close()
+
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, <-serverErr)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package cassandra
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ClientMechProvider returns a new client mechanism for the authenticator
+// class named by the server, or nil if the authenticator is not supported.
+type ClientMechProvider func(authenticator string) sasl.ClientMech
+
+// Authenticate conducts SASL authentication as a client after STARTUP has
+// been sent. If the caller has already read the AUTHENTICATE message it is
+// passed as req; otherwise req is nil and the message is read from rw.
+// Authenticate returns once the server sends AUTH_SUCCESS.
+func Authenticate(ctx context.Context, rw io.ReadWriter, req *Frame, provider ClientMechProvider) error {
+	var err error
+	if req == nil {
+		if req, err = ReadFrame(rw); err != nil {
+			return err
+		}
+	}
+
+	switch req.Opcode {
+	case OpAuthenticate:
+	case OpError:
+		return parseError(req.Body)
+	default:
+		return fmt.Errorf("cassandra: expected AUTHENTICATE, but got opcode 0x%02x", req.Opcode)
+	}
+
+	authenticator, _, err := readString(req.Body)
+	if err != nil {
+		return err
+	}
+
+	mech := provider(authenticator)
+	if mech == nil {
+		return fmt.Errorf("cassandra: authenticator %s is not supported", authenticator)
+	}
+
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("cassandra: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	version := req.Version &^ responseFlag
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if err = WriteFrame(rw, &Frame{Version: version, Stream: req.Stream, Opcode: OpAuthResponse, Body: appendBytes(nil, response)}); err != nil {
+			return err
+		}
+
+		resp, err := ReadFrame(rw)
+		if err != nil {
+			return err
+		}
+
+		switch resp.Opcode {
+		case OpAuthChallenge:
+			challenge, err := readBytes(resp.Body)
+			if err != nil {
+				return err
+			}
+			if response, err = mech.Next(ctx, challenge); err != nil {
+				return fmt.Errorf("cassandra: sasl mechanism %s: client failed to provide response: %v", mechName, err)
+			}
+		case OpAuthSuccess:
+			data, err := readBytes(resp.Body)
+			if err != nil {
+				return err
+			}
+			if len(data) > 0 || !mech.Completed() {
+				if _, err = mech.Next(ctx, data); err != nil {
+					return fmt.Errorf("cassandra: sasl mechanism %s: unable to verify server: %v", mechName, err)
+				}
+			}
+			if !mech.Completed() {
+				return fmt.Errorf("cassandra: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return nil
+		case OpError:
+			return parseError(resp.Body)
+		default:
+			return fmt.Errorf("cassandra: unexpected opcode 0x%02x", resp.Opcode)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cassandra
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Serve conducts SASL authentication as a server in response to startup, the
+// client's STARTUP message. The authenticator class name is announced in the
+// AUTHENTICATE message and mech is run against the client's AUTH_RESPONSE
+// messages. On success AUTH_SUCCESS is sent; on failure an ERROR is sent.
+func Serve(ctx context.Context, rw io.ReadWriter, startup *Frame, authenticator string, mech sasl.ServerMech) error {
+	if startup.Opcode != OpStartup {
+		return fmt.Errorf("cassandra: expected STARTUP, but got opcode 0x%02x", startup.Opcode)
+	}
+
+	version := startup.Version | responseFlag
+	stream := startup.Stream
+	if err := WriteFrame(rw, &Frame{Version: version, Stream: stream, Opcode: OpAuthenticate, Body: appendString(nil, authenticator)}); err != nil {
+		return err
+	}
+
+	var mechName string
+	var challenge []byte
+	for started := false; !started || !mech.Completed(); started = true {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		req, err := ReadFrame(rw)
+		if err != nil {
+			return err
+		}
+		stream = req.Stream
+		if req.Opcode != OpAuthResponse {
+			fail(rw, version, stream, ErrorCodeProtocol, "Unexpected message during authentication")
+			return fmt.Errorf("cassandra: expected AUTH_RESPONSE, but got opcode 0x%02x", req.Opcode)
+		}
+
+		response, err := readBytes(req.Body)
+		if err != nil {
+			fail(rw, version, stream, ErrorCodeProtocol, "Malformed AUTH_RESPONSE")
+			return err
+		}
+
+		if !started {
+			mechName, challenge, err = mech.Start(ctx, response)
+		} else {
+			challenge, err = mech.Next(ctx, response)
+		}
+		if err != nil {
+			fail(rw, version, stream, ErrorCodeBadCredentials, "Provided username and/or password are incorrect")
+			return fmt.Errorf("cassandra: sasl mechanism %s: %v", mechName, err)
+		}
+
+		if !mech.Completed() {
+			if err = WriteFrame(rw, &Frame{Version: version, Stream: stream, Opcode: OpAuthChallenge, Body: appendBytes(nil, challenge)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return WriteFrame(rw, &Frame{Version: version, Stream: stream, Opcode: OpAuthSuccess, Body: appendBytes(nil, challenge)})
+}
+
+// fail sends an ERROR message.
+func fail(w io.Writer, version byte, stream int16, code int32, message string) {
+	WriteFrame(w, &Frame{Version: version, Stream: stream, Opcode: OpError, Body: errorBody(&Error{Code: code, Message: message})})
+}
@@ -0,0 +1,70 @@
+package sasl
+
+import (
+	"crypto"
+	_ "crypto/sha256" // register SHA-256 for crypto.Hash
+	_ "crypto/sha512" // register SHA-384 and SHA-512 for crypto.Hash
+	"crypto/x509"
+	"fmt"
+)
+
+// ChannelBindingTLSServerEndPoint is the tls-server-end-point channel binding
+// type defined by RFC5929 (https://tools.ietf.org/html/rfc5929#section-4).
+const ChannelBindingTLSServerEndPoint = "tls-server-end-point"
+
+// ChannelBinder is implemented by mechanisms that can bind the exchange to the
+// underlying channel as described by RFC5056 (https://tools.ietf.org/html/rfc5056).
+type ChannelBinder interface {
+	SetChannelBinding(cbType string, data []byte)
+}
+
+// ChannelBindingSupporter is implemented by mechanisms that, when run
+// without channel binding, tell the peer whether they could have bound the
+// exchange, so that a stripped -PLUS variant is detected as described by
+// RFC5802 (https://tools.ietf.org/html/rfc5802#section-6).
+type ChannelBindingSupporter interface {
+	// SetChannelBindingSupported records that this side supports channel
+	// binding although the variant without it was selected. A client then
+	// claims that the server does not support channel binding, which a
+	// server that offered the -PLUS variant rejects.
+	SetChannelBindingSupported(supported bool)
+}
+
+// TLSServerEndPoint computes the tls-server-end-point channel binding data for
+// the server's certificate.
+func TLSServerEndPoint(cert *x509.Certificate) ([]byte, error) {
+	var hash crypto.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1,
+		x509.SHA256WithRSA, x509.DSAWithSHA256, x509.ECDSAWithSHA256, x509.SHA256WithRSAPSS:
+		// MD5 and SHA-1 are replaced by SHA-256.
+		hash = crypto.SHA256
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		hash = crypto.SHA384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		hash = crypto.SHA512
+	default:
+		return nil, fmt.Errorf("tls-server-end-point is undefined for signature algorithm %v", cert.SignatureAlgorithm)
+	}
+
+	h := hash.New()
+	h.Write(cert.Raw)
+	return h.Sum(nil), nil
+}
+
+// ConnState describes the connection an authentication runs over. It is
+// passed to the mechanism factories by Client.Auth and Server.Auth and may
+// be nil.
+type ConnState struct {
+	// ChannelBindingType and ChannelBinding are the channel binding of the
+	// connection, such as ChannelBindingTLSServerEndPoint and the data
+	// returned by TLSServerEndPoint. ChannelBindingType is empty when the
+	// connection offers no channel binding.
+	ChannelBindingType string
+	ChannelBinding     []byte
+}
+
+// HasChannelBinding reports whether the connection offers channel binding.
+func (s *ConnState) HasChannelBinding() bool {
+	return s != nil && s.ChannelBindingType != ""
+}
@@ -1,17 +1,28 @@
 package sasl
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sync"
+)
 
-// ClientMechFactory is used to create a server mechanism.
-type ClientMechFactory func(state interface{}) ClientMech
+// ClientMechFactory is used to create a client mechanism for a connection.
+type ClientMechFactory func(state *ConnState) ClientMech
 
-// Client aids in the encapsulation of all the supported mechanisms.
+// Client aids in the encapsulation of all the supported mechanisms. It is
+// safe for concurrent use, so mechanisms may be registered while
+// authentications are in progress.
 type Client struct {
+	mu        sync.RWMutex
 	factories map[string]ClientMechFactory
 }
 
-// RegisterMechFactory registers the mechanism factory by name.
+// RegisterMechFactory registers the mechanism factory by name, replacing any
+// factory already registered under it.
 func (c *Client) RegisterMechFactory(mechName string, factory ClientMechFactory) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.factories == nil {
 		c.factories = make(map[string]ClientMechFactory)
 	}
@@ -19,14 +30,80 @@ func (c *Client) RegisterMechFactory(mechName string, factory ClientMechFactory)
 	c.factories[mechName] = factory
 }
 
-// Auth authenticates/authorizes a user with the named mechanism.
-func (c *Client) Auth(ctx context.Context, state interface{}, mechName string, incoming <-chan []byte, outgoing chan<- []byte) error {
+// UnregisterMechFactory removes the named mechanism. Authentications already
+// in progress with it are unaffected.
+func (c *Client) UnregisterMechFactory(mechName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.factories, mechName)
+}
+
+// ReplaceMechFactories atomically replaces the registered mechanisms with
+// those of other, e.g. a Client built from reloaded configuration with
+// NewClientWithDefaults.
+func (c *Client) ReplaceMechFactories(other *Client) {
+	other.mu.RLock()
+	factories := make(map[string]ClientMechFactory, len(other.factories))
+	for name, factory := range other.factories {
+		factories[name] = factory
+	}
+	other.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.factories = factories
+}
+
+// Mechanisms returns the names of the registered mechanisms in order of
+// preference: strongest first by the MechStrength they were registered with
+// by RegisterClientMech, then by name. Mechanisms missing from that registry come
+// last. The order does not depend on the order of registration.
+func (c *Client) Mechanisms() []string {
+	c.mu.RLock()
+	mechNames := make([]string, 0, len(c.factories))
+	for mechName := range c.factories {
+		mechNames = append(mechNames, mechName)
+	}
+	c.mu.RUnlock()
+
+	sortMechNames(mechNames, lookupClientMech)
+	return mechNames
+}
+
+// MechanismsFor returns the names of the registered mechanisms usable over a
+// connection in order of preference, leaving out those flagged
+// MechChannelBinding when the connection has no channel binding.
+func (c *Client) MechanismsFor(state *ConnState) []string {
+	mechNames := c.Mechanisms()
+	if state.HasChannelBinding() {
+		return mechNames
+	}
+
+	result := mechNames[:0]
+	for _, mechName := range mechNames {
+		if _, flags := lookupClientMech(mechName); flags&MechChannelBinding == 0 {
+			result = append(result, mechName)
+		}
+	}
+	return result
+}
+
+// Auth authenticates/authorizes a user with the named mechanism. The state
+// of the connection, which may be nil, is passed to the mechanism's factory.
+func (c *Client) Auth(ctx context.Context, state *ConnState, mechName string, incoming <-chan []byte, outgoing chan<- []byte) error {
+	c.mu.RLock()
 	factory, ok := c.factories[mechName]
+	c.mu.RUnlock()
 	if !ok {
-		return newError("sasl mechanism '%' has not been registered", nil)
+		return newError(fmt.Sprintf("sasl mechanism '%s' has not been registered", mechName), nil)
+	}
+	if _, flags := lookupClientMech(mechName); flags&MechChannelBinding != 0 && !state.HasChannelBinding() {
+		return newError(fmt.Sprintf("sasl mechanism '%s' requires channel binding", mechName), nil)
 	}
 
 	mech := factory(state)
+	defer Dispose(mech)
 
 	return ConverseAsClient(ctx, mech, incoming, outgoing)
 }
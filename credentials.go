@@ -0,0 +1,71 @@
+package sasl
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+)
+
+// ErrCanceled is returned by a CredentialProvider when the credentials were
+// not provided, e.g. because the user dismissed a prompt.
+var ErrCanceled = errors.New("sasl: credential request canceled")
+
+// CredentialType identifies a kind of credential.
+type CredentialType uint
+
+const (
+	// CredentialUsername is the authentication identity, along with the
+	// authorization identity to act as, if any.
+	CredentialUsername CredentialType = 1 << iota
+	// CredentialPassword is a password.
+	CredentialPassword
+	// CredentialSaltedPassword is a password already salted and hashed for
+	// the Salt and Iterations of the request, as used by SCRAM.
+	CredentialSaltedPassword
+	// CredentialToken is a bearer token.
+	CredentialToken
+	// CredentialCertificate is a client certificate.
+	CredentialCertificate
+)
+
+// CredentialRequest describes the credentials a client mechanism needs.
+type CredentialRequest struct {
+	// Mechanism is the name of the requesting mechanism.
+	Mechanism string
+	// Types is the set of credential types the mechanism accepts. The
+	// provider returns at least one of them.
+	Types CredentialType
+	// Username is the authentication identity already obtained, if any.
+	Username string
+	// UsernameHint is a suggested authentication identity, if any.
+	UsernameHint string
+	// Realm is the realm the credentials are requested for, if any.
+	Realm string
+	// Prompt is a human readable description of the request, suitable for
+	// an interactive prompt.
+	Prompt string
+	// Salt and Iterations are set when a CredentialSaltedPassword is
+	// accepted.
+	Salt       []byte
+	Iterations int
+}
+
+// Credential holds the credentials returned by a CredentialProvider. Only the
+// fields for the requested types are used. Password and SaltedPassword are
+// handed over to the mechanism, which wipes them once used, so the provider
+// must return copies of any it keeps.
+type Credential struct {
+	Authz          string
+	Username       string
+	Password       []byte
+	SaltedPassword []byte
+	Token          string
+	Certificate    *tls.Certificate
+}
+
+// CredentialProvider returns the requested credentials. Mechanisms call it
+// lazily, only once the exchange needs the credentials, and may call it more
+// than once per exchange as more becomes known, e.g. once for the username
+// and again for the password once the salt is known. It returns ErrCanceled
+// when the credentials are not available.
+type CredentialProvider func(ctx context.Context, req *CredentialRequest) (*Credential, error)
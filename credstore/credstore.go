@@ -0,0 +1,198 @@
+// Package credstore serves stored credentials to the server side of the
+// mechanisms. A Backend looks up a user's entry and the adapters turn it into
+// the callbacks each mechanism package expects.
+//
+// Password hashes are checked by VerifyHash, which only knows the "{SHA}" and
+// "$apr1$" forms written by htpasswd. The package has no dependencies outside
+// the standard library, so bcrypt hashes, as written by htpasswd -B, are
+// rejected as unsupported until a comparer is registered with RegisterHash.
+package credstore
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramcred"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+var (
+	// ErrNotFound is returned by a Backend when the user does not exist.
+	ErrNotFound = errors.New("credstore: user not found")
+
+	// ErrInvalidCredentials is returned by the verifiers when the user does
+	// not exist or the credentials do not match.
+	ErrInvalidCredentials = errors.New("credstore: invalid username or password")
+)
+
+// Backend looks up stored credentials.
+type Backend interface {
+	// Lookup returns the user's entry, or ErrNotFound.
+	Lookup(ctx context.Context, username string) (*Entry, error)
+}
+
+// Entry holds the stored credentials of a user. Any of them may be absent.
+type Entry struct {
+	Username string
+
+	// Password is the cleartext password, which challenge-response
+	// mechanisms such as CRAM-MD5 and DIGEST-MD5 use as shared secret.
+	Password string
+
+	// Hash is a password hash in one of the forms known to VerifyHash.
+	Hash string
+
+	// SCRAM holds the SCRAM credentials, one per mechanism.
+	SCRAM []*scramcred.Credential
+
+	// Tokens holds the tokens accepted for the user.
+	Tokens []string
+}
+
+// SCRAMCredential returns the entry's credential for the named SCRAM
+// mechanism, or nil if there is none.
+func (e *Entry) SCRAMCredential(mechName string) *scramcred.Credential {
+	for _, c := range e.SCRAM {
+		if c.Mechanism == mechName {
+			return c
+		}
+	}
+	return nil
+}
+
+// VerifyPassword checks password against the entry's cleartext password,
+// password hash or SCRAM-SHA-1 credential, whichever is present first.
+func (e *Entry) VerifyPassword(password string) error {
+	switch {
+	case e.Password != "":
+		if subtle.ConstantTimeCompare([]byte(e.Password), []byte(password)) == 1 {
+			return nil
+		}
+	case e.Hash != "":
+		return VerifyHash(e.Hash, password)
+	case e.SCRAMCredential(scramsha1.MechName) != nil:
+		c := e.SCRAMCredential(scramsha1.MechName)
+		if c.Iterations > 0xffff {
+			return fmt.Errorf("credstore: %d iterations are not supported by %s", c.Iterations, scramsha1.MechName)
+		}
+		_, storedKey, _ := scramsha1.GenerateKeys(password, c.Salt, uint16(c.Iterations))
+		if subtle.ConstantTimeCompare(storedKey, c.StoredKey) == 1 {
+			return nil
+		}
+	}
+	return ErrInvalidCredentials
+}
+
+// SecretProvider returns the shared secret of a user.
+type SecretProvider func(ctx context.Context, username string) ([]byte, error)
+
+// TokenVerifier verifies a token presented by a user.
+type TokenVerifier func(ctx context.Context, username, token string) error
+
+// UserPassVerifier adapts b for plain.ServerMech.
+func UserPassVerifier(b Backend) plain.UserPassVerifier {
+	return func(ctx context.Context, username, password string) error {
+		e, err := b.Lookup(ctx, username)
+		if err == ErrNotFound {
+			return ErrInvalidCredentials
+		}
+		if err != nil {
+			return err
+		}
+		return e.VerifyPassword(password)
+	}
+}
+
+// StoredUserProvider adapts b for scramsha1.ServerMech. Users without a
+// SCRAM-SHA-1 credential are reported as scramsha1.ErrUnknownUser.
+func StoredUserProvider(b Backend) scramsha1.StoredUserProvider {
+	return func(ctx context.Context, username string) (*scramsha1.StoredUser, error) {
+		e, err := b.Lookup(ctx, username)
+		if err == ErrNotFound {
+			return nil, fmt.Errorf("%w: %w", ErrNotFound, scramsha1.ErrUnknownUser)
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := e.SCRAMCredential(scramsha1.MechName)
+		if c == nil {
+			return nil, fmt.Errorf("credstore: no %s credential for user %q: %w", scramsha1.MechName, username, scramsha1.ErrUnknownUser)
+		}
+		return c.StoredUser()
+	}
+}
+
+// SharedSecretProvider adapts b for challenge-response mechanisms needing the
+// cleartext password.
+func SharedSecretProvider(b Backend) SecretProvider {
+	return func(ctx context.Context, username string) ([]byte, error) {
+		e, err := b.Lookup(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		if e.Password == "" {
+			return nil, fmt.Errorf("credstore: no shared secret for user %q", username)
+		}
+		return []byte(e.Password), nil
+	}
+}
+
+// TokenVerifierFor adapts b for token based mechanisms.
+func TokenVerifierFor(b Backend) TokenVerifier {
+	return func(ctx context.Context, username, token string) error {
+		e, err := b.Lookup(ctx, username)
+		if err == ErrNotFound {
+			return ErrInvalidCredentials
+		}
+		if err != nil {
+			return err
+		}
+
+		match := 0
+		for _, t := range e.Tokens {
+			match |= subtle.ConstantTimeCompare([]byte(t), []byte(token))
+		}
+		if match != 1 {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}
+}
+
+// NewMemoryBackend creates an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: make(map[string]*Entry)}
+}
+
+// MemoryBackend is a Backend holding its entries in memory. It is not safe
+// to Add entries while it is in use.
+type MemoryBackend struct {
+	entries map[string]*Entry
+}
+
+// Add adds or replaces the entry for e.Username.
+func (b *MemoryBackend) Add(e *Entry) {
+	b.entries[e.Username] = e
+}
+
+// Lookup implements Backend.
+func (b *MemoryBackend) Lookup(_ context.Context, username string) (*Entry, error) {
+	e, ok := b.entries[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+// entry returns the entry for username, adding it if necessary.
+func (b *MemoryBackend) entry(username string) *Entry {
+	e, ok := b.entries[username]
+	if !ok {
+		e = &Entry{Username: username}
+		b.entries[username] = e
+	}
+	return e
+}
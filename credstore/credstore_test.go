@@ -0,0 +1,257 @@
+package credstore_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl/credstore"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramcred"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+// the RFC5802 example credential for password "pencil".
+const pencil = "SCRAM-SHA-1$4096:QSXCR+Q6sek8bf92$6dlGYMOdZcOPutkcNY8U2g7vK9Y=:D+CSWLOshSulAsxiupA+qs2/fTE="
+
+func TestVerifyHash(t *testing.T) {
+	credstore.RegisterHash("$test$", func(hash, password string) error {
+		if hash[len("$test$"):] != password {
+			return errors.New("mismatch")
+		}
+		return nil
+	})
+
+	tests := []struct {
+		hash     string
+		password string
+		err      string
+	}{
+		{"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "password", ""},
+		{"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "wrong", "credstore: invalid username or password"},
+		{"$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/", "myPassword", ""},
+		{"$apr1$abcdefgh$NriZ3KceyQFy368Ufp8U./", "pass word", ""},
+		{"$apr1$abcdefgh$NriZ3KceyQFy368Ufp8U./", "password", "credstore: invalid username or password"},
+		{"$apr1$abcdefgh", "password", "credstore: invalid username or password: invalid $apr1$ hash"},
+		{"$test$secret", "secret", ""},
+		{"$test$secret", "wrong", "credstore: invalid username or password: mismatch"},
+		{"$2y$05$abcdefghijklmnopqrstuu", "password", "credstore: unsupported password hash"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.hash+":"+test.password, func(t *testing.T) {
+			err := credstore.VerifyHash(test.hash, test.password)
+			testhelpers.VerifyError(t, "verify", test.err, err)
+			if test.err != "" && strings.HasPrefix(test.err, "credstore: invalid") && !errors.Is(err, credstore.ErrInvalidCredentials) {
+				t.Fatalf("expected error to wrap ErrInvalidCredentials")
+			}
+		})
+	}
+}
+
+func TestBackends(t *testing.T) {
+	htpasswd, err := credstore.LoadHtpasswd(strings.NewReader("# users\njack:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"))
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	sasldb, err := credstore.LoadSasldb(strings.NewReader(
+		"jack@example.com:userPassword:password\n"+
+			"jack@example.com:authPassword:"+pencil+"\n"+
+			"jack@other.com:userPassword:other\n"+
+			"jack@example.com:cmusaslsecretOTP:ignored\n",
+	), "example.com")
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	db := sql.OpenDB(&fakeConnector{rows: map[string][][2]string{
+		"jack": {{credstore.KindHash, "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="}, {credstore.KindSCRAM, pencil}, {credstore.KindToken, "t0ken"}, {"other", "ignored"}},
+	}})
+	defer db.Close()
+
+	backends := []struct {
+		name    string
+		backend credstore.Backend
+		scram   bool
+		secret  bool
+		token   bool
+	}{
+		{"htpasswd", htpasswd, false, false, false},
+		{"sasldb", sasldb, true, true, false},
+		{"sql", credstore.NewSQLBackend(db, "SELECT kind, value FROM credentials WHERE username = ?"), true, false, true},
+	}
+
+	ctx := context.Background()
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			verifier := credstore.UserPassVerifier(b.backend)
+			testhelpers.VerifyError(t, "verify", "", verifier(ctx, "jack", "password"))
+			testhelpers.VerifyError(t, "verify", "credstore: invalid username or password", verifier(ctx, "jack", "wrong"))
+			testhelpers.VerifyError(t, "verify", "credstore: invalid username or password", verifier(ctx, "jane", "password"))
+
+			storedUser, err := credstore.StoredUserProvider(b.backend)(ctx, "jack")
+			if b.scram {
+				if err != nil || storedUser.Iterations != 4096 {
+					t.Fatalf("expected stored user, but got %+v, %v", storedUser, err)
+				}
+			} else {
+				testhelpers.VerifyError(t, "stored user", "credstore: no SCRAM-SHA-1 credential for user \"jack\": scramsha1: unknown user", err)
+			}
+
+			secret, err := credstore.SharedSecretProvider(b.backend)(ctx, "jack")
+			if b.secret {
+				if err != nil || string(secret) != "password" {
+					t.Fatalf("expected shared secret, but got %q, %v", secret, err)
+				}
+			} else {
+				testhelpers.VerifyError(t, "secret", "credstore: no shared secret for user \"jack\"", err)
+			}
+
+			err = credstore.TokenVerifierFor(b.backend)(ctx, "jack", "t0ken")
+			if b.token {
+				testhelpers.VerifyError(t, "token", "", err)
+			} else {
+				testhelpers.VerifyError(t, "token", "credstore: invalid username or password", err)
+			}
+		})
+	}
+
+	t.Run("scram exchange", func(t *testing.T) {
+		// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+		mr := rand.New(rand.NewSource(1))
+		testhelpers.RunClientServerTest(t,
+			scramsha1.NewClientMech("", "jack", "pencil", 24, mr),
+			scramsha1.NewServerMech(credstore.StoredUserProvider(sasldb), nil, 24, mr),
+			"",
+			"",
+		)
+	})
+
+	t.Run("plain exchange", func(t *testing.T) {
+		testhelpers.RunClientServerTest(t,
+			plain.NewClientMech("", "jack", "password"),
+			plain.NewServerMech(credstore.UserPassVerifier(htpasswd), nil),
+			"",
+			"",
+		)
+	})
+}
+
+// fakeConnector serves fixed rows for each username, standing in for a real
+// database driver.
+type fakeConnector struct {
+	rows map[string][][2]string
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{c}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ c *fakeConnector }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return &fakeStmt{c.c}, nil }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type fakeStmt struct{ c *fakeConnector }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return 1 }
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{rows: s.c.rows[args[0].(string)]}, nil
+}
+
+type fakeRows struct{ rows [][2]string }
+
+func (r *fakeRows) Columns() []string { return []string{"kind", "value"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	dest[0], dest[1] = r.rows[0][0], r.rows[0][1]
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestUpgrader(t *testing.T) {
+	backend := credstore.NewMemoryBackend()
+	backend.Add(&credstore.Entry{Username: "jack", Hash: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="})
+
+	var written []string
+	write := func(_ context.Context, username string, creds []*scramcred.Credential) error {
+		e, _ := backend.Lookup(context.Background(), username)
+		for _, c := range creds {
+			written = append(written, c.Mechanism)
+			for i, old := range e.SCRAM {
+				if old.Mechanism == c.Mechanism {
+					e.SCRAM = append(e.SCRAM[:i], e.SCRAM[i+1:]...)
+					break
+				}
+			}
+			e.SCRAM = append(e.SCRAM, c)
+		}
+		return nil
+	}
+
+	var upgradeErr error
+	upgrader := credstore.NewUpgrader(backend, write, credstore.UpgradePolicy{
+		Mechanisms: []string{"SCRAM-SHA-1", "SCRAM-SHA-256"},
+		Iterations: 4096,
+		OnError:    func(_ context.Context, _ string, err error) { upgradeErr = err },
+	})
+	verifier := upgrader.Verifier(credstore.UserPassVerifier(backend))
+
+	ctx := context.Background()
+	testhelpers.VerifyError(t, "verify", "credstore: invalid username or password", verifier(ctx, "jack", "wrong"))
+	if len(written) != 0 {
+		t.Fatalf("expected no upgrade after a failed verification, but got %v", written)
+	}
+
+	testhelpers.VerifyError(t, "verify", "", verifier(ctx, "jack", "password"))
+	if strings.Join(written, ",") != "SCRAM-SHA-1,SCRAM-SHA-256" {
+		t.Fatalf("expected both credentials to be written, but got %v", written)
+	}
+
+	// the derived credentials authenticate the user with SCRAM.
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+	testhelpers.RunClientServerTest(t,
+		scramsha1.NewClientMech("", "jack", "password", 24, mr),
+		scramsha1.NewServerMech(credstore.StoredUserProvider(backend), nil, 24, mr),
+		"",
+		"",
+	)
+
+	written = nil
+	testhelpers.VerifyError(t, "verify", "", verifier(ctx, "jack", "password"))
+	if len(written) != 0 {
+		t.Fatalf("expected no upgrade of current credentials, but got %v", written)
+	}
+
+	e, _ := backend.Lookup(ctx, "jack")
+	e.SCRAM[0], _ = scramcred.Derive("SCRAM-SHA-1", "password", []byte("salt"), 1000)
+	testhelpers.VerifyError(t, "verify", "", verifier(ctx, "jack", "password"))
+	if strings.Join(written, ",") != "SCRAM-SHA-1" {
+		t.Fatalf("expected the weak credential to be derived again, but got %v", written)
+	}
+	if e.SCRAMCredential("SCRAM-SHA-1").Iterations != 4096 {
+		t.Fatalf("expected the credential to use 4096 iterations")
+	}
+
+	upgrader = credstore.NewUpgrader(backend, write, credstore.UpgradePolicy{
+		Mechanisms: []string{"SCRAM-MD5"},
+		OnError:    func(_ context.Context, _ string, err error) { upgradeErr = err },
+	})
+	testhelpers.VerifyError(t, "verify", "", upgrader.Verifier(credstore.UserPassVerifier(backend))(ctx, "jack", "password"))
+	testhelpers.VerifyError(t, "upgrade", "scramcred: unsupported mechanism SCRAM-MD5", upgradeErr)
+}
@@ -0,0 +1,154 @@
+package credstore
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// HashComparer compares a password with a hash it recognizes.
+type HashComparer func(hash, password string) error
+
+var hashes = struct {
+	mu       sync.RWMutex
+	prefixes []string
+	compare  map[string]HashComparer
+}{
+	prefixes: []string{"{SHA}", "$apr1$"},
+	compare: map[string]HashComparer{
+		"{SHA}":  compareSHA,
+		"$apr1$": compareAPR1,
+	},
+}
+
+// RegisterHash makes VerifyHash use compare for hashes starting with prefix.
+// It panics if called twice for the same prefix. No bcrypt implementation is
+// built in, so to accept the "$2y$" hashes written by htpasswd -B register one
+// backed by e.g. golang.org/x/crypto/bcrypt:
+//
+//	credstore.RegisterHash("$2y$", func(hash, password string) error {
+//		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+//	})
+func RegisterHash(prefix string, compare HashComparer) {
+	hashes.mu.Lock()
+	defer hashes.mu.Unlock()
+
+	if _, ok := hashes.compare[prefix]; ok {
+		panic("credstore: RegisterHash called twice for prefix " + prefix)
+	}
+	hashes.prefixes = append(hashes.prefixes, prefix)
+	hashes.compare[prefix] = compare
+}
+
+// VerifyHash checks password against hash, which is one of the forms written
+// by htpasswd: "{SHA}" followed by the base64 encoded SHA-1 digest, the
+// "$apr1$" MD5 variant, or one registered with RegisterHash. It returns
+// ErrInvalidCredentials when the password does not match.
+func VerifyHash(hash, password string) error {
+	hashes.mu.RLock()
+	var compare HashComparer
+	for _, prefix := range hashes.prefixes {
+		if strings.HasPrefix(hash, prefix) {
+			compare = hashes.compare[prefix]
+			break
+		}
+	}
+	hashes.mu.RUnlock()
+
+	if compare == nil {
+		return fmt.Errorf("credstore: unsupported password hash")
+	}
+	if err := compare(hash, password); err != nil {
+		if err != ErrInvalidCredentials {
+			err = fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func compareSHA(hash, password string) error {
+	digest := sha1.Sum([]byte(password))
+	if subtle.ConstantTimeCompare([]byte(hash[len("{SHA}"):]), []byte(base64.StdEncoding.EncodeToString(digest[:]))) != 1 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func compareAPR1(hash, password string) error {
+	salt, _, ok := strings.Cut(hash[len("$apr1$"):], "$")
+	if !ok {
+		return errors.New("invalid $apr1$ hash")
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(apr1(password, salt))) != 1 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// apr1 computes the Apache variant of the MD5 based crypt scheme.
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		d.Write(alt[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d.Reset()
+		if i&1 != 0 {
+			d.Write(pw)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 != 0 {
+			d.Write(final)
+		} else {
+			d.Write(pw)
+		}
+		final = d.Sum(final[:0])
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var b strings.Builder
+	b.WriteString(magic + salt + "$")
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(final[g[0]])<<16|uint32(final[g[1]])<<8|uint32(final[g[2]]), 4)
+	}
+	encode(uint32(final[11]), 2)
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package credstore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LoadHtpasswd reads an Apache htpasswd file. Each line holds a username and
+// a password hash separated by a ':'; blank lines and lines starting with '#'
+// are ignored. The hashes are checked by VerifyHash when passwords are
+// verified, so bcrypt entries are only accepted once a comparer has been
+// registered for them.
+func LoadHtpasswd(r io.Reader) (*MemoryBackend, error) {
+	b := NewMemoryBackend()
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" || hash == "" {
+			return nil, fmt.Errorf("credstore: htpasswd line %d: expected username and hash", lineNo)
+		}
+		b.entry(username).Hash = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("credstore: unable to read htpasswd file: %v", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,56 @@
+package credstore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl/scramcred"
+)
+
+// LoadSasldb reads the text form of a Cyrus SASL sasldb, keeping the entries
+// of the given realm. Each line holds "user@realm:property:value"; blank
+// lines and lines starting with '#' are ignored. The userPassword property
+// holds the cleartext password and authPassword an RFC5803 SCRAM credential.
+// Other properties are ignored.
+func LoadSasldb(r io.Reader, realm string) (*MemoryBackend, error) {
+	b := NewMemoryBackend()
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		var property string
+		if ok {
+			property, value, ok = strings.Cut(value, ":")
+		}
+		at := strings.LastIndexByte(key, '@')
+		if !ok || at <= 0 {
+			return nil, fmt.Errorf("credstore: sasldb line %d: expected user@realm, property and value", lineNo)
+		}
+		if key[at+1:] != realm {
+			continue
+		}
+		username := key[:at]
+
+		switch property {
+		case "userPassword":
+			b.entry(username).Password = value
+		case "authPassword":
+			c, err := scramcred.Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("credstore: sasldb line %d: %v", lineNo, err)
+			}
+			e := b.entry(username)
+			e.SCRAM = append(e.SCRAM, c)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("credstore: unable to read sasldb file: %v", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,78 @@
+package credstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/craiggwilson/go-sasl/scramcred"
+)
+
+// Kinds of credential returned by the query of an SQLBackend.
+const (
+	KindPassword = "password"
+	KindHash     = "hash"
+	KindSCRAM    = "scram"
+	KindToken    = "token"
+)
+
+// NewSQLBackend creates an SQLBackend running query, which takes the
+// username as its only argument and returns rows of two string columns: the
+// kind of credential (KindPassword, KindHash, KindSCRAM or KindToken) and its
+// value. SCRAM credentials are in the RFC5803 form. Rows of other kinds are
+// ignored, so a query may be written against any schema, e.g.:
+//
+//	SELECT 'hash', password_hash FROM users WHERE name = ?
+//
+// with the placeholder syntax of the driver in use.
+func NewSQLBackend(db *sql.DB, query string) *SQLBackend {
+	return &SQLBackend{db: db, query: query}
+}
+
+// SQLBackend is a Backend looking up credentials in a database.
+type SQLBackend struct {
+	db    *sql.DB
+	query string
+}
+
+// Lookup implements Backend.
+func (b *SQLBackend) Lookup(ctx context.Context, username string) (*Entry, error) {
+	rows, err := b.db.QueryContext(ctx, b.query, username)
+	if err != nil {
+		return nil, fmt.Errorf("credstore: unable to query credentials: %v", err)
+	}
+	defer rows.Close()
+
+	e := &Entry{Username: username}
+	found := false
+	for rows.Next() {
+		var kind, value string
+		if err = rows.Scan(&kind, &value); err != nil {
+			return nil, fmt.Errorf("credstore: unable to read credentials: %v", err)
+		}
+		found = true
+
+		switch kind {
+		case KindPassword:
+			e.Password = value
+		case KindHash:
+			e.Hash = value
+		case KindSCRAM:
+			c, err := scramcred.Parse(value)
+			if err != nil {
+				return nil, err
+			}
+			e.SCRAM = append(e.SCRAM, c)
+		case KindToken:
+			e.Tokens = append(e.Tokens, value)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("credstore: unable to read credentials: %v", err)
+	}
+
+	if !found {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
@@ -0,0 +1,120 @@
+package credstore
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramcred"
+)
+
+// CredentialWriter persists SCRAM credentials derived by an Upgrader,
+// replacing the user's credentials for the same mechanisms.
+type CredentialWriter func(ctx context.Context, username string, creds []*scramcred.Credential) error
+
+// UpgradePolicy configures an Upgrader.
+type UpgradePolicy struct {
+	// Mechanisms lists the SCRAM mechanisms to derive credentials for.
+	Mechanisms []string
+
+	// Iterations is the iteration count of derived credentials. It defaults
+	// to 4096.
+	Iterations int
+
+	// MinIterations is the iteration count below which existing credentials
+	// are derived again. It defaults to Iterations.
+	MinIterations int
+
+	// SaltLen is the length of generated salts. It defaults to 16.
+	SaltLen int
+
+	// SaltSource is where salts are read from. It defaults to crypto/rand.
+	SaltSource io.Reader
+
+	// OnError, when set, is called with the errors of failed upgrades. They
+	// never fail the authentication itself.
+	OnError func(ctx context.Context, username string, err error)
+}
+
+// NewUpgrader creates an Upgrader checking the credentials in b and writing
+// new ones with write.
+func NewUpgrader(b Backend, write CredentialWriter, policy UpgradePolicy) *Upgrader {
+	if policy.Iterations == 0 {
+		policy.Iterations = 4096
+	}
+	if policy.MinIterations == 0 {
+		policy.MinIterations = policy.Iterations
+	}
+	if policy.SaltLen == 0 {
+		policy.SaltLen = 16
+	}
+	if policy.SaltSource == nil {
+		policy.SaltSource = rand.Reader
+	}
+
+	return &Upgrader{
+		backend: b,
+		write:   write,
+		policy:  policy,
+	}
+}
+
+// Upgrader derives SCRAM credentials from the cleartext passwords of users
+// authenticating with mechanisms such as PLAIN, which is the only chance to
+// populate them for users migrated from other password hashes.
+type Upgrader struct {
+	backend Backend
+	write   CredentialWriter
+	policy  UpgradePolicy
+}
+
+// Verifier wraps verifier to upgrade the user's credentials after each
+// successful verification.
+func (u *Upgrader) Verifier(verifier plain.UserPassVerifier) plain.UserPassVerifier {
+	return func(ctx context.Context, username, password string) error {
+		if err := verifier(ctx, username, password); err != nil {
+			return err
+		}
+
+		if err := u.Upgrade(ctx, username, password); err != nil && u.policy.OnError != nil {
+			u.policy.OnError(ctx, username, err)
+		}
+		return nil
+	}
+}
+
+// Upgrade derives and writes the credentials the user is missing, or whose
+// iteration count is below the policy's minimum, from the verified password.
+func (u *Upgrader) Upgrade(ctx context.Context, username, password string) error {
+	e, err := u.backend.Lookup(ctx, username)
+	if err == ErrNotFound {
+		e = &Entry{Username: username}
+	} else if err != nil {
+		return err
+	}
+
+	var creds []*scramcred.Credential
+	for _, mechName := range u.policy.Mechanisms {
+		if c := e.SCRAMCredential(mechName); c != nil && c.Iterations >= u.policy.MinIterations {
+			continue
+		}
+
+		salt := make([]byte, u.policy.SaltLen)
+		if _, err = io.ReadFull(u.policy.SaltSource, salt); err != nil {
+			return fmt.Errorf("credstore: unable to generate salt: %v", err)
+		}
+
+		c, err := scramcred.Derive(mechName, password, salt, u.policy.Iterations)
+		if err != nil {
+			return err
+		}
+		creds = append(creds, c)
+	}
+
+	if len(creds) == 0 {
+		return nil
+	}
+	return u.write(ctx, username, creds)
+}
@@ -0,0 +1,17 @@
+package sasl
+
+// Disposer is implemented by mechanisms holding secrets, such as passwords
+// and keys. Mechanisms wipe their secrets from memory once the exchange
+// completes or fails; Dispose does so for exchanges abandoned midway.
+type Disposer interface {
+	// Dispose wipes the secrets held by the mechanism, which cannot be used
+	// afterwards.
+	Dispose()
+}
+
+// Dispose calls mech's Dispose method if it implements Disposer.
+func Dispose(mech interface{}) {
+	if d, ok := mech.(Disposer); ok {
+		d.Dispose()
+	}
+}
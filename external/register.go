@@ -0,0 +1,37 @@
+package external
+
+import "github.com/craiggwilson/go-sasl"
+
+// ServerConfig configures the ServerMechs created by
+// sasl.NewServerWithDefaults. The Verifier checks the authorization identity
+// against the credentials established outside of SASL, such as a TLS client
+// certificate, so the mechanism is only enabled when it is set.
+type ServerConfig struct {
+	Verifier AuthzVerifier
+}
+
+// MechName implements sasl.MechConfig.
+func (c *ServerConfig) MechName() string {
+	return MechName
+}
+
+func init() {
+	sasl.RegisterServerMech(MechName, sasl.MechStrengthExternal, 0, func(opts *sasl.ServerOptions) sasl.ServerMechFactory {
+		config, _ := opts.Config(MechName).(*ServerConfig)
+		if config == nil || config.Verifier == nil {
+			return nil
+		}
+
+		verifier := config.Verifier
+		return func(*sasl.ConnState) sasl.ServerMech {
+			return NewServerMech(verifier)
+		}
+	})
+
+	sasl.RegisterClientMech(MechName, sasl.MechStrengthExternal, 0, func(opts *sasl.ClientOptions) sasl.ClientMechFactory {
+		authz := opts.Authz
+		return func(*sasl.ConnState) sasl.ClientMech {
+			return NewClientMech(authz)
+		}
+	})
+}
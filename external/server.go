@@ -3,6 +3,8 @@ package external
 import (
 	"context"
 	"fmt"
+
+	"github.com/craiggwilson/go-sasl"
 )
 
 // AuthzVerifier verifies the client's authorization identity.
@@ -59,3 +61,13 @@ func (m *ServerMech) Next(ctx context.Context, response []byte) ([]byte, error)
 func (m *ServerMech) Completed() bool {
 	return m.done
 }
+
+// Result returns the result of the completed exchange. The authentication
+// identity was established outside of SASL and is left for the caller to
+// fill in.
+func (m *ServerMech) Result() *sasl.Result {
+	return &sasl.Result{
+		Mechanism:       MechName,
+		AuthorizationID: m.Authz,
+	}
+}
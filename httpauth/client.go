@@ -0,0 +1,141 @@
+package httpauth
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ClientMechProvider returns a new client mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ClientMechProvider func(mechName string) sasl.ClientMech
+
+// NewTransport creates a Transport that sends requests using base, or
+// http.DefaultTransport if base is nil.
+func NewTransport(base http.RoundTripper, provider ClientMechProvider) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		base:     base,
+		provider: provider,
+	}
+}
+
+// Transport is an http.RoundTripper answering 401 responses challenging a
+// supported mechanism. The request is repeated for each step of the
+// exchange, so requests with a body must set GetBody to be authenticated.
+// When the exchange fails on the server, the final 401 response is returned.
+type Transport struct {
+	base     http.RoundTripper
+	provider ClientMechProvider
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	var mech sasl.ClientMech
+	var realm string
+	for _, c := range ParseChallenges(resp.Header.Values(HeaderWWWAuthenticate)) {
+		if mech = t.provider(c.Scheme); mech != nil {
+			realm = c.Params["realm"]
+			break
+		}
+	}
+	if mech == nil {
+		return resp, nil
+	}
+	discard(resp)
+
+	ctx := req.Context()
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("httpauth: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	params := map[string]string{"data": encodeData(response)}
+	if realm != "" {
+		params["realm"] = realm
+	}
+
+	for {
+		if resp, err = t.send(req, Challenge{Scheme: mechName, Params: params}); err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			break
+		}
+
+		var sid, data string
+		for _, c := range ParseChallenges(resp.Header.Values(HeaderWWWAuthenticate)) {
+			if c.Scheme == mechName && c.Params["sid"] != "" {
+				sid, data = c.Params["sid"], c.Params["data"]
+				break
+			}
+		}
+		if sid == "" {
+			// the server restarted authentication, so the exchange failed.
+			return resp, nil
+		}
+		discard(resp)
+
+		challenge, err := decodeData(data)
+		if err != nil {
+			return nil, fmt.Errorf("httpauth: invalid challenge encoding: %v", err)
+		}
+		if response, err = mech.Next(ctx, challenge); err != nil {
+			return nil, fmt.Errorf("httpauth: sasl mechanism %s: client failed to provide response: %v", mechName, err)
+		}
+		params = map[string]string{"sid": sid, "data": encodeData(response)}
+	}
+
+	var data []byte
+	if info := ParseChallenges(resp.Header.Values(HeaderAuthenticationInfo)); len(info) > 0 {
+		if data, err = decodeData(info[0].Params["data"]); err != nil {
+			discard(resp)
+			return nil, fmt.Errorf("httpauth: invalid authentication info encoding: %v", err)
+		}
+	}
+	if len(data) > 0 || !mech.Completed() {
+		if _, err = mech.Next(ctx, data); err != nil {
+			discard(resp)
+			return nil, fmt.Errorf("httpauth: sasl mechanism %s: unable to verify server: %v", mechName, err)
+		}
+	}
+	if !mech.Completed() {
+		discard(resp)
+		return nil, fmt.Errorf("httpauth: sasl mechanism %s: server completed the exchange before the client", mechName)
+	}
+	return resp, nil
+}
+
+// send repeats req with the given credentials.
+func (t *Transport) send(req *http.Request, credentials Challenge) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	r.Header.Set(HeaderAuthorization, credentials.String())
+	return t.base.RoundTrip(r)
+}
+
+// discard drains and closes the body of a response that is not returned so
+// the connection can be reused.
+func discard(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
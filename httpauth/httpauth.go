@@ -0,0 +1,152 @@
+// Package httpauth runs SASL mechanisms as HTTP authentication schemes as
+// defined by RFC7804 (https://tools.ietf.org/html/rfc7804), where the scheme
+// name is the mechanism name and each step of the exchange is a separate
+// request carrying sid and data auth-params. RFC7804 specifies SCRAM-SHA-256,
+// whose mechanisms are provided by the scramsha256 package.
+package httpauth
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+)
+
+// Header fields used during authentication.
+const (
+	HeaderWWWAuthenticate    = "WWW-Authenticate"
+	HeaderAuthorization      = "Authorization"
+	HeaderAuthenticationInfo = "Authentication-Info"
+)
+
+// Challenge is a single authentication scheme and its auth-params, as found
+// in WWW-Authenticate, Authorization and Authentication-Info fields.
+type Challenge struct {
+	Scheme string
+	Params map[string]string
+}
+
+// ParseChallenges parses the challenges in the given field values. Values
+// may carry several comma-separated challenges. Authentication-Info values,
+// which carry only auth-params, are returned as a single challenge with an
+// empty scheme.
+func ParseChallenges(values []string) []Challenge {
+	var challenges []Challenge
+	for _, v := range values {
+		for {
+			v = strings.TrimLeft(v, " \t,")
+			if v == "" {
+				break
+			}
+
+			name, rest := splitToken(v)
+			rest = strings.TrimLeft(rest, " \t")
+			if !strings.HasPrefix(rest, "=") {
+				// a token not followed by '=' starts a new challenge.
+				challenges = append(challenges, Challenge{Scheme: name, Params: map[string]string{}})
+				v = rest
+				continue
+			}
+
+			if len(challenges) == 0 {
+				challenges = append(challenges, Challenge{Params: map[string]string{}})
+			}
+
+			var value string
+			value, v = parseValue(strings.TrimLeft(rest[1:], " \t"))
+			challenges[len(challenges)-1].Params[strings.ToLower(name)] = value
+		}
+	}
+	return challenges
+}
+
+// String formats the challenge as a field value. The realm is always quoted;
+// other values are written as is.
+func (c Challenge) String() string {
+	names := make([]string, 0, len(c.Params))
+	for name := range c.Params {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return paramOrder(names[i]) < paramOrder(names[j]) ||
+			paramOrder(names[i]) == paramOrder(names[j]) && names[i] < names[j]
+	})
+
+	params := make([]string, 0, len(names))
+	for _, name := range names {
+		value := c.Params[name]
+		if name == "realm" {
+			value = quote(value)
+		}
+		params = append(params, name+"="+value)
+	}
+
+	switch {
+	case c.Scheme == "":
+		return strings.Join(params, ", ")
+	case len(params) == 0:
+		return c.Scheme
+	}
+	return c.Scheme + " " + strings.Join(params, ", ")
+}
+
+// paramOrder places the realm, sid and data params first, in the order used
+// by the examples in RFC7804.
+func paramOrder(name string) int {
+	switch name {
+	case "realm":
+		return 0
+	case "sid":
+		return 1
+	case "data":
+		return 2
+	}
+	return 3
+}
+
+func splitToken(s string) (string, string) {
+	i := strings.IndexAny(s, " \t,=")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// parseValue parses a token or quoted-string value. Base64 data may end with
+// '=' padding, so unquoted values extend to the next comma or space.
+func parseValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexAny(s, " \t,")
+		if i < 0 {
+			return s, ""
+		}
+		return s[:i], s[i:]
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func encodeData(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeData(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(s)
+}
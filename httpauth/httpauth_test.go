@@ -0,0 +1,353 @@
+package httpauth_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/httpauth"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+	"github.com/craiggwilson/go-sasl/scramsha256"
+	"github.com/craiggwilson/go-sasl/sealing"
+)
+
+func TestParseChallenges(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		expected []httpauth.Challenge
+	}{
+		{
+			"rfc7804",
+			[]string{`SCRAM-SHA-256 realm="testrealm@example.com", Basic realm="testrealm@example.com"`},
+			[]httpauth.Challenge{
+				{Scheme: "SCRAM-SHA-256", Params: map[string]string{"realm": "testrealm@example.com"}},
+				{Scheme: "Basic", Params: map[string]string{"realm": "testrealm@example.com"}},
+			},
+		},
+		{
+			"padded-data",
+			[]string{"SCRAM-SHA-256 sid=AAAABBBBCCCCDDDD, data=cj1yT3ByTkdmd0ViZVJXZ2JORWtxTyVodllEcFdVYTJSYVRDQWZ1eEZJbGopaE5sRiRrMCxzPVcyMlphSjBTTlk3c29Fc1VFamI2Z1E9PSxpPTQwOTY="},
+			[]httpauth.Challenge{
+				{Scheme: "SCRAM-SHA-256", Params: map[string]string{
+					"sid":  "AAAABBBBCCCCDDDD",
+					"data": "cj1yT3ByTkdmd0ViZVJXZ2JORWtxTyVodllEcFdVYTJSYVRDQWZ1eEZJbGopaE5sRiRrMCxzPVcyMlphSjBTTlk3c29Fc1VFamI2Z1E9PSxpPTQwOTY=",
+				}},
+			},
+		},
+		{
+			"authentication-info",
+			[]string{"sid=AAAABBBBCCCCDDDD, data=dj02cnJpVFJCaTIzV3BSUi93dHVwK21NaFVaVW4vZEI1bkxUSlJzamw5NUc0PQ=="},
+			[]httpauth.Challenge{
+				{Params: map[string]string{
+					"sid":  "AAAABBBBCCCCDDDD",
+					"data": "dj02cnJpVFJCaTIzV3BSUi93dHVwK21NaFVaVW4vZEI1bkxUSlJzamw5NUc0PQ==",
+				}},
+			},
+		},
+		{
+			"multiple-fields",
+			[]string{`SCRAM-SHA-1 realm="a \"quoted\" realm"`, "PLAIN"},
+			[]httpauth.Challenge{
+				{Scheme: "SCRAM-SHA-1", Params: map[string]string{"realm": `a "quoted" realm`}},
+				{Scheme: "PLAIN", Params: map[string]string{}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := httpauth.ParseChallenges(test.values)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %v, but got %v", test.expected, actual)
+			}
+
+			var formatted []string
+			for _, c := range actual {
+				formatted = append(formatted, c.String())
+			}
+			if reparsed := httpauth.ParseChallenges(formatted); !reflect.DeepEqual(reparsed, test.expected) {
+				t.Fatalf("expected formatted challenges %q to parse as %v, but got %v", formatted, test.expected, reparsed)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	storedUserProvider := func(hash *scramsha1.Hash) scramsha1.StoredUserProvider {
+		return func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+			_, storedKey, serverKey := hash.GenerateKeys("mcjack", []byte("blah"), 100)
+			return &scramsha1.StoredUser{
+				Salt:       []byte("blah"),
+				Iterations: 100,
+				StoredKey:  storedKey,
+				ServerKey:  serverKey,
+			}, nil
+		}
+	}
+
+	// using math/rand to make the nonces predictable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	authenticator := httpauth.NewAuthenticator("test@example.com", []string{scramsha256.MechName, scramsha1.MechName, plain.MechName}, func(mechName string) sasl.ServerMech {
+		switch mechName {
+		case plain.MechName:
+			return plain.NewServerMech(userPassVerifier, nil)
+		case scramsha1.MechName:
+			return scramsha1.NewServerMech(storedUserProvider(scramsha1.SHA1), nil, 16, mr)
+		case scramsha256.MechName:
+			return scramsha256.NewServerMech(storedUserProvider(scramsha1.SHA256), nil, 16, mr)
+		}
+		return nil
+	}, time.Minute)
+
+	server := httptest.NewServer(authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if httpauth.MechFromContext(r.Context()) == nil {
+			t.Errorf("expected the authenticating mechanism in the request context")
+		}
+		if result := httpauth.ResultFromContext(r.Context()); result == nil || result.AuthenticationID != "jack" {
+			t.Errorf("expected jack to be authenticated, but got %+v", result)
+		}
+		io.Copy(w, r.Body)
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	resp.Body.Close()
+	challenges := httpauth.ParseChallenges(resp.Header.Values(httpauth.HeaderWWWAuthenticate))
+	if len(challenges) != 3 || challenges[0].Scheme != scramsha256.MechName || challenges[0].Params["realm"] != "test@example.com" {
+		t.Fatalf("expected a %s challenge first, but got %v", scramsha256.MechName, challenges)
+	}
+
+	tests := []struct {
+		name     string
+		mechName string
+		password string
+		body     string
+		status   int
+	}{
+		{"plain", plain.MechName, "mcjack", "", http.StatusOK},
+		{"plain-wrong", plain.MechName, "wrong", "", http.StatusUnauthorized},
+		{"scram", scramsha1.MechName, "mcjack", "", http.StatusOK},
+		{"scram-body", scramsha1.MechName, "mcjack", "hello", http.StatusOK},
+		{"scram-wrong", scramsha1.MechName, "wrong", "", http.StatusUnauthorized},
+		{"scram-sha-256", scramsha256.MechName, "mcjack", "", http.StatusOK},
+		{"scram-sha-256-body", scramsha256.MechName, "mcjack", "hello", http.StatusOK},
+		{"scram-sha-256-wrong", scramsha256.MechName, "wrong", "", http.StatusUnauthorized},
+		{"unsupported", "GSSAPI", "mcjack", "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &http.Client{Transport: httpauth.NewTransport(nil, func(mechName string) sasl.ClientMech {
+				if mechName != test.mechName {
+					return nil
+				}
+				switch mechName {
+				case plain.MechName:
+					return plain.NewClientMech("", "jack", test.password)
+				case scramsha1.MechName:
+					return scramsha1.NewClientMech("", "jack", test.password, 16, mr)
+				case scramsha256.MechName:
+					return scramsha256.NewClientMech("", "jack", test.password, 16, mr)
+				}
+				return nil
+			})}
+
+			method := http.MethodGet
+			if test.body != "" {
+				method = http.MethodPost
+			}
+			req, err := http.NewRequest(method, server.URL, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("unable to create request: %v", err)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != test.status {
+				t.Fatalf("expected status %d, but got %d", test.status, resp.StatusCode)
+			}
+			if body, _ := io.ReadAll(resp.Body); resp.StatusCode == http.StatusOK && string(body) != test.body {
+				t.Fatalf("expected body %q, but got %q", test.body, body)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorRejectsReplayedSID(t *testing.T) {
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{Salt: []byte("blah"), Iterations: 100, StoredKey: storedKey, ServerKey: serverKey}, nil
+	}
+
+	// using math/rand to make the nonces predictable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	authenticator := httpauth.NewAuthenticator("test@example.com", []string{scramsha1.MechName}, func(mechName string) sasl.ServerMech {
+		return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+	}, time.Minute)
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(httpauth.HeaderAuthorization, authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// n,,n=jack,r=nonce
+	rec := serve("SCRAM-SHA-1 data=biwsbj1qYWNrLHI9bm9uY2U=")
+	challenges := httpauth.ParseChallenges(rec.Result().Header.Values(httpauth.HeaderWWWAuthenticate))
+	if rec.Code != http.StatusUnauthorized || len(challenges) != 1 || challenges[0].Params["sid"] == "" {
+		t.Fatalf("expected a challenge with a sid, but got %d %v", rec.Code, challenges)
+	}
+
+	sid := challenges[0].Params["sid"]
+	serve("SCRAM-SHA-1 sid=" + sid + ", data=Yz1iaXdzLHI9bm9uY2UscD1BQUFB")
+
+	rec = serve("SCRAM-SHA-1 sid=" + sid + ", data=Yz1iaXdzLHI9bm9uY2UscD1BQUFB")
+	challenges = httpauth.ParseChallenges(rec.Result().Header.Values(httpauth.HeaderWWWAuthenticate))
+	if rec.Code != http.StatusUnauthorized || len(challenges) != 1 || challenges[0].Params["realm"] != "test@example.com" {
+		t.Fatalf("expected a fresh challenge for a replayed sid, but got %d %v", rec.Code, challenges)
+	}
+}
+
+func TestAuthenticatorSealed(t *testing.T) {
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha256.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{Salt: []byte("blah"), Iterations: 100, StoredKey: storedKey, ServerKey: serverKey}, nil
+	}
+
+	// using math/rand to make the nonces predictable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	keys := sealing.NewKeyRing("1", map[string][]byte{"1": []byte("0123456789abcdef")})
+
+	// two processes sharing the sealing keys, serving requests in turn.
+	var handlers []http.Handler
+	for i := 0; i < 2; i++ {
+		authenticator := httpauth.NewAuthenticator("test@example.com", []string{scramsha256.MechName}, func(mechName string) sasl.ServerMech {
+			return scramsha256.NewServerMech(storedUserProvider, nil, 16, mr)
+		}, time.Minute)
+		authenticator.SetSealer(sealing.NewSealer(keys, time.Minute))
+		handlers = append(handlers, authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers[requests%2].ServeHTTP(w, r)
+		requests++
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: httpauth.NewTransport(nil, func(mechName string) sasl.ClientMech {
+		return scramsha256.NewClientMech("", "jack", "mcjack", 16, mr)
+	})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, resp.StatusCode)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, but got %d", requests)
+	}
+}
+
+func TestAuthenticatorRejectsReplayedSealedSID(t *testing.T) {
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{Salt: []byte("blah"), Iterations: 100, StoredKey: storedKey, ServerKey: serverKey}, nil
+	}
+
+	// using math/rand to make the nonces predictable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	keys := sealing.NewKeyRing("1", map[string][]byte{"1": []byte("0123456789abcdef")})
+	cache := httpauth.NewMemoryReplayCache()
+
+	// two processes sharing the sealing keys and the replay cache.
+	var handlers []http.Handler
+	for i := 0; i < 2; i++ {
+		authenticator := httpauth.NewAuthenticator("test@example.com", []string{scramsha1.MechName}, func(mechName string) sasl.ServerMech {
+			return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+		}, time.Minute)
+		authenticator.SetSealer(sealing.NewSealer(keys, time.Minute))
+		authenticator.SetReplayCache(cache)
+		handlers = append(handlers, authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	}
+
+	serve := func(handler http.Handler, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(httpauth.HeaderAuthorization, authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	client := scramsha1.NewClientMech("", "jack", "mcjack", 16, mr)
+	_, data, err := client.Start(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	rec := serve(handlers[0], "SCRAM-SHA-1 data="+base64.StdEncoding.EncodeToString(data))
+	challenges := httpauth.ParseChallenges(rec.Result().Header.Values(httpauth.HeaderWWWAuthenticate))
+	if rec.Code != http.StatusUnauthorized || len(challenges) != 1 || challenges[0].Params["sid"] == "" {
+		t.Fatalf("expected a challenge with a sid, but got %d %v", rec.Code, challenges)
+	}
+
+	sid := challenges[0].Params["sid"]
+	challenge, err := base64.StdEncoding.DecodeString(challenges[0].Params["data"])
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	data, err = client.Next(context.Background(), challenge)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	final := "SCRAM-SHA-1 sid=" + sid + ", data=" + base64.StdEncoding.EncodeToString(data)
+
+	if rec = serve(handlers[1], final); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, rec.Code)
+	}
+
+	for i, handler := range handlers {
+		rec = serve(handler, final)
+		challenges = httpauth.ParseChallenges(rec.Result().Header.Values(httpauth.HeaderWWWAuthenticate))
+		if rec.Code != http.StatusUnauthorized || len(challenges) != 1 || challenges[0].Params["realm"] != "test@example.com" {
+			t.Fatalf("expected a fresh challenge for a sealed sid replayed to process %d, but got %d %v", i, rec.Code, challenges)
+		}
+	}
+}
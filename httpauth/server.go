@@ -0,0 +1,310 @@
+package httpauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/sealing"
+)
+
+// sealedNonceLen is the length of the one-time nonce sealed along with the
+// state of an exchange.
+const sealedNonceLen = 16
+
+// ServerMechProvider returns a new server mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ServerMechProvider func(mechName string) sasl.ServerMech
+
+type mechKey struct{}
+
+type resultKey struct{}
+
+// MechFromContext returns the completed mechanism that authenticated the
+// request, or nil if there is none.
+func MechFromContext(ctx context.Context) sasl.ServerMech {
+	mech, _ := ctx.Value(mechKey{}).(sasl.ServerMech)
+	return mech
+}
+
+// ResultFromContext returns the result of the authentication of the request,
+// or nil if there is none.
+func ResultFromContext(ctx context.Context) *sasl.Result {
+	r, _ := ctx.Value(resultKey{}).(*sasl.Result)
+	return r
+}
+
+// NewAuthenticator creates an Authenticator offering the named mechanisms.
+// Exchanges not completed within exchangeTimeout are discarded.
+func NewAuthenticator(realm string, mechanisms []string, provider ServerMechProvider, exchangeTimeout time.Duration) *Authenticator {
+	return &Authenticator{
+		realm:           realm,
+		mechanisms:      mechanisms,
+		provider:        provider,
+		exchangeTimeout: exchangeTimeout,
+		replayCache:     NewMemoryReplayCache(),
+		exchanges:       make(map[string]*exchange),
+	}
+}
+
+// ReplayCache remembers the one-time nonces of the sealed sids that have been
+// used, so that each is only accepted once. Processes sharing sealing keys
+// must share the cache, e.g. through a database, for a sid replayed to
+// another process to be rejected.
+type ReplayCache interface {
+	// Consume marks nonce as used until expires and reports whether it
+	// already was.
+	Consume(ctx context.Context, nonce string, expires time.Time) (used bool, err error)
+}
+
+// NewMemoryReplayCache creates a ReplayCache kept in memory, which only
+// catches replays to the process holding it.
+func NewMemoryReplayCache() ReplayCache {
+	return &memoryReplayCache{nonces: make(map[string]time.Time)}
+}
+
+type memoryReplayCache struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func (c *memoryReplayCache) Consume(_ context.Context, nonce string, expires time.Time) (bool, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n, e := range c.nonces {
+		if now.After(e) {
+			delete(c.nonces, n)
+		}
+	}
+	if _, ok := c.nonces[nonce]; ok {
+		return true, nil
+	}
+	c.nonces[nonce] = expires
+	return false, nil
+}
+
+// Authenticator runs server mechanisms across requests. Each step of an
+// exchange arrives as a separate request, so the in-progress mechanism is
+// kept in memory under the sid handed to the client.
+type Authenticator struct {
+	realm           string
+	mechanisms      []string
+	provider        ServerMechProvider
+	exchangeTimeout time.Duration
+	sealer          *sealing.Sealer
+	replayCache     ReplayCache
+
+	mu        sync.Mutex
+	exchanges map[string]*exchange
+}
+
+type exchange struct {
+	mechName string
+	mech     sasl.ServerMech
+	expires  time.Time
+}
+
+// SetSealer makes the Authenticator hand the sealed state of exchanges using a
+// sasl.StatefulServerMech to the client as the sid instead of keeping them in
+// memory, so that each step can be served by a different process. Each sealed
+// sid carries a one-time nonce, recorded in the ReplayCache when the sid is
+// used, so that a replayed sid is rejected.
+func (a *Authenticator) SetSealer(sealer *sealing.Sealer) {
+	a.sealer = sealer
+}
+
+// SetReplayCache replaces the in-memory cache of used sealed sids, e.g. with
+// one shared by every process sharing the sealing keys.
+func (a *Authenticator) SetReplayCache(cache ReplayCache) {
+	a.replayCache = cache
+}
+
+// Middleware returns a handler that authenticates requests before passing
+// them to next. Unauthenticated requests are answered with 401 and a
+// challenge for each mechanism. The authenticating mechanism is available to
+// next through MechFromContext and ResultFromContext.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credentials := ParseChallenges(r.Header.Values(HeaderAuthorization))
+		if len(credentials) == 0 || !a.supports(credentials[0].Scheme) {
+			a.challenge(w)
+			return
+		}
+
+		mechName := credentials[0].Scheme
+		sid := credentials[0].Params["sid"]
+		response, err := decodeData(credentials[0].Params["data"])
+		if err != nil {
+			a.challenge(w)
+			return
+		}
+
+		var mech sasl.ServerMech
+		var challenge []byte
+		if sid != "" {
+			if mech = a.resume(r.Context(), mechName, sid); mech == nil {
+				a.challenge(w)
+				return
+			}
+			challenge, err = mech.Next(r.Context(), response)
+		} else {
+			if mech = a.provider(mechName); mech == nil {
+				a.challenge(w)
+				return
+			}
+			_, challenge, err = mech.Start(r.Context(), response)
+		}
+
+		if err != nil {
+			a.challenge(w)
+			return
+		}
+
+		if !mech.Completed() {
+			if sid, err = a.suspend(mechName, sid, mech); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			c := Challenge{Scheme: mechName, Params: map[string]string{"sid": sid, "data": encodeData(challenge)}}
+			w.Header().Set(HeaderWWWAuthenticate, c.String())
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		info := Challenge{Params: map[string]string{}}
+		if sid != "" {
+			info.Params["sid"] = sid
+		}
+		if len(challenge) > 0 {
+			info.Params["data"] = encodeData(challenge)
+		}
+		if len(info.Params) > 0 {
+			w.Header().Set(HeaderAuthenticationInfo, info.String())
+		}
+
+		ctx := context.WithValue(r.Context(), mechKey{}, mech)
+		ctx = context.WithValue(ctx, resultKey{}, sasl.ResultOf(mech, mechName))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// suspend keeps an exchange in progress until the client's next request and
+// returns the sid identifying it.
+func (a *Authenticator) suspend(mechName, sid string, mech sasl.ServerMech) (string, error) {
+	if stateful, ok := mech.(sasl.StatefulServerMech); ok && a.sealer != nil {
+		state, err := stateful.MarshalState()
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, sealedNonceLen)
+		if _, err = rand.Read(nonce); err != nil {
+			return "", err
+		}
+		sealed, err := a.sealer.Seal(append(nonce, state...), []byte(mechName))
+		if err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(sealed), nil
+	}
+
+	if sid == "" {
+		var err error
+		if sid, err = newSID(); err != nil {
+			return "", err
+		}
+	}
+	a.put(sid, &exchange{mechName: mechName, mech: mech})
+	return sid, nil
+}
+
+// resume returns the exchange identified by sid, or nil if there is none or
+// a sealed sid has already been used.
+func (a *Authenticator) resume(ctx context.Context, mechName, sid string) sasl.ServerMech {
+	if a.sealer != nil {
+		if sealed, err := base64.RawURLEncoding.DecodeString(sid); err == nil {
+			if state, err := a.sealer.Open(sealed, []byte(mechName)); err == nil {
+				if len(state) < sealedNonceLen {
+					return nil
+				}
+				nonce := base64.RawURLEncoding.EncodeToString(state[:sealedNonceLen])
+				used, err := a.replayCache.Consume(ctx, nonce, time.Now().Add(a.sealer.Lifetime()))
+				if err != nil || used {
+					return nil
+				}
+
+				stateful, ok := a.provider(mechName).(sasl.StatefulServerMech)
+				if !ok || stateful.UnmarshalState(state[sealedNonceLen:]) != nil {
+					return nil
+				}
+				return stateful
+			}
+		}
+	}
+
+	x := a.take(sid)
+	if x == nil || x.mechName != mechName {
+		return nil
+	}
+	return x.mech
+}
+
+// challenge answers with 401 and a challenge for each mechanism.
+func (a *Authenticator) challenge(w http.ResponseWriter) {
+	for _, name := range a.mechanisms {
+		c := Challenge{Scheme: name, Params: map[string]string{"realm": a.realm}}
+		w.Header().Add(HeaderWWWAuthenticate, c.String())
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (a *Authenticator) supports(mechName string) bool {
+	for _, name := range a.mechanisms {
+		if name == mechName {
+			return true
+		}
+	}
+	return false
+}
+
+// put stores an in-progress exchange, discarding any that have expired.
+func (a *Authenticator) put(sid string, x *exchange) {
+	now := time.Now()
+	x.expires = now.Add(a.exchangeTimeout)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, other := range a.exchanges {
+		if now.After(other.expires) {
+			delete(a.exchanges, id)
+		}
+	}
+	a.exchanges[sid] = x
+}
+
+// take removes and returns an in-progress exchange. Each step may only be
+// answered once, so a replayed request finds no exchange.
+func (a *Authenticator) take(sid string) *exchange {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	x := a.exchanges[sid]
+	delete(a.exchanges, sid)
+	if x == nil || time.Now().After(x.expires) {
+		return nil
+	}
+	return x
+}
+
+func newSID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,97 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Authenticate conducts an AUTHENTICATE command as a client using the given
+// tag. When initialResponse is true, the first response is sent along with the
+// command as permitted by the SASL-IR capability. Untagged responses received
+// during the exchange are ignored.
+func Authenticate(ctx context.Context, rw *bufio.ReadWriter, tag string, mech sasl.ClientMech, initialResponse bool) error {
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("imap: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	cmd := tag + " AUTHENTICATE " + mechName
+	pending := true
+	if initialResponse {
+		cmd += " " + encodeInitialResponse(response)
+		pending = false
+	}
+	if err = writeLine(rw.Writer, cmd); err != nil {
+		return err
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		line, err := readLine(rw.Reader)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			if pending {
+				pending = false
+			} else {
+				challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line[1:]))
+				if err != nil {
+					return cancel(rw, tag, fmt.Errorf("imap: invalid challenge encoding: %v", err))
+				}
+
+				response, err = mech.Next(ctx, challenge)
+				if err != nil {
+					return cancel(rw, tag, fmt.Errorf("imap: sasl mechanism %s: client failed to provide response: %v", mechName, err))
+				}
+			}
+
+			if err = writeLine(rw.Writer, base64.StdEncoding.EncodeToString(response)); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, tag+" "):
+			status, text := splitStatus(line[len(tag)+1:])
+			if status != "OK" {
+				return &StatusError{Status: status, Text: text}
+			}
+			if !mech.Completed() {
+				return fmt.Errorf("imap: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return nil
+		}
+	}
+}
+
+// cancel aborts the exchange and waits for the server's tagged response before
+// returning err.
+func cancel(rw *bufio.ReadWriter, tag string, err error) error {
+	if werr := writeLine(rw.Writer, "*"); werr != nil {
+		return err
+	}
+
+	for {
+		line, rerr := readLine(rw.Reader)
+		if rerr != nil || strings.HasPrefix(line, tag+" ") {
+			return err
+		}
+	}
+}
+
+func splitStatus(s string) (string, string) {
+	parts := strings.SplitN(s, " ", 2)
+	status := strings.ToUpper(parts[0])
+	if len(parts) == 1 {
+		return status, ""
+	}
+	return status, parts[1]
+}
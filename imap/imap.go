@@ -0,0 +1,70 @@
+// Package imap runs SASL mechanisms over the IMAP AUTHENTICATE command as
+// defined by RFC3501 (https://tools.ietf.org/html/rfc3501#section-6.2.2),
+// including the initial response extension from
+// RFC4959 (https://tools.ietf.org/html/rfc4959).
+package imap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// ErrCanceled is returned by Serve when the client cancels the exchange.
+var ErrCanceled = errors.New("imap: authentication canceled by client")
+
+// StatusError is returned by Authenticate when the server completes the
+// command with a tagged NO or BAD response.
+type StatusError struct {
+	Status string
+	Text   string
+}
+
+func (e *StatusError) Error() string {
+	return "imap: server responded " + e.Status + " " + e.Text
+}
+
+// ParseAuthenticate splits an AUTHENTICATE command line into its tag,
+// mechanism name and optional initial response argument.
+func ParseAuthenticate(line string) (tag, mechName, initialResponse string, ok bool) {
+	fields := strings.Fields(strings.TrimRight(line, "\r\n"))
+	if len(fields) < 3 || len(fields) > 4 || !strings.EqualFold(fields[1], "AUTHENTICATE") {
+		return "", "", "", false
+	}
+
+	tag, mechName = fields[0], strings.ToUpper(fields[2])
+	if len(fields) == 4 {
+		initialResponse = fields[3]
+	}
+	return tag, mechName, initialResponse, true
+}
+
+func encodeInitialResponse(b []byte) string {
+	if len(b) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeInitialResponse(s string) ([]byte, error) {
+	if s == "=" {
+		return []byte{}, nil
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeLine(w *bufio.Writer, line string) error {
+	if _, err := w.WriteString(line + "\r\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,131 @@
+package imap_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/imap"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+func TestAuthenticate(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{
+			Salt:       []byte("blah"),
+			Iterations: 100,
+			StoredKey:  storedKey,
+			ServerKey:  serverKey,
+		}, nil
+	}
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		name            string
+		client          sasl.ClientMech
+		server          sasl.ServerMech
+		initialResponse bool
+		clientErr       string
+		serverErr       string
+	}{
+		{"plain", plain.NewClientMech("", "jack", "mcjack"), plain.NewServerMech(userPassVerifier, nil), false, "", ""},
+		{"plain-ir", plain.NewClientMech("", "jack", "mcjack"), plain.NewServerMech(userPassVerifier, nil), true, "", ""},
+		{"plain-wrong", plain.NewClientMech("", "jack", "wrong"), plain.NewServerMech(userPassVerifier, nil), true,
+			"imap: server responded NO [AUTHENTICATIONFAILED] Authentication failed",
+			"imap: sasl mechanism PLAIN: invalid username or password"},
+		{"scram", scramsha1.NewClientMech("", "jack", "mcjack", 16, mr), scramsha1.NewServerMech(storedUserProvider, nil, 16, mr), false, "", ""},
+		{"scram-ir", scramsha1.NewClientMech("", "jack", "mcjack", 16, mr), scramsha1.NewServerMech(storedUserProvider, nil, 16, mr), true, "", ""},
+		{"scram-wrong", scramsha1.NewClientMech("", "jack", "wrong", 16, mr), scramsha1.NewServerMech(storedUserProvider, nil, 16, mr), true,
+			"imap: server responded NO [AUTHENTICATIONFAILED] Authentication failed",
+			"imap: sasl mechanism SCRAM-SHA-1: invalid response: client key mismatch"},
+		{"canceled", &testhelpers.FailingClientMech{}, &testhelpers.ChallengingServerMech{}, false,
+			"imap: sasl mechanism FAIL: client failed to provide response: no credentials",
+			"imap: authentication canceled by client"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientErr, serverErr := runAuthenticate(test.client, test.server, test.initialResponse)
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, serverErr)
+		})
+	}
+}
+
+func TestParseAuthenticate(t *testing.T) {
+	tests := []struct {
+		line            string
+		tag             string
+		mechName        string
+		initialResponse string
+		ok              bool
+	}{
+		{"a1 AUTHENTICATE PLAIN\r\n", "a1", "PLAIN", "", true},
+		{"a2 authenticate scram-sha-1 =", "a2", "SCRAM-SHA-1", "=", true},
+		{"a3 AUTHENTICATE PLAIN AGphY2sAbWNqYWNr", "a3", "PLAIN", "AGphY2sAbWNqYWNr", true},
+		{"a4 LOGIN jack mcjack", "", "", "", false},
+		{"a5 AUTHENTICATE", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			tag, mechName, ir, ok := imap.ParseAuthenticate(test.line)
+			if tag != test.tag || mechName != test.mechName || ir != test.initialResponse || ok != test.ok {
+				t.Fatalf("expected (%q, %q, %q, %v), but got (%q, %q, %q, %v)",
+					test.tag, test.mechName, test.initialResponse, test.ok, tag, mechName, ir, ok)
+			}
+		})
+	}
+}
+
+// runAuthenticate runs the client against an in-memory IMAP server that only
+// understands the AUTHENTICATE command.
+func runAuthenticate(client sasl.ClientMech, server sasl.ServerMech, initialResponse bool) (error, error) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		rw := bufio.NewReadWriter(bufio.NewReader(serverConn), bufio.NewWriter(serverConn))
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			serverErr <- err
+			return
+		}
+
+		tag, _, ir, ok := imap.ParseAuthenticate(line)
+		if !ok {
+			serverErr <- fmt.Errorf("unexpected command %q", strings.TrimSpace(line))
+			return
+		}
+
+		// interleave an untagged response to make sure the client skips it.
+		rw.WriteString("* OK still here\r\n")
+		serverErr <- imap.Serve(context.Background(), rw, tag, server, ir)
+	}()
+
+	rw := bufio.NewReadWriter(bufio.NewReader(clientConn), bufio.NewWriter(clientConn))
+	clientErr := imap.Authenticate(context.Background(), rw, "a1", client, initialResponse)
+
+	return clientErr, <-serverErr
+}
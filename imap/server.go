@@ -0,0 +1,73 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Serve conducts the remainder of an AUTHENTICATE command as a server. The
+// caller's command loop has already read the command line, typically with
+// ParseAuthenticate, and passes the tag and the raw initial response argument,
+// which is empty when the client did not send one. Serve writes the tagged
+// completion response in every case.
+func Serve(ctx context.Context, rw *bufio.ReadWriter, tag string, mech sasl.ServerMech, initialResponse string) error {
+	var response []byte
+	if initialResponse != "" {
+		var err error
+		response, err = decodeInitialResponse(initialResponse)
+		if err != nil {
+			writeLine(rw.Writer, tag+" BAD Invalid initial response encoding")
+			return fmt.Errorf("imap: invalid initial response encoding: %v", err)
+		}
+	}
+
+	mechName, challenge, err := mech.Start(ctx, response)
+	for {
+		if err != nil {
+			writeLine(rw.Writer, tag+" NO [AUTHENTICATIONFAILED] Authentication failed")
+			return fmt.Errorf("imap: sasl mechanism %s: %v", mechName, err)
+		}
+
+		if mech.Completed() && len(challenge) == 0 {
+			break
+		}
+
+		if err = writeLine(rw.Writer, "+ "+base64.StdEncoding.EncodeToString(challenge)); err != nil {
+			return err
+		}
+
+		var line string
+		if line, err = readLine(rw.Reader); err != nil {
+			return err
+		}
+
+		if line == "*" {
+			writeLine(rw.Writer, tag+" BAD Authentication canceled")
+			return ErrCanceled
+		}
+
+		response, err = base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			writeLine(rw.Writer, tag+" BAD Invalid response encoding")
+			return fmt.Errorf("imap: invalid response encoding: %v", err)
+		}
+
+		if mech.Completed() {
+			// the final challenge carried additional data; the client
+			// acknowledges it with an empty response.
+			if len(response) != 0 {
+				writeLine(rw.Writer, tag+" BAD Unexpected response")
+				return fmt.Errorf("imap: unexpected response after exchange completed")
+			}
+			break
+		}
+
+		challenge, err = mech.Next(ctx, response)
+	}
+
+	return writeLine(rw.Writer, tag+" OK Authentication successful")
+}
@@ -0,0 +1,49 @@
+// Package pbkdf2 implements PBKDF2 as defined by RFC8018
+// (https://tools.ietf.org/html/rfc8018#section-5.2), and the Hi function
+// SCRAM builds on it (https://tools.ietf.org/html/rfc5802#section-2.2).
+package pbkdf2
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"hash"
+)
+
+// Key derives a key of keyLen bytes from the password and salt using iter
+// iterations of HMAC with the hash function h. Apart from the result, it
+// allocates only the HMAC state and a single block sized buffer.
+func Key(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var blockIndex [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		// U_1 = PRF(password, salt || INT(block))
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(blockIndex[:], uint32(block))
+		prf.Write(blockIndex[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		// T = U_1 ^ U_2 ^ ... ^ U_iter
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
+
+// Hi is PBKDF2 producing a single block, as used by SCRAM to salt passwords.
+func Hi(h func() hash.Hash, password, salt []byte, iter int) []byte {
+	return Key(password, salt, iter, h().Size(), h)
+}
@@ -0,0 +1,56 @@
+package pbkdf2_test
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl/internal/pbkdf2"
+)
+
+var vectors = []struct {
+	name     string
+	h        func() hash.Hash
+	password string
+	salt     string
+	iter     int
+	expected string
+}{
+	// RFC6070, omitting the 16777216 iteration vector for the sake of time.
+	{"rfc6070-1", sha1.New, "password", "salt", 1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+	{"rfc6070-2", sha1.New, "password", "salt", 2, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+	{"rfc6070-3", sha1.New, "password", "salt", 4096, "4b007901b765489abead49d926f721d065a429c1"},
+	{"rfc6070-5", sha1.New, "passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+	{"rfc6070-6", sha1.New, "pass\x00word", "sa\x00lt", 4096, "56fa6aa75548099dcc37d7f03425e0c3"},
+	// RFC7914 section 11.
+	{"rfc7914-1", sha256.New, "passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+	{"rfc7914-2", sha256.New, "Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+}
+
+func TestKey(t *testing.T) {
+	for _, test := range vectors {
+		t.Run(test.name, func(t *testing.T) {
+			expected, _ := hex.DecodeString(test.expected)
+			actual := pbkdf2.Key([]byte(test.password), []byte(test.salt), test.iter, len(expected), test.h)
+			if hex.EncodeToString(actual) != test.expected {
+				t.Fatalf("expected %s, but got %x", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHi(t *testing.T) {
+	actual := pbkdf2.Hi(sha1.New, []byte("password"), []byte("salt"), 4096)
+	if hex.EncodeToString(actual) != "4b007901b765489abead49d926f721d065a429c1" {
+		t.Fatalf("expected 4b007901b765489abead49d926f721d065a429c1, but got %x", actual)
+	}
+}
+
+func BenchmarkKey(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pbkdf2.Key([]byte("password"), []byte("salt"), 4096, 32, sha256.New)
+	}
+}
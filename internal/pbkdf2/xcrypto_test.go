@@ -0,0 +1,38 @@
+//go:build xcrypto
+
+// The comparison with golang.org/x/crypto/pbkdf2 is only built with the
+// xcrypto tag so that the module does not depend on it:
+//
+//	go test -tags xcrypto -bench . ./internal/pbkdf2
+
+package pbkdf2_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	local "github.com/craiggwilson/go-sasl/internal/pbkdf2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestKeyMatchesXCrypto(t *testing.T) {
+	for _, test := range vectors {
+		t.Run(test.name, func(t *testing.T) {
+			for _, keyLen := range []int{1, 20, 32, 33, 64, 100} {
+				expected := pbkdf2.Key([]byte(test.password), []byte(test.salt), test.iter, keyLen, test.h)
+				actual := local.Key([]byte(test.password), []byte(test.salt), test.iter, keyLen, test.h)
+				if !bytes.Equal(actual, expected) {
+					t.Fatalf("expected %x for a key of %d bytes, but got %x", expected, keyLen, actual)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkKeyXCrypto(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pbkdf2.Key([]byte("password"), []byte("salt"), 4096, 32, sha256.New)
+	}
+}
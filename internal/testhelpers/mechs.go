@@ -0,0 +1,46 @@
+package testhelpers
+
+import (
+	"context"
+	"errors"
+)
+
+// FailingClientMech sends an initial response and then fails on the first
+// challenge. It is used to exercise client side cancellation.
+type FailingClientMech struct{}
+
+// Start initializes the mechanism and begins the authentication exchange.
+func (m *FailingClientMech) Start(_ context.Context) (string, []byte, error) {
+	return "FAIL", []byte("hello"), nil
+}
+
+// Next continues the exchange.
+func (m *FailingClientMech) Next(_ context.Context, _ []byte) ([]byte, error) {
+	return nil, errors.New("no credentials")
+}
+
+// Completed indicates if the authentication exchange is complete from
+// the client's perspective.
+func (m *FailingClientMech) Completed() bool {
+	return false
+}
+
+// ChallengingServerMech answers every response with another challenge and
+// never completes.
+type ChallengingServerMech struct{}
+
+// Start initializes the mechanism and begins the authentication exchange.
+func (m *ChallengingServerMech) Start(_ context.Context, _ []byte) (string, []byte, error) {
+	return "FAIL", []byte("more"), nil
+}
+
+// Next continues the exchange.
+func (m *ChallengingServerMech) Next(_ context.Context, _ []byte) ([]byte, error) {
+	return []byte("more"), nil
+}
+
+// Completed indicates if the authentication exchange is complete from
+// the server's perspective.
+func (m *ChallengingServerMech) Completed() bool {
+	return false
+}
@@ -10,8 +10,8 @@ import (
 // RunClientServerTest executes the client and the server together.
 func RunClientServerTest(t *testing.T, client sasl.ClientMech, server sasl.ServerMech, expectedClientErr, expectedServerErr string) {
 	clientErr, serverErr := runConversation(client, server)
-	verifyError(t, "client", expectedClientErr, clientErr)
-	verifyError(t, "server", expectedServerErr, serverErr)
+	VerifyError(t, "client", expectedClientErr, clientErr)
+	VerifyError(t, "server", expectedServerErr, serverErr)
 }
 
 func runConversation(client sasl.ClientMech, server sasl.ServerMech) (error, error) {
@@ -52,7 +52,9 @@ func runConversation(client sasl.ClientMech, server sasl.ServerMech) (error, err
 	return cerr, serr
 }
 
-func verifyError(t *testing.T, errKind string, expected string, actual error) {
+// VerifyError fails the test when actual does not match the expected error
+// message. An empty expected message means no error is expected.
+func VerifyError(t *testing.T, errKind string, expected string, actual error) {
 	if expected != "" {
 		if actual == nil {
 			t.Fatalf("expected a %s error, but got none", errKind)
@@ -0,0 +1,135 @@
+package ircv3
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// RequestSASL sends CAP REQ :sasl and waits for the server to acknowledge or
+// refuse the capability. Other messages received in the meantime are ignored,
+// apart from PING which is answered.
+func RequestSASL(ctx context.Context, rw *bufio.ReadWriter) error {
+	if err := writeLine(rw.Writer, "CAP REQ :sasl"); err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		msg, err := readMessage(rw.Reader)
+		if err != nil {
+			return err
+		}
+
+		switch msg.Command {
+		case "PING":
+			if err = writeLine(rw.Writer, (&Message{Command: "PONG", Params: msg.Params}).String()); err != nil {
+				return err
+			}
+		case "CAP":
+			switch strings.ToUpper(msg.param(1)) {
+			case "ACK":
+				return nil
+			case "NAK":
+				return fmt.Errorf("ircv3: server refused the sasl capability")
+			}
+		}
+	}
+}
+
+// Authenticate conducts SASL authentication as a client once the sasl
+// capability has been acknowledged, and returns the account name announced
+// by the server. The caller sends CAP END afterwards to finish registration.
+func Authenticate(ctx context.Context, rw *bufio.ReadWriter, mech sasl.ClientMech) (string, error) {
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return "", fmt.Errorf("ircv3: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	if err = writeLine(rw.Writer, "AUTHENTICATE "+mechName); err != nil {
+		return "", err
+	}
+
+	var account string
+	var mechanisms []string
+	var a assembler
+	pending := response != nil
+	for {
+		if err = ctx.Err(); err != nil {
+			return "", err
+		}
+
+		msg, err := readMessage(rw.Reader)
+		if err != nil {
+			return "", err
+		}
+
+		switch msg.Command {
+		case "PING":
+			if err = writeLine(rw.Writer, (&Message{Command: "PONG", Params: msg.Params}).String()); err != nil {
+				return "", err
+			}
+		case "AUTHENTICATE":
+			done, err := a.add(msg.param(0))
+			if err != nil {
+				return "", abort(rw, err)
+			}
+			if !done {
+				continue
+			}
+
+			challenge, err := a.payload()
+			if err != nil {
+				return "", abort(rw, fmt.Errorf("ircv3: invalid challenge encoding: %v", err))
+			}
+
+			if pending {
+				// the server's first, empty challenge is answered with the
+				// mechanism's initial response.
+				pending = false
+			} else if response, err = mech.Next(ctx, challenge); err != nil {
+				return "", abort(rw, fmt.Errorf("ircv3: sasl mechanism %s: client failed to provide response: %v", mechName, err))
+			}
+
+			if err = writePayload(rw.Writer, response); err != nil {
+				return "", err
+			}
+		case NumericLoggedIn:
+			account = msg.param(2)
+		case NumericSASLMechs:
+			mechanisms = strings.Split(msg.param(1), ",")
+		case NumericSASLSuccess:
+			if !mech.Completed() {
+				return "", fmt.Errorf("ircv3: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return account, nil
+		case NumericNickLocked, NumericSASLFail, NumericSASLTooLong, NumericSASLAborted, NumericSASLAlready:
+			return "", &NumericError{Numeric: msg.Command, Text: msg.param(len(msg.Params) - 1), Mechanisms: mechanisms}
+		}
+	}
+}
+
+// abort cancels the exchange and waits for the server to confirm before
+// returning err.
+func abort(rw *bufio.ReadWriter, err error) error {
+	if werr := writeLine(rw.Writer, "AUTHENTICATE *"); werr != nil {
+		return err
+	}
+
+	for {
+		msg, rerr := readMessage(rw.Reader)
+		if rerr != nil {
+			return err
+		}
+		switch msg.Command {
+		case NumericSASLAborted, NumericSASLFail:
+			return err
+		}
+	}
+}
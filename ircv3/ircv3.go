@@ -0,0 +1,186 @@
+// Package ircv3 runs SASL mechanisms over IRC using the IRCv3 sasl capability
+// and the AUTHENTICATE command (https://ircv3.net/specs/extensions/sasl-3.1).
+package ircv3
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Numeric replies used during authentication.
+const (
+	NumericLoggedIn    = "900"
+	NumericLoggedOut   = "901"
+	NumericNickLocked  = "902"
+	NumericSASLSuccess = "903"
+	NumericSASLFail    = "904"
+	NumericSASLTooLong = "905"
+	NumericSASLAborted = "906"
+	NumericSASLAlready = "907"
+	NumericSASLMechs   = "908"
+)
+
+// chunkSize is the maximum length of the base64 payload carried by a single
+// AUTHENTICATE message. Longer payloads are split and a payload whose last
+// chunk is exactly chunkSize long is terminated by "AUTHENTICATE +".
+const chunkSize = 400
+
+// maxPayloadLen bounds the size of an encoded payload accepted from the peer.
+const maxPayloadLen = 64 * 1024
+
+// ErrAborted is returned by Serve when the client aborts the exchange.
+var ErrAborted = errors.New("ircv3: authentication aborted by client")
+
+var errTooLong = errors.New("ircv3: sasl message too long")
+
+// NumericError is returned by Authenticate when the server ends the exchange
+// with an error numeric.
+type NumericError struct {
+	Numeric string
+	Text    string
+	// Mechanisms holds the mechanisms listed by the server in an
+	// RPL_SASLMECHS reply, if one was sent.
+	Mechanisms []string
+}
+
+func (e *NumericError) Error() string {
+	return "ircv3: server responded " + e.Numeric + " " + e.Text
+}
+
+// Message is a single IRC protocol message. Message tags are discarded.
+type Message struct {
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// ParseMessage parses a single line into a Message.
+func ParseMessage(line string) (*Message, error) {
+	line = strings.TrimRight(line, "\r\n")
+	raw := line
+	if strings.HasPrefix(line, "@") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("ircv3: invalid message %q", raw)
+		}
+		line = strings.TrimLeft(line[i+1:], " ")
+	}
+
+	m := &Message{}
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("ircv3: invalid message %q", raw)
+		}
+		m.Prefix, line = line[1:i], strings.TrimLeft(line[i+1:], " ")
+	}
+
+	for line != "" {
+		if strings.HasPrefix(line, ":") && m.Command != "" {
+			m.Params = append(m.Params, line[1:])
+			break
+		}
+
+		var field string
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			field, line = line[:i], strings.TrimLeft(line[i+1:], " ")
+		} else {
+			field, line = line, ""
+		}
+
+		if m.Command == "" {
+			m.Command = strings.ToUpper(field)
+		} else {
+			m.Params = append(m.Params, field)
+		}
+	}
+
+	if m.Command == "" {
+		return nil, fmt.Errorf("ircv3: invalid message %q", raw)
+	}
+	return m, nil
+}
+
+// String formats the message as a line without the trailing CRLF.
+func (m *Message) String() string {
+	var b strings.Builder
+	if m.Prefix != "" {
+		b.WriteString(":" + m.Prefix + " ")
+	}
+	b.WriteString(m.Command)
+	for i, p := range m.Params {
+		b.WriteByte(' ')
+		if i == len(m.Params)-1 && (p == "" || p[0] == ':' || strings.Contains(p, " ")) {
+			b.WriteByte(':')
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// param returns the i'th parameter, or an empty string if there are fewer.
+func (m *Message) param(i int) string {
+	if i < len(m.Params) {
+		return m.Params[i]
+	}
+	return ""
+}
+
+// assembler collects the chunks of an AUTHENTICATE payload.
+type assembler struct {
+	buf []byte
+}
+
+// add appends a chunk and reports whether the payload is complete.
+func (a *assembler) add(chunk string) (bool, error) {
+	if chunk == "+" {
+		return true, nil
+	}
+	if len(chunk) > chunkSize || len(a.buf)+len(chunk) > maxPayloadLen {
+		a.buf = nil
+		return false, errTooLong
+	}
+	a.buf = append(a.buf, chunk...)
+	return len(chunk) < chunkSize, nil
+}
+
+// payload decodes and resets the collected payload.
+func (a *assembler) payload() ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(string(a.buf))
+	a.buf = nil
+	return b, err
+}
+
+// writePayload sends data as one or more AUTHENTICATE messages.
+func writePayload(w *bufio.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) >= chunkSize {
+		if _, err := w.WriteString("AUTHENTICATE " + encoded[:chunkSize] + "\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[chunkSize:]
+	}
+
+	if encoded == "" {
+		encoded = "+"
+	}
+	return writeLine(w, "AUTHENTICATE "+encoded)
+}
+
+func readMessage(r *bufio.Reader) (*Message, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	return ParseMessage(line)
+}
+
+func writeLine(w *bufio.Writer, line string) error {
+	if _, err := w.WriteString(line + "\r\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
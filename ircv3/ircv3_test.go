@@ -0,0 +1,234 @@
+package ircv3_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/ircv3"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected ircv3.Message
+	}{
+		{"AUTHENTICATE +\r\n", ircv3.Message{Command: "AUTHENTICATE", Params: []string{"+"}}},
+		{":irc.example.com 903 jack :SASL authentication successful", ircv3.Message{Prefix: "irc.example.com", Command: "903", Params: []string{"jack", "SASL authentication successful"}}},
+		{"@time=2020-01-01T00:00:00Z :irc.example.com CAP * ACK :sasl", ircv3.Message{Prefix: "irc.example.com", Command: "CAP", Params: []string{"*", "ACK", "sasl"}}},
+		{"cap req :sasl", ircv3.Message{Command: "CAP", Params: []string{"req", "sasl"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			msg, err := ircv3.ParseMessage(test.line)
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+			if !reflect.DeepEqual(*msg, test.expected) {
+				t.Fatalf("expected %#v, but got %#v", test.expected, *msg)
+			}
+		})
+	}
+}
+
+func TestCap(t *testing.T) {
+	server := ircv3.NewServer("irc.example.com", []string{"SCRAM-SHA-1", "PLAIN"}, nil, nil)
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"CAP LS", ":irc.example.com CAP * LS sasl\r\n"},
+		{"CAP LS 302", ":irc.example.com CAP * LS sasl=SCRAM-SHA-1,PLAIN\r\n"},
+		{"CAP REQ :sasl", ":irc.example.com CAP * ACK sasl\r\n"},
+		{"CAP REQ :sasl multi-prefix", ":irc.example.com CAP * NAK :sasl multi-prefix\r\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			msg, err := ircv3.ParseMessage(test.line)
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+
+			var b bytes.Buffer
+			if err = server.Cap(bufio.NewWriter(&b), "*", msg); err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+			if b.String() != test.expected {
+				t.Fatalf("expected %q, but got %q", test.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{
+			Salt:       []byte("blah"),
+			Iterations: 100,
+			StoredKey:  storedKey,
+			ServerKey:  serverKey,
+		}, nil
+	}
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	provider := func(mechName string) sasl.ServerMech {
+		switch mechName {
+		case plain.MechName:
+			return plain.NewServerMech(userPassVerifier, nil)
+		case scramsha1.MechName:
+			return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+		case "FAIL":
+			return &testhelpers.ChallengingServerMech{}
+		}
+		return &sizeServerMech{}
+	}
+
+	tests := []struct {
+		name      string
+		mech      sasl.ClientMech
+		clientErr string
+		serverErr string
+	}{
+		{"plain", plain.NewClientMech("", "jack", "mcjack"), "", ""},
+		{"plain-wrong", plain.NewClientMech("", "jack", "wrong"),
+			"ircv3: server responded 904 SASL authentication failed",
+			"ircv3: sasl mechanism PLAIN: invalid username or password"},
+		{"scram", scramsha1.NewClientMech("", "jack", "mcjack", 16, mr), "", ""},
+		{"scram-wrong", scramsha1.NewClientMech("", "jack", "wrong", 16, mr),
+			"ircv3: server responded 904 SASL authentication failed",
+			"ircv3: sasl mechanism SCRAM-SHA-1: invalid response: client key mismatch"},
+		{"aborted", &testhelpers.FailingClientMech{},
+			"ircv3: sasl mechanism FAIL: client failed to provide response: no credentials",
+			"ircv3: authentication aborted by client"},
+		{"unsupported", plain.NewClientMech("", "jack", "mcjack"),
+			"ircv3: server responded 904 SASL authentication failed",
+			"ircv3: sasl mechanism PLAIN is not supported"},
+		{"chunked-empty", &sizeClientMech{0}, "", ""},
+		{"chunked-short", &sizeClientMech{299}, "", ""},
+		{"chunked-exact", &sizeClientMech{300}, "", ""},
+		{"chunked-long", &sizeClientMech{1000}, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+
+			mechanisms := []string{scramsha1.MechName, plain.MechName, "FAIL", "SIZE"}
+			if test.name == "unsupported" {
+				mechanisms = []string{scramsha1.MechName}
+			}
+			server := ircv3.NewServer("irc.example.com", mechanisms, provider, func(sasl.ServerMech) string {
+				return "jack"
+			})
+
+			serverErr := make(chan error, 1)
+			go func() {
+				defer serverConn.Close()
+				rw := bufio.NewReadWriter(bufio.NewReader(serverConn), bufio.NewWriter(serverConn))
+
+				msg, err := ircv3.ParseMessage(readLine(rw.Reader))
+				if err == nil {
+					err = server.Cap(rw.Writer, "*", msg)
+				}
+				if err == nil {
+					msg, err = ircv3.ParseMessage(readLine(rw.Reader))
+				}
+				if err == nil {
+					_, err = server.Authenticate(context.Background(), rw, "*", "jack!jack@localhost", msg)
+				}
+				serverErr <- err
+			}()
+
+			rw := bufio.NewReadWriter(bufio.NewReader(clientConn), bufio.NewWriter(clientConn))
+			clientErr := ircv3.RequestSASL(context.Background(), rw)
+			var account string
+			if clientErr == nil {
+				account, clientErr = ircv3.Authenticate(context.Background(), rw, test.mech)
+			}
+			clientConn.Close()
+
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, <-serverErr)
+
+			if clientErr == nil && account != "jack" {
+				t.Fatalf("expected account jack, but got %q", account)
+			}
+
+			var numErr *ircv3.NumericError
+			if test.name == "unsupported" && (!errors.As(clientErr, &numErr) || !reflect.DeepEqual(numErr.Mechanisms, mechanisms)) {
+				t.Fatalf("expected the server's mechanisms, but got %v", clientErr)
+			}
+		})
+	}
+}
+
+func readLine(r *bufio.Reader) string {
+	line, _ := r.ReadString('\n')
+	return line
+}
+
+// sizeClientMech sends an initial response of the given size and expects the
+// server to echo the size back. An empty exchange completes immediately.
+type sizeClientMech struct {
+	size int
+}
+
+func (m *sizeClientMech) Start(_ context.Context) (string, []byte, error) {
+	return "SIZE", bytes.Repeat([]byte{'a'}, m.size), nil
+}
+
+func (m *sizeClientMech) Next(_ context.Context, challenge []byte) ([]byte, error) {
+	if string(challenge) != strings.Repeat("b", m.size) {
+		return nil, fmt.Errorf("expected a challenge of %d bytes, but got %d", m.size, len(challenge))
+	}
+	m.size = -1
+	return nil, nil
+}
+
+func (m *sizeClientMech) Completed() bool {
+	return m.size <= 0
+}
+
+// sizeServerMech answers the initial response with a challenge of the same
+// size.
+type sizeServerMech struct {
+	done bool
+}
+
+func (m *sizeServerMech) Start(_ context.Context, response []byte) (string, []byte, error) {
+	m.done = true
+	return "SIZE", bytes.Repeat([]byte{'b'}, len(response)), nil
+}
+
+func (m *sizeServerMech) Next(_ context.Context, _ []byte) ([]byte, error) {
+	return nil, errors.New("unexpected response")
+}
+
+func (m *sizeServerMech) Completed() bool {
+	return m.done
+}
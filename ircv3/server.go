@@ -0,0 +1,198 @@
+package ircv3
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ServerMechProvider returns a new server mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ServerMechProvider func(mechName string) sasl.ServerMech
+
+// AccountFunc returns the account name authenticated by a completed
+// mechanism.
+type AccountFunc func(mech sasl.ServerMech) string
+
+// NewServer creates a Server for a single client connection. The server name
+// is used as the prefix of numeric replies.
+func NewServer(serverName string, mechanisms []string, provider ServerMechProvider, account AccountFunc) *Server {
+	return &Server{
+		serverName: serverName,
+		mechanisms: mechanisms,
+		provider:   provider,
+		account:    account,
+	}
+}
+
+// Server hosts SASL authentication for a single client connection.
+type Server struct {
+	serverName string
+	mechanisms []string
+	provider   ServerMechProvider
+	account    AccountFunc
+
+	// state
+	mech sasl.ServerMech
+}
+
+// Capability returns the sasl capability with the mechanisms as its value,
+// for inclusion in a CAP LS 302 reply.
+func (s *Server) Capability() string {
+	return "sasl=" + strings.Join(s.mechanisms, ",")
+}
+
+// Cap answers a CAP LS or CAP REQ message for a server whose only capability
+// is sasl. Servers offering other capabilities negotiate CAP themselves and
+// advertise Capability. Other CAP subcommands are ignored.
+func (s *Server) Cap(w *bufio.Writer, nick string, msg *Message) error {
+	switch strings.ToUpper(msg.param(0)) {
+	case "LS":
+		capability := "sasl"
+		if version, _ := strconv.Atoi(msg.param(1)); version >= 302 {
+			capability = s.Capability()
+		}
+		return s.reply(w, "CAP", nick, "LS", capability)
+	case "REQ":
+		requested := msg.param(1)
+		for _, name := range strings.Fields(requested) {
+			if name != "sasl" {
+				return s.reply(w, "CAP", nick, "NAK", requested)
+			}
+		}
+		return s.reply(w, "CAP", nick, "ACK", requested)
+	}
+	return nil
+}
+
+// Mech returns the mechanism of the completed exchange, or nil if the client
+// has not authenticated.
+func (s *Server) Mech() sasl.ServerMech {
+	return s.mech
+}
+
+// Authenticate conducts SASL authentication in response to req, the client's
+// AUTHENTICATE message naming the mechanism. The nick and mask
+// (nick!user@host) identify the client in the numeric replies, with "*"
+// standing in for a nick that has not been registered yet. Any message other
+// than AUTHENTICATE received during the exchange aborts it. Authenticate
+// writes the final numeric in every case.
+func (s *Server) Authenticate(ctx context.Context, rw *bufio.ReadWriter, nick, mask string, req *Message) (sasl.ServerMech, error) {
+	mechName := strings.ToUpper(req.param(0))
+	switch {
+	case mechName == "*":
+		s.reply(rw.Writer, NumericSASLAborted, nick, "SASL authentication aborted")
+		return nil, ErrAborted
+	case s.mech != nil:
+		s.reply(rw.Writer, NumericSASLAlready, nick, "You have already authenticated using SASL")
+		return nil, fmt.Errorf("ircv3: client has already authenticated")
+	}
+
+	var mech sasl.ServerMech
+	for _, name := range s.mechanisms {
+		if name == mechName {
+			mech = s.provider(mechName)
+		}
+	}
+	if mech == nil {
+		s.reply(rw.Writer, NumericSASLMechs, nick, strings.Join(s.mechanisms, ","), "are available SASL mechanisms")
+		s.reply(rw.Writer, NumericSASLFail, nick, "SASL authentication failed")
+		return nil, fmt.Errorf("ircv3: sasl mechanism %s is not supported", mechName)
+	}
+
+	if err := writeLine(rw.Writer, "AUTHENTICATE +"); err != nil {
+		return nil, err
+	}
+
+	response, err := s.readResponse(ctx, rw, nick)
+	if err != nil {
+		return nil, err
+	}
+
+	_, challenge, err := mech.Start(ctx, response)
+	for {
+		if err != nil {
+			s.reply(rw.Writer, NumericSASLFail, nick, "SASL authentication failed")
+			return nil, fmt.Errorf("ircv3: sasl mechanism %s: %v", mechName, err)
+		}
+
+		if mech.Completed() && len(challenge) == 0 {
+			break
+		}
+
+		if err = writePayload(rw.Writer, challenge); err != nil {
+			return nil, err
+		}
+
+		if response, err = s.readResponse(ctx, rw, nick); err != nil {
+			return nil, err
+		}
+
+		if mech.Completed() {
+			// the final challenge carried additional data; the client
+			// acknowledges it with an empty response.
+			if len(response) != 0 {
+				s.reply(rw.Writer, NumericSASLFail, nick, "SASL authentication failed")
+				return nil, fmt.Errorf("ircv3: unexpected response after exchange completed")
+			}
+			break
+		}
+
+		challenge, err = mech.Next(ctx, response)
+	}
+
+	s.mech = mech
+	account := s.account(mech)
+	if err = s.reply(rw.Writer, NumericLoggedIn, nick, mask, account, "You are now logged in as "+account); err != nil {
+		return nil, err
+	}
+	if err = s.reply(rw.Writer, NumericSASLSuccess, nick, "SASL authentication successful"); err != nil {
+		return nil, err
+	}
+	return mech, nil
+}
+
+// readResponse reads the chunks of a single client response.
+func (s *Server) readResponse(ctx context.Context, rw *bufio.ReadWriter, nick string) ([]byte, error) {
+	var a assembler
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		msg, err := readMessage(rw.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if msg.Command != "AUTHENTICATE" || msg.param(0) == "*" {
+			s.reply(rw.Writer, NumericSASLAborted, nick, "SASL authentication aborted")
+			return nil, ErrAborted
+		}
+
+		done, err := a.add(msg.param(0))
+		if err != nil {
+			s.reply(rw.Writer, NumericSASLTooLong, nick, "SASL message too long")
+			return nil, err
+		}
+		if !done {
+			continue
+		}
+
+		response, err := a.payload()
+		if err != nil {
+			s.reply(rw.Writer, NumericSASLFail, nick, "SASL authentication failed")
+			return nil, fmt.Errorf("ircv3: invalid response encoding: %v", err)
+		}
+		return response, nil
+	}
+}
+
+// reply sends a message prefixed with the server name.
+func (s *Server) reply(w *bufio.Writer, command string, params ...string) error {
+	return writeLine(w, (&Message{Prefix: s.serverName, Command: command, Params: params}).String())
+}
@@ -0,0 +1,153 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Session describes an authenticated connection.
+type Session struct {
+	Mechanism string
+
+	// Lifetime is the session lifetime reported by the broker, or zero when
+	// the broker does not require re-authentication.
+	Lifetime time.Duration
+
+	// Established is the time at which authentication completed.
+	Established time.Time
+}
+
+// ReauthenticateAt returns the time at which the client should
+// re-authenticate, leaving a margin before the session expires. It returns the
+// zero time when the session does not expire.
+func (s *Session) ReauthenticateAt() time.Time {
+	if s.Lifetime <= 0 {
+		return time.Time{}
+	}
+	return s.Established.Add(s.Lifetime * 85 / 100)
+}
+
+// NewClient creates a Client authenticating on the connection rw to a broker,
+// identifying itself as clientID.
+func NewClient(rw io.ReadWriter, clientID string) *Client {
+	return &Client{
+		rw:       rw,
+		clientID: clientID,
+	}
+}
+
+// Client conducts authentication on the client side of a connection. It
+// numbers its requests with correlation IDs of its own, so it must not be
+// shared between connections or used concurrently.
+type Client struct {
+	rw            io.ReadWriter
+	clientID      string
+	correlationID int32
+}
+
+// Authenticate conducts the SaslHandshake and SaslAuthenticate requests as a
+// client on a connection to a broker, using a new Client. Re-authentication of
+// the connection should go through the same Client instead.
+func Authenticate(ctx context.Context, rw io.ReadWriter, clientID string, mech sasl.ClientMech) (*Session, error) {
+	return NewClient(rw, clientID).Authenticate(ctx, mech)
+}
+
+// Authenticate conducts the SaslHandshake and SaslAuthenticate requests. It is
+// also used to re-authenticate the connection before its session expires.
+func (c *Client) Authenticate(ctx context.Context, mech sasl.ClientMech) (*Session, error) {
+	mechName, authBytes, err := mech.Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	if err = c.handshake(mechName); err != nil {
+		return nil, err
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var e encoder
+		e.bytes(authBytes)
+		id := c.nextCorrelationID()
+		if err = writeRequest(c.rw, APIKeySaslAuthenticate, id, c.clientID, e.b); err != nil {
+			return nil, err
+		}
+
+		d, err := readResponse(c.rw, id)
+		if err != nil {
+			return nil, err
+		}
+
+		errorCode := d.int16()
+		errorMessage := d.string()
+		challenge := d.bytes()
+		lifetime := d.int64()
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		if errorCode != ErrorCodeNone {
+			return nil, &Error{Code: errorCode, Message: errorMessage}
+		}
+
+		if len(challenge) > 0 || !mech.Completed() {
+			authBytes, err = mech.Next(ctx, challenge)
+			if err != nil {
+				return nil, fmt.Errorf("kafka: sasl mechanism %s: client failed to provide response: %v", mechName, err)
+			}
+			if !mech.Completed() {
+				continue
+			}
+		}
+
+		return &Session{
+			Mechanism:   mechName,
+			Lifetime:    time.Duration(lifetime) * time.Millisecond,
+			Established: time.Now(),
+		}, nil
+	}
+}
+
+func (c *Client) nextCorrelationID() int32 {
+	c.correlationID++
+	return c.correlationID
+}
+
+func (c *Client) handshake(mechName string) error {
+	var e encoder
+	e.string(mechName)
+	id := c.nextCorrelationID()
+	if err := writeRequest(c.rw, APIKeySaslHandshake, id, c.clientID, e.b); err != nil {
+		return err
+	}
+
+	d, err := readResponse(c.rw, id)
+	if err != nil {
+		return err
+	}
+
+	errorCode := d.int16()
+	var mechanisms []string
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		mechanisms = append(mechanisms, d.string())
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	if errorCode != ErrorCodeNone {
+		return &Error{
+			Code:    errorCode,
+			Message: fmt.Sprintf("sasl mechanism %s is not enabled, supported mechanisms are %s", mechName, strings.Join(mechanisms, ", ")),
+		}
+	}
+	return nil
+}
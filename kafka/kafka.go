@@ -0,0 +1,231 @@
+// Package kafka runs SASL mechanisms over the Kafka SaslHandshake (v1) and
+// SaslAuthenticate (v1) requests described by KIP-43 and KIP-152, including
+// the session lifetime used for re-authentication by KIP-368. Servers also
+// answer SaslAuthenticate v0 requests, which carry no session lifetime.
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// API keys of the requests used during authentication.
+const (
+	APIKeySaslHandshake    int16 = 17
+	APIKeySaslAuthenticate int16 = 36
+)
+
+// Error codes returned during authentication.
+const (
+	ErrorCodeNone                     int16 = 0
+	ErrorCodeUnsupportedSaslMechanism int16 = 33
+	ErrorCodeIllegalSaslState         int16 = 34
+	ErrorCodeSaslAuthenticationFailed int16 = 58
+)
+
+// TokenAuthExtension is the SCRAM extension attribute that marks the
+// credentials as a delegation token, as described by KIP-48. Clients set it to
+// "true" with scramsha1.ClientMech.SetExtensions and servers read it with
+// scramsha1.ExtensionsFromContext.
+const TokenAuthExtension = "tokenauth"
+
+// maxFrameLen bounds the size of a single frame read from the wire.
+const maxFrameLen = 1 << 20
+
+// IsTokenAuth indicates if the SCRAM extensions sent by a client mark the
+// credentials as a delegation token.
+func IsTokenAuth(extensions map[string]string) bool {
+	return extensions[TokenAuthExtension] == "true"
+}
+
+// Error is returned when the broker responds with a non-zero error code.
+type Error struct {
+	Code    int16
+	Message string
+}
+
+func (e *Error) Error() string {
+	s := fmt.Sprintf("kafka: broker responded with error code %d", e.Code)
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// Request is a request frame as read by a broker.
+type Request struct {
+	APIKey        int16
+	APIVersion    int16
+	CorrelationID int32
+	ClientID      string
+	Body          []byte
+}
+
+// ReadRequest reads a single request frame using request header v1.
+func ReadRequest(r io.Reader) (*Request, error) {
+	frame, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := decoder{b: frame}
+	req := &Request{
+		APIKey:        d.int16(),
+		APIVersion:    d.int16(),
+		CorrelationID: d.int32(),
+		ClientID:      d.string(),
+	}
+	req.Body = d.b
+	if d.err != nil {
+		return nil, d.err
+	}
+	return req, nil
+}
+
+func writeRequest(w io.Writer, apiKey int16, correlationID int32, clientID string, body []byte) error {
+	var e encoder
+	e.int16(apiKey)
+	e.int16(1)
+	e.int32(correlationID)
+	e.string(clientID)
+	e.b = append(e.b, body...)
+	return writeFrame(w, e.b)
+}
+
+func writeResponse(w io.Writer, correlationID int32, body []byte) error {
+	var e encoder
+	e.int32(correlationID)
+	e.b = append(e.b, body...)
+	return writeFrame(w, e.b)
+}
+
+func readResponse(r io.Reader, correlationID int32) (*decoder, error) {
+	frame, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decoder{b: frame}
+	if id := d.int32(); d.err == nil && id != correlationID {
+		return nil, fmt.Errorf("kafka: expected response to request %d, but got %d", correlationID, id)
+	}
+	return d, d.err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := int32(binary.BigEndian.Uint32(size[:]))
+	if n < 0 || n > maxFrameLen {
+		return nil, fmt.Errorf("kafka: invalid frame size %d", n)
+	}
+
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func writeFrame(w io.Writer, frame []byte) error {
+	b := make([]byte, 4, 4+len(frame))
+	binary.BigEndian.PutUint32(b, uint32(len(frame)))
+	_, err := w.Write(append(b, frame...))
+	return err
+}
+
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int16(v int16) {
+	e.b = binary.BigEndian.AppendUint16(e.b, uint16(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.b = binary.BigEndian.AppendUint32(e.b, uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, uint64(v))
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) nullableString(s *string) {
+	if s == nil {
+		e.int16(-1)
+		return
+	}
+	e.string(*s)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+var errTruncated = errors.New("kafka: truncated message")
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errTruncated
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n == -1 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n == -1 {
+		return nil
+	}
+	return append([]byte{}, d.next(int(n))...)
+}
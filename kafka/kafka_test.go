@@ -0,0 +1,207 @@
+package kafka_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/kafka"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+func TestAuthenticate(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	// delegation tokens are looked up separately from user credentials.
+	storedUserProvider := func(ctx context.Context, username string) (*scramsha1.StoredUser, error) {
+		password := "mcjack"
+		if kafka.IsTokenAuth(scramsha1.ExtensionsFromContext(ctx)) {
+			password = "token-hmac"
+		}
+
+		_, storedKey, serverKey := scramsha1.GenerateKeys(password, []byte("blah"), 100)
+		return &scramsha1.StoredUser{
+			Salt:       []byte("blah"),
+			Iterations: 100,
+			StoredKey:  storedKey,
+			ServerKey:  serverKey,
+		}, nil
+	}
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	server := kafka.NewServer([]string{plain.MechName, scramsha1.MechName}, func(mechName string) sasl.ServerMech {
+		switch mechName {
+		case plain.MechName:
+			return plain.NewServerMech(userPassVerifier, nil)
+		case scramsha1.MechName:
+			return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+		}
+		return nil
+	}, time.Hour)
+
+	tokenMech := scramsha1.NewClientMech("", "tokenid", "token-hmac", 16, mr)
+	tokenMech.SetExtensions(map[string]string{kafka.TokenAuthExtension: "true"})
+
+	tests := []struct {
+		name      string
+		client    sasl.ClientMech
+		clientErr string
+		serverErr string
+	}{
+		{"plain", plain.NewClientMech("", "jack", "mcjack"), "", ""},
+		{"plain-wrong", plain.NewClientMech("", "jack", "wrong"),
+			"kafka: broker responded with error code 58: Authentication failed during authentication due to invalid credentials with SASL mechanism PLAIN",
+			"kafka: sasl mechanism PLAIN: invalid username or password"},
+		{"scram", scramsha1.NewClientMech("", "jack", "mcjack", 16, mr), "", ""},
+		{"scram-wrong", scramsha1.NewClientMech("", "jack", "wrong", 16, mr),
+			"kafka: broker responded with error code 58: Authentication failed during authentication due to invalid credentials with SASL mechanism SCRAM-SHA-1",
+			"kafka: sasl mechanism SCRAM-SHA-1: invalid response: client key mismatch"},
+		{"scram-tokenauth", tokenMech, "", ""},
+		{"unsupported", &testhelpers.FailingClientMech{},
+			"kafka: broker responded with error code 33: sasl mechanism FAIL is not enabled, supported mechanisms are PLAIN, SCRAM-SHA-1",
+			"kafka: sasl mechanism FAIL is not supported"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				defer serverConn.Close()
+				_, err := server.Authenticate(context.Background(), serverConn, nil)
+				serverErr <- err
+			}()
+
+			session, clientErr := kafka.Authenticate(context.Background(), clientConn, "test", test.client)
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, <-serverErr)
+
+			if clientErr == nil && session.Lifetime != time.Hour {
+				t.Fatalf("expected a session lifetime of %v, but got %v", time.Hour, session.Lifetime)
+			}
+		})
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		return nil
+	}
+
+	server := kafka.NewServer([]string{plain.MechName}, func(mechName string) sasl.ServerMech {
+		return plain.NewServerMech(userPassVerifier, nil)
+	}, 10*time.Minute)
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go func() {
+		defer serverConn.Close()
+		for i := 0; i < 2; i++ {
+			if _, err := server.Authenticate(context.Background(), serverConn, nil); err != nil {
+				return
+			}
+		}
+	}()
+
+	// re-authentication goes through the client of the connection.
+	client := kafka.NewClient(clientConn, "test")
+	for i := 0; i < 2; i++ {
+		session, err := client.Authenticate(context.Background(), plain.NewClientMech("", "jack", "mcjack"))
+		if err != nil {
+			t.Fatalf("authentication %d failed: %v", i, err)
+		}
+
+		if expected := session.Established.Add(8*time.Minute + 30*time.Second); !session.ReauthenticateAt().Equal(expected) {
+			t.Fatalf("expected to re-authenticate at %v, but got %v", expected, session.ReauthenticateAt())
+		}
+	}
+}
+
+func TestAuthenticateV0(t *testing.T) {
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		return nil
+	}
+
+	server := kafka.NewServer([]string{plain.MechName}, func(mechName string) sasl.ServerMech {
+		return plain.NewServerMech(userPassVerifier, nil)
+	}, 10*time.Minute)
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		_, err := server.Authenticate(context.Background(), serverConn, nil)
+		serverErr <- err
+	}()
+
+	handshake := binary.BigEndian.AppendUint16(nil, uint16(len(plain.MechName)))
+	handshake = append(handshake, plain.MechName...)
+	if _, err := readV0Response(t, clientConn, kafka.APIKeySaslHandshake, 1, handshake); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+
+	authBytes := []byte("\x00jack\x00mcjack")
+	body, err := readV0Response(t, clientConn, kafka.APIKeySaslAuthenticate, 2, append(binary.BigEndian.AppendUint32(nil, uint32(len(authBytes))), authBytes...))
+	if err != nil {
+		t.Fatalf("authentication failed: %v", err)
+	}
+
+	// error code, null error message and empty auth bytes, without the
+	// session lifetime added in v1.
+	if expected := []byte{0, 0, 0xff, 0xff, 0, 0, 0, 0}; !bytes.Equal(body, expected) {
+		t.Fatalf("expected SaslAuthenticate v0 response %x, but got %x", expected, body)
+	}
+	if err = <-serverErr; err != nil {
+		t.Fatalf("expected no server error, but got %v", err)
+	}
+}
+
+// readV0Response sends a v0 request and returns the body of its response.
+func readV0Response(t *testing.T, conn net.Conn, apiKey int16, correlationID int32, body []byte) ([]byte, error) {
+	t.Helper()
+
+	frame := binary.BigEndian.AppendUint16(nil, uint16(apiKey))
+	frame = binary.BigEndian.AppendUint16(frame, 0)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(correlationID))
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len("test")))
+	frame = append(frame, "test"...)
+	frame = append(frame, body...)
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(frame))), frame...)); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	if id := int32(binary.BigEndian.Uint32(response)); id != correlationID {
+		t.Fatalf("expected response to request %d, but got %d", correlationID, id)
+	}
+	return response[4:], nil
+}
@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ServerMechProvider returns a new server mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ServerMechProvider func(mechName string) sasl.ServerMech
+
+// NewServer creates a Server offering the named mechanisms.
+func NewServer(mechanisms []string, provider ServerMechProvider, sessionLifetime time.Duration) *Server {
+	return &Server{
+		mechanisms:      mechanisms,
+		provider:        provider,
+		sessionLifetime: sessionLifetime,
+	}
+}
+
+// Server conducts authentication on the broker side of a connection.
+type Server struct {
+	mechanisms      []string
+	provider        ServerMechProvider
+	sessionLifetime time.Duration
+}
+
+// Authenticate handles a SaslHandshake request followed by SaslAuthenticate
+// requests until the exchange completes. If the caller's request loop has
+// already read the handshake request it is passed as handshake; otherwise
+// handshake is nil and the request is read from rw. The completed mechanism is
+// returned so the caller can inspect the authenticated identity.
+func (s *Server) Authenticate(ctx context.Context, rw io.ReadWriter, handshake *Request) (sasl.ServerMech, error) {
+	var err error
+	if handshake == nil {
+		if handshake, err = ReadRequest(rw); err != nil {
+			return nil, err
+		}
+	}
+
+	if handshake.APIKey != APIKeySaslHandshake {
+		return nil, fmt.Errorf("kafka: expected SaslHandshake request, but got api key %d", handshake.APIKey)
+	}
+
+	d := decoder{b: handshake.Body}
+	mechName := d.string()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	var mech sasl.ServerMech
+	if s.supports(mechName) {
+		mech = s.provider(mechName)
+	}
+
+	var e encoder
+	if mech == nil {
+		e.int16(ErrorCodeUnsupportedSaslMechanism)
+	} else {
+		e.int16(ErrorCodeNone)
+	}
+	e.int32(int32(len(s.mechanisms)))
+	for _, name := range s.mechanisms {
+		e.string(name)
+	}
+	if err = writeResponse(rw, handshake.CorrelationID, e.b); err != nil {
+		return nil, err
+	}
+	if mech == nil {
+		return nil, fmt.Errorf("kafka: sasl mechanism %s is not supported", mechName)
+	}
+
+	started := false
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		req, err := ReadRequest(rw)
+		if err != nil {
+			return nil, err
+		}
+		if req.APIKey != APIKeySaslAuthenticate {
+			s.writeAuthenticateResponse(rw, req, ErrorCodeIllegalSaslState, "unexpected request during authentication", nil)
+			return nil, fmt.Errorf("kafka: expected SaslAuthenticate request, but got api key %d", req.APIKey)
+		}
+
+		d := decoder{b: req.Body}
+		authBytes := d.bytes()
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		var challenge []byte
+		if !started {
+			started = true
+			_, challenge, err = mech.Start(ctx, authBytes)
+		} else {
+			challenge, err = mech.Next(ctx, authBytes)
+		}
+
+		if err != nil {
+			msg := "Authentication failed during authentication due to invalid credentials with SASL mechanism " + mechName
+			s.writeAuthenticateResponse(rw, req, ErrorCodeSaslAuthenticationFailed, msg, nil)
+			return nil, fmt.Errorf("kafka: sasl mechanism %s: %v", mechName, err)
+		}
+
+		if err = s.writeAuthenticateResponse(rw, req, ErrorCodeNone, "", challenge); err != nil {
+			return nil, err
+		}
+
+		if mech.Completed() {
+			return mech, nil
+		}
+	}
+}
+
+func (s *Server) supports(mechName string) bool {
+	for _, name := range s.mechanisms {
+		if name == mechName {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAuthenticateResponse answers req in its version of SaslAuthenticate:
+// the session lifetime was only added in v1.
+func (s *Server) writeAuthenticateResponse(w io.Writer, req *Request, errorCode int16, errorMessage string, authBytes []byte) error {
+	var e encoder
+	e.int16(errorCode)
+	if errorMessage == "" {
+		e.nullableString(nil)
+	} else {
+		e.nullableString(&errorMessage)
+	}
+	e.bytes(authBytes)
+	if req.APIVersion >= 1 {
+		e.int64(int64(s.sessionLifetime / time.Millisecond))
+	}
+	return writeResponse(w, req.CorrelationID, e.b)
+}
@@ -0,0 +1,144 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER tags used by the bind operations.
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+
+	tagBindRequest     = 0x60
+	tagBindResponse    = 0x61
+	tagAuthSimple      = 0x80
+	tagAuthSasl        = 0xa3
+	tagServerSaslCreds = 0x87
+)
+
+// maxMessageLen bounds the size of a single message read from the wire.
+const maxMessageLen = 1 << 20
+
+var errTruncated = errors.New("ldap: truncated BER element")
+
+type element struct {
+	tag   byte
+	value []byte
+}
+
+func appendElement(b []byte, tag byte, value []byte) []byte {
+	b = append(b, tag)
+	switch n := len(value); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xff:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, value...)
+}
+
+func appendInteger(b []byte, tag byte, v int64) []byte {
+	var value []byte
+	for {
+		value = append([]byte{byte(v)}, value...)
+		if (v < 0x80 && v >= -0x80) || len(value) == 8 {
+			break
+		}
+		v >>= 8
+	}
+	return appendElement(b, tag, value)
+}
+
+func parseInteger(e element, tag byte) (int64, error) {
+	if e.tag != tag || len(e.value) == 0 || len(e.value) > 8 {
+		return 0, fmt.Errorf("ldap: expected integer with tag 0x%02x", tag)
+	}
+
+	v := int64(int8(e.value[0]))
+	for _, b := range e.value[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+// readElement decodes the first element in b and returns the remaining bytes.
+func readElement(b []byte) (element, []byte, error) {
+	if len(b) < 2 {
+		return element{}, nil, errTruncated
+	}
+
+	tag := b[0]
+	length, n, err := parseLength(b[1:])
+	if err != nil {
+		return element{}, nil, err
+	}
+
+	b = b[1+n:]
+	if length > len(b) {
+		return element{}, nil, errTruncated
+	}
+
+	return element{tag: tag, value: b[:length]}, b[length:], nil
+}
+
+func parseLength(b []byte) (int, int, error) {
+	if b[0] < 0x80 {
+		return int(b[0]), 1, nil
+	}
+
+	n := int(b[0] & 0x7f)
+	if n == 0 || n > 4 {
+		return 0, 0, fmt.Errorf("ldap: unsupported BER length encoding")
+	}
+	if len(b) < 1+n {
+		return 0, 0, errTruncated
+	}
+
+	length := 0
+	for _, c := range b[1 : 1+n] {
+		length = length<<8 | int(c)
+	}
+	if length < 0 || length > maxMessageLen {
+		return 0, 0, fmt.Errorf("ldap: message exceeds %d bytes", maxMessageLen)
+	}
+	return length, 1 + n, nil
+}
+
+// readRawElement reads a single complete element from r.
+func readRawElement(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	if header[1] >= 0x80 {
+		n := int(header[1] & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("ldap: unsupported BER length encoding")
+		}
+		header = header[:2+n]
+		if _, err := io.ReadFull(r, header[2:]); err != nil {
+			return nil, err
+		}
+	}
+
+	length, _, err := parseLength(header[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, len(header)+length)
+	copy(b, header)
+	if _, err = io.ReadFull(r, b[len(header):]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
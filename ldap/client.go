@@ -0,0 +1,83 @@
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Bind conducts a SASL bind as a client, sending one BindRequest per step of
+// the exchange. Message ids are allocated sequentially starting at messageID.
+// The final BindResponse is returned on success; a bind that completes with
+// any other result code is reported as a *ResultError.
+func Bind(ctx context.Context, rw io.ReadWriter, messageID int32, name string, mech sasl.ClientMech) (*BindResponse, error) {
+	mechName, creds, err := mech.Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		req := &BindRequest{
+			MessageID:   messageID,
+			Version:     3,
+			Name:        name,
+			Mechanism:   mechName,
+			Credentials: creds,
+		}
+		if err = WriteBindRequest(rw, req); err != nil {
+			return nil, err
+		}
+
+		resp, err := readBindResponse(rw, messageID)
+		if err != nil {
+			return nil, err
+		}
+		messageID++
+
+		switch resp.ResultCode {
+		case SaslBindInProgress:
+			creds, err = mech.Next(ctx, resp.ServerSaslCreds)
+			if err != nil {
+				return nil, fmt.Errorf("ldap: sasl mechanism %s: client failed to provide response: %v", mechName, err)
+			}
+		case Success:
+			if resp.ServerSaslCreds != nil && !mech.Completed() {
+				if _, err = mech.Next(ctx, resp.ServerSaslCreds); err != nil {
+					return nil, fmt.Errorf("ldap: sasl mechanism %s: unable to verify server: %v", mechName, err)
+				}
+			}
+			if !mech.Completed() {
+				return nil, fmt.Errorf("ldap: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return resp, nil
+		default:
+			return nil, &ResultError{
+				ResultCode:        resp.ResultCode,
+				MatchedDN:         resp.MatchedDN,
+				DiagnosticMessage: resp.DiagnosticMessage,
+			}
+		}
+	}
+}
+
+func readBindResponse(r io.Reader, messageID int32) (*BindResponse, error) {
+	msg, err := ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Op == OpExtendedResponse && msg.ID == 0 {
+		return nil, fmt.Errorf("ldap: server sent a notice of disconnection")
+	}
+	if msg.ID != messageID {
+		return nil, fmt.Errorf("ldap: expected response to message %d, but got %d", messageID, msg.ID)
+	}
+
+	return msg.BindResponse()
+}
@@ -0,0 +1,254 @@
+// Package ldap runs SASL mechanisms over LDAP bind operations as defined by
+// RFC4511 (https://tools.ietf.org/html/rfc4511#section-4.2) and
+// RFC4513 (https://tools.ietf.org/html/rfc4513#section-5.2).
+package ldap
+
+import (
+	"fmt"
+	"io"
+)
+
+// ResultCode is an LDAPResult resultCode.
+type ResultCode int
+
+// Result codes relevant to bind operations.
+const (
+	Success                     ResultCode = 0
+	OperationsError             ResultCode = 1
+	ProtocolError               ResultCode = 2
+	AuthMethodNotSupported      ResultCode = 7
+	StrongerAuthRequired        ResultCode = 8
+	SaslBindInProgress          ResultCode = 14
+	InappropriateAuthentication ResultCode = 48
+	InvalidCredentials          ResultCode = 49
+	Unavailable                 ResultCode = 52
+	UnwillingToPerform          ResultCode = 53
+	Other                       ResultCode = 80
+)
+
+// Protocol operation application tag numbers.
+const (
+	OpBindRequest      = 0
+	OpBindResponse     = 1
+	OpUnbindRequest    = 2
+	OpExtendedResponse = 24
+)
+
+// ResultError is returned when a bind completes with a result code other
+// than Success.
+type ResultError struct {
+	ResultCode        ResultCode
+	MatchedDN         string
+	DiagnosticMessage string
+}
+
+func (e *ResultError) Error() string {
+	s := fmt.Sprintf("ldap: bind failed with result code %d", e.ResultCode)
+	if e.DiagnosticMessage != "" {
+		s += ": " + e.DiagnosticMessage
+	}
+	return s
+}
+
+// BindRequest is a BindRequest protocol operation.
+type BindRequest struct {
+	MessageID int32
+	Version   int
+	Name      string
+
+	// Mechanism and Credentials hold the SaslCredentials. Credentials is nil
+	// when the optional field is absent.
+	Mechanism   string
+	Credentials []byte
+
+	// Simple holds the password of a simple bind, which is not otherwise
+	// handled by this package.
+	Simple []byte
+}
+
+// BindResponse is a BindResponse protocol operation.
+type BindResponse struct {
+	MessageID         int32
+	ResultCode        ResultCode
+	MatchedDN         string
+	DiagnosticMessage string
+
+	// ServerSaslCreds is nil when the optional field is absent.
+	ServerSaslCreds []byte
+}
+
+// Message is a decoded LDAPMessage envelope. Controls are ignored.
+type Message struct {
+	ID int32
+	Op int
+
+	op element
+}
+
+// ReadMessage reads a single LDAPMessage from r.
+func ReadMessage(r io.Reader) (*Message, error) {
+	b, err := readRawElement(r)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, _, err := readElement(b)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.tag != tagSequence {
+		return nil, fmt.Errorf("ldap: expected LDAPMessage sequence")
+	}
+
+	idElem, rest, err := readElement(envelope.value)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseInteger(idElem, tagInteger)
+	if err != nil {
+		return nil, err
+	}
+
+	op, _, err := readElement(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{ID: int32(id), Op: int(op.tag & 0x1f), op: op}, nil
+}
+
+// BindRequest decodes the message's protocol operation as a BindRequest.
+func (m *Message) BindRequest() (*BindRequest, error) {
+	if m.op.tag != tagBindRequest {
+		return nil, fmt.Errorf("ldap: message %d is not a bind request", m.ID)
+	}
+
+	req := &BindRequest{MessageID: m.ID}
+
+	e, rest, err := readElement(m.op.value)
+	if err != nil {
+		return nil, err
+	}
+	version, err := parseInteger(e, tagInteger)
+	if err != nil {
+		return nil, err
+	}
+	req.Version = int(version)
+
+	if e, rest, err = readElement(rest); err != nil {
+		return nil, err
+	}
+	if e.tag != tagOctetString {
+		return nil, fmt.Errorf("ldap: expected bind name")
+	}
+	req.Name = string(e.value)
+
+	if e, _, err = readElement(rest); err != nil {
+		return nil, err
+	}
+	switch e.tag {
+	case tagAuthSimple:
+		req.Simple = e.value
+	case tagAuthSasl:
+		mech, creds, err := readElement(e.value)
+		if err != nil {
+			return nil, err
+		}
+		if mech.tag != tagOctetString {
+			return nil, fmt.Errorf("ldap: expected sasl mechanism")
+		}
+		req.Mechanism = string(mech.value)
+
+		if len(creds) > 0 {
+			c, _, err := readElement(creds)
+			if err != nil {
+				return nil, err
+			}
+			req.Credentials = append([]byte{}, c.value...)
+		}
+	default:
+		return nil, fmt.Errorf("ldap: unsupported authentication choice 0x%02x", e.tag)
+	}
+
+	return req, nil
+}
+
+// BindResponse decodes the message's protocol operation as a BindResponse.
+func (m *Message) BindResponse() (*BindResponse, error) {
+	if m.op.tag != tagBindResponse {
+		return nil, fmt.Errorf("ldap: message %d is not a bind response", m.ID)
+	}
+
+	resp := &BindResponse{MessageID: m.ID}
+
+	e, rest, err := readElement(m.op.value)
+	if err != nil {
+		return nil, err
+	}
+	code, err := parseInteger(e, tagEnumerated)
+	if err != nil {
+		return nil, err
+	}
+	resp.ResultCode = ResultCode(code)
+
+	if e, rest, err = readElement(rest); err != nil {
+		return nil, err
+	}
+	resp.MatchedDN = string(e.value)
+
+	if e, rest, err = readElement(rest); err != nil {
+		return nil, err
+	}
+	resp.DiagnosticMessage = string(e.value)
+
+	for len(rest) > 0 {
+		if e, rest, err = readElement(rest); err != nil {
+			return nil, err
+		}
+		if e.tag == tagServerSaslCreds {
+			resp.ServerSaslCreds = append([]byte{}, e.value...)
+		}
+	}
+
+	return resp, nil
+}
+
+// WriteBindRequest encodes req as an LDAPMessage and writes it to w.
+func WriteBindRequest(w io.Writer, req *BindRequest) error {
+	var op []byte
+	op = appendInteger(op, tagInteger, int64(req.Version))
+	op = appendElement(op, tagOctetString, []byte(req.Name))
+	if req.Mechanism == "" {
+		op = appendElement(op, tagAuthSimple, req.Simple)
+	} else {
+		creds := appendElement(nil, tagOctetString, []byte(req.Mechanism))
+		if req.Credentials != nil {
+			creds = appendElement(creds, tagOctetString, req.Credentials)
+		}
+		op = appendElement(op, tagAuthSasl, creds)
+	}
+
+	return writeMessage(w, req.MessageID, tagBindRequest, op)
+}
+
+// WriteBindResponse encodes resp as an LDAPMessage and writes it to w.
+func WriteBindResponse(w io.Writer, resp *BindResponse) error {
+	var op []byte
+	op = appendInteger(op, tagEnumerated, int64(resp.ResultCode))
+	op = appendElement(op, tagOctetString, []byte(resp.MatchedDN))
+	op = appendElement(op, tagOctetString, []byte(resp.DiagnosticMessage))
+	if resp.ServerSaslCreds != nil {
+		op = appendElement(op, tagServerSaslCreds, resp.ServerSaslCreds)
+	}
+
+	return writeMessage(w, resp.MessageID, tagBindResponse, op)
+}
+
+func writeMessage(w io.Writer, id int32, tag byte, op []byte) error {
+	var envelope []byte
+	envelope = appendInteger(envelope, tagInteger, int64(id))
+	envelope = appendElement(envelope, tag, op)
+
+	_, err := w.Write(appendElement(nil, tagSequence, envelope))
+	return err
+}
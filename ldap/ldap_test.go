@@ -0,0 +1,124 @@
+package ldap_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/ldap"
+	"github.com/craiggwilson/go-sasl/ldap/ldaptest"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+func TestBind(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{
+			Salt:       []byte("blah"),
+			Iterations: 100,
+			StoredKey:  storedKey,
+			ServerKey:  serverKey,
+		}, nil
+	}
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	directory := ldaptest.NewDirectory(func(mechName string) sasl.ServerMech {
+		switch mechName {
+		case plain.MechName:
+			return plain.NewServerMech(userPassVerifier, nil)
+		case scramsha1.MechName:
+			return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name      string
+		client    sasl.ClientMech
+		clientErr string
+		serverErr string
+	}{
+		{"plain", plain.NewClientMech("", "jack", "mcjack"), "", ""},
+		{"plain-wrong", plain.NewClientMech("", "jack", "wrong"),
+			"ldap: bind failed with result code 49: SASL authentication failed",
+			"invalid username or password"},
+		{"scram", scramsha1.NewClientMech("", "jack", "mcjack", 16, mr), "", ""},
+		{"scram-wrong", scramsha1.NewClientMech("", "jack", "wrong", 16, mr),
+			"ldap: bind failed with result code 49: SASL authentication failed",
+			"invalid response: client key mismatch"},
+		{"unsupported", &testhelpers.FailingClientMech{},
+			"ldap: bind failed with result code 7: sasl mechanism FAIL is not supported",
+			"ldap: bind failed with result code 7: sasl mechanism FAIL is not supported"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := directory.Dial()
+			defer conn.Close()
+
+			before := len(directory.Errors())
+			_, err := ldap.Bind(context.Background(), conn, 1, "", test.client)
+			testhelpers.VerifyError(t, "client", test.clientErr, err)
+
+			var serverErr error
+			if errs := directory.Errors(); len(errs) > before {
+				serverErr = errs[len(errs)-1]
+			}
+			testhelpers.VerifyError(t, "server", test.serverErr, serverErr)
+		})
+	}
+}
+
+func TestBindRequestEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	err := ldap.WriteBindRequest(&buf, &ldap.BindRequest{MessageID: 1, Version: 3, Mechanism: "PLAIN"})
+	if err != nil {
+		t.Fatalf("unable to write bind request: %v", err)
+	}
+
+	expected := "3013020101600e0201030400a3070405504c41494e"
+	if actual := hex.EncodeToString(buf.Bytes()); actual != expected {
+		t.Fatalf("expected encoding %s, but got %s", expected, actual)
+	}
+
+	creds := bytes.Repeat([]byte{'x'}, 300)
+	if err = ldap.WriteBindRequest(&buf, &ldap.BindRequest{MessageID: 200, Version: 3, Name: "cn=jack", Mechanism: "X", Credentials: creds}); err != nil {
+		t.Fatalf("unable to write bind request: %v", err)
+	}
+
+	for _, expected := range []*ldap.BindRequest{
+		{MessageID: 1, Version: 3, Mechanism: "PLAIN"},
+		{MessageID: 200, Version: 3, Name: "cn=jack", Mechanism: "X", Credentials: creds},
+	} {
+		msg, err := ldap.ReadMessage(&buf)
+		if err != nil {
+			t.Fatalf("unable to read message: %v", err)
+		}
+
+		req, err := msg.BindRequest()
+		if err != nil {
+			t.Fatalf("unable to decode bind request: %v", err)
+		}
+
+		if req.MessageID != expected.MessageID || req.Version != expected.Version || req.Name != expected.Name ||
+			req.Mechanism != expected.Mechanism || !bytes.Equal(req.Credentials, expected.Credentials) {
+			t.Fatalf("expected %+v, but got %+v", expected, req)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Package ldaptest provides an in-memory LDAP directory for testing SASL binds.
+package ldaptest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/craiggwilson/go-sasl/ldap"
+)
+
+// NewDirectory creates a Directory that hosts the mechanisms returned by
+// provider.
+func NewDirectory(provider ldap.ServerMechProvider) *Directory {
+	return &Directory{
+		provider: provider,
+	}
+}
+
+// Directory is an in-memory LDAP server that only implements bind and unbind.
+type Directory struct {
+	provider ldap.ServerMechProvider
+
+	mu     sync.Mutex
+	errors []error
+}
+
+// Dial returns a client connection to a new session with the directory.
+func (d *Directory) Dial() net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		d.Serve(context.Background(), server)
+	}()
+	return client
+}
+
+// Errors returns the errors reported by failed binds, in order.
+func (d *Directory) Errors() []error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]error{}, d.errors...)
+}
+
+// Serve handles the messages of a single session until the client unbinds or
+// the connection is closed.
+func (d *Directory) Serve(ctx context.Context, rw io.ReadWriter) error {
+	r := bufio.NewReader(rw)
+	binder := ldap.NewBinder(d.provider)
+	for {
+		msg, err := ldap.ReadMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch msg.Op {
+		case ldap.OpBindRequest:
+			req, err := msg.BindRequest()
+			if err != nil {
+				return err
+			}
+
+			resp, err := binder.Bind(ctx, req)
+			if err != nil {
+				d.mu.Lock()
+				d.errors = append(d.errors, err)
+				d.mu.Unlock()
+			}
+
+			if err = ldap.WriteBindResponse(rw, resp); err != nil {
+				return err
+			}
+		case ldap.OpUnbindRequest:
+			return nil
+		default:
+			return fmt.Errorf("ldaptest: unsupported operation %d", msg.Op)
+		}
+	}
+}
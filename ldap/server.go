@@ -0,0 +1,86 @@
+package ldap
+
+import (
+	"context"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ServerMechProvider returns a new server mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ServerMechProvider func(mechName string) sasl.ServerMech
+
+// NewBinder creates a Binder.
+func NewBinder(provider ServerMechProvider) *Binder {
+	return &Binder{
+		provider: provider,
+	}
+}
+
+// Binder hosts server mechanisms for the SASL binds received on a single
+// connection. Each step of an exchange arrives as a separate BindRequest, so
+// the Binder keeps the in-progress mechanism between calls.
+type Binder struct {
+	provider ServerMechProvider
+
+	// state
+	mech     sasl.ServerMech
+	mechName string
+}
+
+// Mech returns the mechanism of the current or most recently completed
+// exchange, or nil if the last bind failed.
+func (b *Binder) Mech() sasl.ServerMech {
+	return b.mech
+}
+
+// Bind processes a BindRequest and returns the BindResponse to send. A request
+// naming a different mechanism than the one in progress starts a new
+// exchange, as described by RFC4513. The error is non-nil when the bind
+// failed, in which case the response carries the corresponding result code.
+func (b *Binder) Bind(ctx context.Context, req *BindRequest) (*BindResponse, error) {
+	resp := &BindResponse{MessageID: req.MessageID}
+
+	if req.Mechanism == "" {
+		b.mech = nil
+		resp.ResultCode = AuthMethodNotSupported
+		resp.DiagnosticMessage = "simple binds are not supported"
+		return resp, &ResultError{ResultCode: resp.ResultCode, DiagnosticMessage: resp.DiagnosticMessage}
+	}
+
+	var challenge []byte
+	var err error
+	if b.mech == nil || b.mech.Completed() || req.Mechanism != b.mechName {
+		b.mech = b.provider(req.Mechanism)
+		b.mechName = req.Mechanism
+		if b.mech == nil {
+			resp.ResultCode = AuthMethodNotSupported
+			resp.DiagnosticMessage = "sasl mechanism " + req.Mechanism + " is not supported"
+			return resp, &ResultError{ResultCode: resp.ResultCode, DiagnosticMessage: resp.DiagnosticMessage}
+		}
+		_, challenge, err = b.mech.Start(ctx, req.Credentials)
+	} else {
+		challenge, err = b.mech.Next(ctx, req.Credentials)
+	}
+
+	switch {
+	case err != nil:
+		b.mech = nil
+		resp.ResultCode = InvalidCredentials
+		resp.DiagnosticMessage = "SASL authentication failed"
+		return resp, err
+	case b.mech.Completed():
+		resp.ResultCode = Success
+		if len(challenge) > 0 {
+			resp.ServerSaslCreds = challenge
+		}
+	default:
+		resp.ResultCode = SaslBindInProgress
+		resp.ServerSaslCreds = challenge
+		if resp.ServerSaslCreds == nil {
+			resp.ServerSaslCreds = []byte{}
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,89 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ListMechanisms sends a SASL List Mechs request and returns the mechanisms
+// offered by the server.
+func ListMechanisms(ctx context.Context, rw io.ReadWriter) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := WritePacket(rw, &Packet{Magic: MagicRequest, Opcode: OpSASLListMechs}); err != nil {
+		return nil, err
+	}
+
+	resp, err := readResponse(rw, OpSASLListMechs)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != StatusNoError {
+		return nil, &StatusError{Status: resp.Status, Message: string(resp.Value)}
+	}
+	return strings.Fields(string(resp.Value)), nil
+}
+
+// Authenticate conducts SASL authentication as a client using mech.
+func Authenticate(ctx context.Context, rw io.ReadWriter, mech sasl.ClientMech) error {
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("memcached: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	opcode := OpSASLAuth
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if err = WritePacket(rw, &Packet{Magic: MagicRequest, Opcode: opcode, Key: []byte(mechName), Value: response}); err != nil {
+			return err
+		}
+
+		resp, err := readResponse(rw, opcode)
+		if err != nil {
+			return err
+		}
+
+		switch resp.Status {
+		case StatusAuthContinue:
+			if response, err = mech.Next(ctx, resp.Value); err != nil {
+				return fmt.Errorf("memcached: sasl mechanism %s: client failed to provide response: %v", mechName, err)
+			}
+			opcode = OpSASLStep
+		case StatusNoError:
+			// Servers backed by Cyrus SASL answer a completed exchange with
+			// the text "Authenticated", so the value is only handed to a
+			// mechanism still expecting the server's final message.
+			if !mech.Completed() {
+				if _, err = mech.Next(ctx, resp.Value); err != nil {
+					return fmt.Errorf("memcached: sasl mechanism %s: unable to verify server: %v", mechName, err)
+				}
+			}
+			if !mech.Completed() {
+				return fmt.Errorf("memcached: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return nil
+		default:
+			return &StatusError{Status: resp.Status, Message: string(resp.Value)}
+		}
+	}
+}
+
+func readResponse(r io.Reader, opcode byte) (*Packet, error) {
+	resp, err := ReadPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Magic != MagicResponse || resp.Opcode != opcode {
+		return nil, fmt.Errorf("memcached: expected response to opcode 0x%02x, but got 0x%02x", opcode, resp.Opcode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,109 @@
+// Package memcached runs SASL mechanisms over the memcached binary protocol's
+// SASL List Mechs, SASL Auth and SASL Step commands
+// (https://github.com/memcached/memcached/wiki/SASLAuthProtocol).
+package memcached
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Magic bytes identifying request and response packets.
+const (
+	MagicRequest  byte = 0x80
+	MagicResponse byte = 0x81
+)
+
+// Opcodes of the SASL commands.
+const (
+	OpSASLListMechs byte = 0x20
+	OpSASLAuth      byte = 0x21
+	OpSASLStep      byte = 0x22
+)
+
+// Response status codes used during authentication.
+const (
+	StatusNoError      uint16 = 0x0000
+	StatusAuthError    uint16 = 0x0020
+	StatusAuthContinue uint16 = 0x0021
+	StatusUnknownCmd   uint16 = 0x0081
+)
+
+const headerLen = 24
+
+// maxBodyLen bounds the size of a single packet body read from the wire.
+const maxBodyLen = 1 << 20
+
+// Packet is a single request or response packet. Status is only meaningful
+// for responses.
+type Packet struct {
+	Magic  byte
+	Opcode byte
+	Status uint16
+	Opaque uint32
+	Key    []byte
+	Value  []byte
+}
+
+// ReadPacket reads a single packet from r. Extras are discarded, as none of
+// the SASL commands use them.
+func ReadPacket(r io.Reader) (*Packet, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	p := &Packet{
+		Magic:  header[0],
+		Opcode: header[1],
+		Opaque: binary.BigEndian.Uint32(header[12:]),
+	}
+	if p.Magic != MagicRequest && p.Magic != MagicResponse {
+		return nil, fmt.Errorf("memcached: invalid magic byte 0x%02x", p.Magic)
+	}
+	if p.Magic == MagicResponse {
+		p.Status = binary.BigEndian.Uint16(header[6:])
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(header[2:]))
+	extrasLen := int(header[4])
+	bodyLen := binary.BigEndian.Uint32(header[8:])
+	if bodyLen > maxBodyLen || int(bodyLen) < keyLen+extrasLen {
+		return nil, fmt.Errorf("memcached: invalid body length %d", bodyLen)
+	}
+
+	body := make([]byte, bodyLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	p.Key = body[extrasLen : extrasLen+keyLen]
+	p.Value = body[extrasLen+keyLen:]
+	return p, nil
+}
+
+// WritePacket writes a single packet to w.
+func WritePacket(w io.Writer, p *Packet) error {
+	b := make([]byte, headerLen, headerLen+len(p.Key)+len(p.Value))
+	b[0] = p.Magic
+	b[1] = p.Opcode
+	binary.BigEndian.PutUint16(b[2:], uint16(len(p.Key)))
+	if p.Magic == MagicResponse {
+		binary.BigEndian.PutUint16(b[6:], p.Status)
+	}
+	binary.BigEndian.PutUint32(b[8:], uint32(len(p.Key)+len(p.Value)))
+	binary.BigEndian.PutUint32(b[12:], p.Opaque)
+	b = append(append(b, p.Key...), p.Value...)
+	_, err := w.Write(b)
+	return err
+}
+
+// StatusError is a response carrying an error status.
+type StatusError struct {
+	Status  uint16
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("memcached: status 0x%04x: %s", e.Status, e.Message)
+}
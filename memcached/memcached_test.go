@@ -0,0 +1,95 @@
+package memcached_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/memcached"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+func TestAuthenticate(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{
+			Salt:       []byte("blah"),
+			Iterations: 100,
+			StoredKey:  storedKey,
+			ServerKey:  serverKey,
+		}, nil
+	}
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	server := memcached.NewServer([]string{scramsha1.MechName, plain.MechName}, func(mechName string) sasl.ServerMech {
+		switch mechName {
+		case plain.MechName:
+			return plain.NewServerMech(userPassVerifier, nil)
+		case scramsha1.MechName:
+			return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name      string
+		mech      sasl.ClientMech
+		clientErr string
+		serverErr string
+	}{
+		{"plain", plain.NewClientMech("", "jack", "mcjack"), "", ""},
+		{"plain-wrong", plain.NewClientMech("", "jack", "wrong"),
+			"memcached: status 0x0020: Auth failure",
+			"memcached: sasl mechanism PLAIN: invalid username or password"},
+		{"scram", scramsha1.NewClientMech("", "jack", "mcjack", 16, mr), "", ""},
+		{"scram-wrong", scramsha1.NewClientMech("", "jack", "wrong", 16, mr),
+			"memcached: status 0x0020: Auth failure",
+			"memcached: sasl mechanism SCRAM-SHA-1: invalid response: client key mismatch"},
+		{"unsupported", &testhelpers.FailingClientMech{},
+			"memcached: status 0x0020: Auth failure",
+			"memcached: sasl mechanism FAIL is not supported"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				defer serverConn.Close()
+				_, err := server.Authenticate(context.Background(), serverConn, nil)
+				serverErr <- err
+			}()
+
+			mechanisms, err := memcached.ListMechanisms(context.Background(), clientConn)
+			if err != nil {
+				t.Fatalf("unable to list mechanisms: %v", err)
+			}
+			if len(mechanisms) != 2 || mechanisms[0] != scramsha1.MechName {
+				t.Fatalf("expected the server's mechanisms, but got %v", mechanisms)
+			}
+
+			clientErr := memcached.Authenticate(context.Background(), clientConn, test.mech)
+			clientConn.Close()
+
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, <-serverErr)
+		})
+	}
+}
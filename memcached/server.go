@@ -0,0 +1,122 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ServerMechProvider returns a new server mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ServerMechProvider func(mechName string) sasl.ServerMech
+
+// NewServer creates a Server offering the named mechanisms.
+func NewServer(mechanisms []string, provider ServerMechProvider) *Server {
+	return &Server{
+		mechanisms: mechanisms,
+		provider:   provider,
+	}
+}
+
+// Server conducts authentication on the server side of a connection.
+type Server struct {
+	mechanisms []string
+	provider   ServerMechProvider
+}
+
+// Authenticate handles SASL List Mechs and SASL Auth requests followed by
+// SASL Step requests until the exchange completes. If the caller's request
+// loop has already read the first SASL request it is passed as req; otherwise
+// req is nil and the request is read from rw. The completed mechanism is
+// returned so the caller can inspect the authenticated identity.
+func (s *Server) Authenticate(ctx context.Context, rw io.ReadWriter, req *Packet) (sasl.ServerMech, error) {
+	var err error
+	if req == nil {
+		if req, err = ReadPacket(rw); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Opcode == OpSASLListMechs {
+		if err = reply(rw, req, StatusNoError, []byte(strings.Join(s.mechanisms, " "))); err != nil {
+			return nil, err
+		}
+		if req, err = ReadPacket(rw); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Opcode != OpSASLAuth {
+		reply(rw, req, StatusUnknownCmd, []byte("Unknown command"))
+		return nil, fmt.Errorf("memcached: expected SASL Auth request, but got opcode 0x%02x", req.Opcode)
+	}
+
+	mechName := string(req.Key)
+	var mech sasl.ServerMech
+	if s.supports(mechName) {
+		mech = s.provider(mechName)
+	}
+	if mech == nil {
+		reply(rw, req, StatusAuthError, []byte("Auth failure"))
+		return nil, fmt.Errorf("memcached: sasl mechanism %s is not supported", mechName)
+	}
+
+	_, challenge, err := mech.Start(ctx, req.Value)
+	for {
+		if err != nil {
+			reply(rw, req, StatusAuthError, []byte("Auth failure"))
+			return nil, fmt.Errorf("memcached: sasl mechanism %s: %v", mechName, err)
+		}
+
+		if mech.Completed() {
+			break
+		}
+
+		if err = reply(rw, req, StatusAuthContinue, challenge); err != nil {
+			return nil, err
+		}
+
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if req, err = ReadPacket(rw); err != nil {
+			return nil, err
+		}
+		if req.Opcode != OpSASLStep || string(req.Key) != mechName {
+			reply(rw, req, StatusAuthError, []byte("Auth failure"))
+			return nil, fmt.Errorf("memcached: expected SASL Step request for %s", mechName)
+		}
+
+		challenge, err = mech.Next(ctx, req.Value)
+	}
+
+	if challenge == nil {
+		challenge = []byte("Authenticated")
+	}
+	if err = reply(rw, req, StatusNoError, challenge); err != nil {
+		return nil, err
+	}
+	return mech, nil
+}
+
+func (s *Server) supports(mechName string) bool {
+	for _, name := range s.mechanisms {
+		if name == mechName {
+			return true
+		}
+	}
+	return false
+}
+
+func reply(w io.Writer, req *Packet, status uint16, value []byte) error {
+	return WritePacket(w, &Packet{
+		Magic:  MagicResponse,
+		Opcode: req.Opcode,
+		Status: status,
+		Opaque: req.Opaque,
+		Value:  value,
+	})
+}
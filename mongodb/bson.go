@@ -0,0 +1,164 @@
+package mongodb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Document is an ordered BSON document. Values may be of type float64,
+// string, Document, []byte (generic binary), bool, int32 or int64.
+type Document []Element
+
+// Element is a single key/value pair of a Document.
+type Element struct {
+	Key   string
+	Value interface{}
+}
+
+// Lookup returns the value of the first element with the given key.
+func (d Document) Lookup(key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// MarshalBSON encodes the document.
+func (d Document) MarshalBSON() ([]byte, error) {
+	return d.appendBSON(nil)
+}
+
+func (d Document) appendBSON(b []byte) ([]byte, error) {
+	start := len(b)
+	b = append(b, 0, 0, 0, 0)
+	for _, e := range d {
+		var err error
+		if b, err = appendElement(b, e); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, 0)
+	binary.LittleEndian.PutUint32(b[start:], uint32(len(b)-start))
+	return b, nil
+}
+
+func appendElement(b []byte, e Element) ([]byte, error) {
+	key := append([]byte(e.Key), 0)
+	switch v := e.Value.(type) {
+	case float64:
+		b = append(append(b, 0x01), key...)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(v)), nil
+	case string:
+		b = append(append(b, 0x02), key...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(v)+1))
+		return append(append(b, v...), 0), nil
+	case Document:
+		b = append(append(b, 0x03), key...)
+		return v.appendBSON(b)
+	case []byte:
+		b = append(append(b, 0x05), key...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(v)))
+		return append(append(b, 0x00), v...), nil
+	case bool:
+		b = append(append(b, 0x08), key...)
+		if v {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case int32:
+		b = append(append(b, 0x10), key...)
+		return binary.LittleEndian.AppendUint32(b, uint32(v)), nil
+	case int64:
+		b = append(append(b, 0x12), key...)
+		return binary.LittleEndian.AppendUint64(b, uint64(v)), nil
+	default:
+		return nil, fmt.Errorf("mongodb: unsupported value of type %T for key %q", e.Value, e.Key)
+	}
+}
+
+var errTruncated = errors.New("mongodb: truncated document")
+
+// UnmarshalDocument decodes a BSON document.
+func UnmarshalDocument(b []byte) (Document, error) {
+	if len(b) < 5 {
+		return nil, errTruncated
+	}
+
+	n := int(binary.LittleEndian.Uint32(b))
+	if n < 5 || n > len(b) || b[n-1] != 0 {
+		return nil, errTruncated
+	}
+
+	b = b[4 : n-1]
+	d := Document{}
+	for len(b) > 0 {
+		t := b[0]
+		end := bytes.IndexByte(b[1:], 0)
+		if end < 0 {
+			return nil, errTruncated
+		}
+		key := string(b[1 : 1+end])
+		b = b[2+end:]
+
+		var v interface{}
+		var size int
+		switch t {
+		case 0x01:
+			if len(b) < 8 {
+				return nil, errTruncated
+			}
+			v, size = math.Float64frombits(binary.LittleEndian.Uint64(b)), 8
+		case 0x02:
+			if len(b) < 4 {
+				return nil, errTruncated
+			}
+			l := int(binary.LittleEndian.Uint32(b))
+			if l < 1 || 4+l > len(b) {
+				return nil, errTruncated
+			}
+			v, size = string(b[4:4+l-1]), 4+l
+		case 0x03:
+			sub, err := UnmarshalDocument(b)
+			if err != nil {
+				return nil, err
+			}
+			v, size = sub, int(binary.LittleEndian.Uint32(b))
+		case 0x05:
+			if len(b) < 5 {
+				return nil, errTruncated
+			}
+			l := int(binary.LittleEndian.Uint32(b))
+			if l < 0 || 5+l > len(b) {
+				return nil, errTruncated
+			}
+			v, size = append([]byte{}, b[5:5+l]...), 5+l
+		case 0x08:
+			if len(b) < 1 {
+				return nil, errTruncated
+			}
+			v, size = b[0] != 0, 1
+		case 0x10:
+			if len(b) < 4 {
+				return nil, errTruncated
+			}
+			v, size = int32(binary.LittleEndian.Uint32(b)), 4
+		case 0x12:
+			if len(b) < 8 {
+				return nil, errTruncated
+			}
+			v, size = int64(binary.LittleEndian.Uint64(b)), 8
+		default:
+			return nil, fmt.Errorf("mongodb: unsupported BSON type 0x%02x for key %q", t, key)
+		}
+
+		d = append(d, Element{Key: key, Value: v})
+		b = b[size:]
+	}
+
+	return d, nil
+}
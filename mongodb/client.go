@@ -0,0 +1,127 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Authenticate conducts the saslStart and saslContinue commands as a client
+// against the database db, which is usually "admin" or "$external".
+func Authenticate(ctx context.Context, run CommandRunner, db string, mech sasl.ClientMech) error {
+	c, err := newConversation(ctx, db, mech)
+	if err != nil {
+		return err
+	}
+
+	return c.start(ctx, run)
+}
+
+// Conversation is an authentication exchange started speculatively within
+// the hello command.
+type Conversation struct {
+	db       string
+	mech     sasl.ClientMech
+	mechName string
+	payload  []byte
+}
+
+// StartSpeculative begins an exchange to embed in the initial hello command.
+// The returned document is sent as the speculativeAuthenticate field of hello,
+// and the exchange is then completed with Conversation.Finish.
+func StartSpeculative(ctx context.Context, db string, mech sasl.ClientMech) (*Conversation, Document, error) {
+	c, err := newConversation(ctx, db, mech)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd := append(c.saslStart(), Element{Key: "db", Value: db})
+	return c, cmd, nil
+}
+
+// Finish completes a speculative exchange given the speculativeAuthenticate
+// field of the hello reply. When the server did not accept the speculative
+// attempt, reply is nil and the exchange starts over with saslStart.
+func (c *Conversation) Finish(ctx context.Context, run CommandRunner, reply Document) error {
+	if reply == nil {
+		return c.start(ctx, run)
+	}
+
+	return c.converse(ctx, run, reply)
+}
+
+func newConversation(ctx context.Context, db string, mech sasl.ClientMech) (*Conversation, error) {
+	mechName, payload, err := mech.Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("mongodb: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	return &Conversation{
+		db:       db,
+		mech:     mech,
+		mechName: mechName,
+		payload:  payload,
+	}, nil
+}
+
+func (c *Conversation) saslStart() Document {
+	payload := c.payload
+	if payload == nil {
+		payload = []byte{}
+	}
+
+	return Document{
+		{Key: "saslStart", Value: int32(1)},
+		{Key: "mechanism", Value: c.mechName},
+		{Key: "payload", Value: payload},
+		{Key: "autoAuthorize", Value: int32(1)},
+		{Key: "options", Value: Document{{Key: "skipEmptyExchange", Value: true}}},
+	}
+}
+
+func (c *Conversation) start(ctx context.Context, run CommandRunner) error {
+	reply, err := run(ctx, c.db, c.saslStart())
+	if err != nil {
+		return err
+	}
+
+	return c.converse(ctx, run, reply)
+}
+
+func (c *Conversation) converse(ctx context.Context, run CommandRunner, reply Document) error {
+	for {
+		r, err := parseReply(reply)
+		if err != nil {
+			return err
+		}
+
+		var payload []byte
+		if len(r.payload) > 0 || !c.mech.Completed() {
+			payload, err = c.mech.Next(ctx, r.payload)
+			if err != nil {
+				return fmt.Errorf("mongodb: sasl mechanism %s: client failed to provide response: %v", c.mechName, err)
+			}
+		}
+
+		if r.done {
+			if !c.mech.Completed() {
+				return fmt.Errorf("mongodb: sasl mechanism %s: server completed the exchange before the client", c.mechName)
+			}
+			return nil
+		}
+
+		if payload == nil {
+			payload = []byte{}
+		}
+
+		cmd := Document{
+			{Key: "saslContinue", Value: int32(1)},
+			{Key: "conversationId", Value: r.conversationID},
+			{Key: "payload", Value: payload},
+		}
+		if reply, err = run(ctx, c.db, cmd); err != nil {
+			return err
+		}
+	}
+}
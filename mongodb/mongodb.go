@@ -0,0 +1,87 @@
+// Package mongodb runs SASL mechanisms over the MongoDB saslStart and
+// saslContinue commands, including speculative authentication within the
+// initial hello command.
+package mongodb
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// CommandRunner runs cmd against the database db and returns the server's
+// reply. Drivers implement it on top of their own wire protocol.
+type CommandRunner func(ctx context.Context, db string, cmd Document) (Document, error)
+
+// CommandError is returned when the server replies with ok: 0.
+type CommandError struct {
+	Code    int32
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("mongodb: command failed with code %d: %s", e.Code, e.Message)
+}
+
+// PasswordDigest returns the password to use with SCRAM-SHA-1, which MongoDB
+// defines as the hex encoded MD5 digest of "<username>:mongo:<password>".
+func PasswordDigest(username, password string) string {
+	h := md5.New()
+	io.WriteString(h, username+":mongo:"+password)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// saslReply holds the fields of a saslStart or saslContinue reply.
+type saslReply struct {
+	conversationID int32
+	done           bool
+	payload        []byte
+}
+
+func parseReply(reply Document) (*saslReply, error) {
+	if ok, _ := reply.Lookup("ok"); !isTrue(ok) {
+		e := &CommandError{}
+		if code, found := reply.Lookup("code"); found {
+			e.Code, _ = code.(int32)
+		}
+		if msg, found := reply.Lookup("errmsg"); found {
+			e.Message, _ = msg.(string)
+		}
+		return nil, e
+	}
+
+	r := &saslReply{}
+	id, _ := reply.Lookup("conversationId")
+	switch v := id.(type) {
+	case int32:
+		r.conversationID = v
+	case int64:
+		r.conversationID = int32(v)
+	default:
+		return nil, fmt.Errorf("mongodb: reply is missing conversationId")
+	}
+
+	done, _ := reply.Lookup("done")
+	r.done, _ = done.(bool)
+
+	payload, _ := reply.Lookup("payload")
+	r.payload, _ = payload.([]byte)
+
+	return r, nil
+}
+
+func isTrue(v interface{}) bool {
+	switch v := v.(type) {
+	case float64:
+		return v == 1
+	case int32:
+		return v == 1
+	case int64:
+		return v == 1
+	case bool:
+		return v
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package mongodb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/mongodb"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+func userPassVerifier(_ context.Context, username, password string) error {
+	if username != "jack" || password != "mcjack" {
+		return errors.New("invalid username or password")
+	}
+	return nil
+}
+
+func storedUserProvider(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+	_, storedKey, serverKey := scramsha1.GenerateKeys(mongodb.PasswordDigest("jack", "mcjack"), []byte("blah"), 100)
+	return &scramsha1.StoredUser{
+		Salt:       []byte("blah"),
+		Iterations: 100,
+		StoredKey:  storedKey,
+		ServerKey:  serverKey,
+	}, nil
+}
+
+// fakeServer implements the server side of saslStart and saslContinue the way
+// mongod does, including the skipEmptyExchange option.
+type fakeServer struct {
+	mechs         func(mechName string) sasl.ServerMech
+	conversations map[int32]*fakeConversation
+	err           error
+}
+
+type fakeConversation struct {
+	mech      sasl.ServerMech
+	skipEmpty bool
+}
+
+func newFakeServer(mr *rand.Rand) *fakeServer {
+	return &fakeServer{
+		mechs: func(mechName string) sasl.ServerMech {
+			switch mechName {
+			case plain.MechName:
+				return plain.NewServerMech(userPassVerifier, nil)
+			case scramsha1.MechName:
+				return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+			}
+			return nil
+		},
+		conversations: make(map[int32]*fakeConversation),
+	}
+}
+
+func (s *fakeServer) run(ctx context.Context, db string, cmd mongodb.Document) (mongodb.Document, error) {
+	// round trip through the wire encoding.
+	b, err := cmd.MarshalBSON()
+	if err != nil {
+		return nil, err
+	}
+	if cmd, err = mongodb.UnmarshalDocument(b); err != nil {
+		return nil, err
+	}
+
+	payload, _ := cmd.Lookup("payload")
+	var challenge []byte
+	var c *fakeConversation
+	var id int32
+	switch cmd[0].Key {
+	case "saslStart":
+		mechName, _ := cmd.Lookup("mechanism")
+		mech := s.mechs(mechName.(string))
+		if mech == nil {
+			return errorReply(2, "unsupported mechanism"), nil
+		}
+		c = &fakeConversation{mech: mech}
+		if options, ok := cmd.Lookup("options"); ok {
+			skip, _ := options.(mongodb.Document).Lookup("skipEmptyExchange")
+			c.skipEmpty, _ = skip.(bool)
+		}
+		id = int32(len(s.conversations) + 1)
+		s.conversations[id] = c
+		_, challenge, err = mech.Start(ctx, payload.([]byte))
+	case "saslContinue":
+		v, _ := cmd.Lookup("conversationId")
+		id = v.(int32)
+		c = s.conversations[id]
+		if c.mech.Completed() {
+			break
+		}
+		challenge, err = c.mech.Next(ctx, payload.([]byte))
+	default:
+		return nil, fmt.Errorf("unexpected command %s", cmd[0].Key)
+	}
+
+	if err != nil {
+		s.err = err
+		return errorReply(18, "Authentication failed."), nil
+	}
+
+	if challenge == nil {
+		challenge = []byte{}
+	}
+
+	// without skipEmptyExchange, the client must send an extra empty
+	// saslContinue after the final challenge.
+	done := c.mech.Completed() && (c.skipEmpty || len(challenge) == 0)
+	return mongodb.Document{
+		{Key: "conversationId", Value: id},
+		{Key: "done", Value: done},
+		{Key: "payload", Value: challenge},
+		{Key: "ok", Value: float64(1)},
+	}, nil
+}
+
+func errorReply(code int32, msg string) mongodb.Document {
+	return mongodb.Document{
+		{Key: "ok", Value: float64(0)},
+		{Key: "errmsg", Value: msg},
+		{Key: "code", Value: code},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		name      string
+		client    sasl.ClientMech
+		noSkip    bool
+		clientErr string
+		serverErr string
+	}{
+		{"plain", plain.NewClientMech("", "jack", "mcjack"), false, "", ""},
+		{"plain-wrong", plain.NewClientMech("", "jack", "wrong"), false,
+			"mongodb: command failed with code 18: Authentication failed.",
+			"invalid username or password"},
+		{"scram", scramsha1.NewClientMech("", "jack", mongodb.PasswordDigest("jack", "mcjack"), 16, mr), false, "", ""},
+		{"scram-no-skip", scramsha1.NewClientMech("", "jack", mongodb.PasswordDigest("jack", "mcjack"), 16, mr), true, "", ""},
+		{"scram-wrong", scramsha1.NewClientMech("", "jack", mongodb.PasswordDigest("jack", "wrong"), 16, mr), false,
+			"mongodb: command failed with code 18: Authentication failed.",
+			"invalid response: client key mismatch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(mr)
+			run := server.run
+			if test.noSkip {
+				run = func(ctx context.Context, db string, cmd mongodb.Document) (mongodb.Document, error) {
+					if cmd[0].Key == "saslStart" {
+						cmd = cmd[:len(cmd)-1]
+					}
+					return server.run(ctx, db, cmd)
+				}
+			}
+
+			err := mongodb.Authenticate(context.Background(), run, "admin", test.client)
+			testhelpers.VerifyError(t, "client", test.clientErr, err)
+			testhelpers.VerifyError(t, "server", test.serverErr, server.err)
+		})
+	}
+}
+
+func TestSpeculativeAuthentication(t *testing.T) {
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	for _, accepted := range []bool{true, false} {
+		t.Run(fmt.Sprintf("accepted=%v", accepted), func(t *testing.T) {
+			server := newFakeServer(mr)
+			mech := scramsha1.NewClientMech("", "jack", mongodb.PasswordDigest("jack", "mcjack"), 16, mr)
+
+			conversation, speculative, err := mongodb.StartSpeculative(context.Background(), "admin", mech)
+			if err != nil {
+				t.Fatalf("unable to start speculative authentication: %v", err)
+			}
+
+			if db, _ := speculative.Lookup("db"); db != "admin" {
+				t.Fatalf("expected the speculative document to name db admin, but got %v", db)
+			}
+
+			var reply mongodb.Document
+			if accepted {
+				if reply, err = server.run(context.Background(), "admin", speculative); err != nil {
+					t.Fatalf("unable to run speculative saslStart: %v", err)
+				}
+			}
+
+			err = conversation.Finish(context.Background(), server.run, reply)
+			testhelpers.VerifyError(t, "client", "", err)
+			testhelpers.VerifyError(t, "server", "", server.err)
+			if len(server.conversations) != 1 {
+				t.Fatalf("expected a single conversation, but got %d", len(server.conversations))
+			}
+		})
+	}
+}
@@ -3,30 +3,56 @@ package plain
 import (
 	"context"
 	"fmt"
+
+	"github.com/craiggwilson/go-sasl"
 )
 
 // NewClientMech creates a ClientMech.
 func NewClientMech(authz, username, password string) *ClientMech {
 	return &ClientMech{
 		username: username,
-		password: password,
+		password: []byte(password),
 		authz:    authz,
 	}
 }
 
+// NewClientMechWithProvider creates a ClientMech obtaining its credentials
+// from provider when the exchange starts.
+func NewClientMechWithProvider(provider sasl.CredentialProvider) *ClientMech {
+	return &ClientMech{
+		provider: provider,
+	}
+}
+
 // ClientMech implements the client side portion of ANONYMOUS.
 type ClientMech struct {
 	username string
-	password string
+	password []byte
 	authz    string
+	provider sasl.CredentialProvider
 
 	// state
 	done bool
 }
 
 // Start initializes the mechanism and begins the authentication exchange.
-func (m *ClientMech) Start(_ context.Context) (string, []byte, error) {
-	resp := []byte(m.authz + "\x00" + m.username + "\x00" + m.password)
+func (m *ClientMech) Start(ctx context.Context) (string, []byte, error) {
+	if m.provider != nil {
+		cred, err := m.provider(ctx, &sasl.CredentialRequest{
+			Mechanism: MechName,
+			Types:     sasl.CredentialUsername | sasl.CredentialPassword,
+			Prompt:    "Username and password",
+		})
+		if err != nil {
+			return MechName, nil, fmt.Errorf("unable to obtain credentials: %w", err)
+		}
+		m.authz, m.username, m.password = cred.Authz, cred.Username, cred.Password
+	}
+
+	resp := make([]byte, 0, len(m.authz)+len(m.username)+len(m.password)+2)
+	resp = append(resp, m.authz+"\x00"+m.username+"\x00"...)
+	resp = append(resp, m.password...)
+	m.Dispose()
 	return MechName, resp, nil
 }
 
@@ -45,3 +71,9 @@ func (m *ClientMech) Next(_ context.Context, _ []byte) ([]byte, error) {
 func (m *ClientMech) Completed() bool {
 	return true
 }
+
+// Dispose wipes the password. The response returned by Start, which carries
+// the password as well, belongs to the caller.
+func (m *ClientMech) Dispose() {
+	clear(m.password)
+}
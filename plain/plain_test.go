@@ -1,11 +1,13 @@
 package plain_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/craiggwilson/go-sasl"
 	"github.com/craiggwilson/go-sasl/internal/testhelpers"
 	"github.com/craiggwilson/go-sasl/plain"
 )
@@ -50,3 +52,49 @@ func TestPlainMech(t *testing.T) {
 		})
 	}
 }
+
+func TestPlainMechWithProvider(t *testing.T) {
+
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name      string
+		cred      *sasl.Credential
+		clientErr string
+		serverErr string
+	}{
+		{"valid", &sasl.Credential{Username: "jack", Password: []byte("mcjack")}, "", ""},
+		{"wrong", &sasl.Credential{Username: "jack", Password: []byte("wrong")}, "context canceled", "sasl mechanism PLAIN: unable to start exchange: invalid username or password"},
+		{"canceled", nil, "sasl mechanism PLAIN: unable to start exchange: unable to obtain credentials: sasl: credential request canceled", "context canceled"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := func(_ context.Context, req *sasl.CredentialRequest) (*sasl.Credential, error) {
+				if req.Mechanism != plain.MechName || req.Types != sasl.CredentialUsername|sasl.CredentialPassword {
+					t.Errorf("unexpected credential request %+v", req)
+				}
+				if test.cred == nil {
+					return nil, sasl.ErrCanceled
+				}
+				return test.cred, nil
+			}
+
+			testhelpers.RunClientServerTest(t,
+				plain.NewClientMechWithProvider(provider),
+				plain.NewServerMech(userPassVerifier, nil),
+				test.clientErr,
+				test.serverErr,
+			)
+
+			if test.cred != nil && !bytes.Equal(test.cred.Password, make([]byte, len(test.cred.Password))) {
+				t.Fatalf("expected the provided password to be wiped, but got %q", test.cred.Password)
+			}
+		})
+	}
+}
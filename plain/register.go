@@ -0,0 +1,32 @@
+package plain
+
+import "github.com/craiggwilson/go-sasl"
+
+func init() {
+	sasl.RegisterServerMech(MechName, sasl.MechStrengthPlaintext, sasl.MechPlaintext, func(opts *sasl.ServerOptions) sasl.ServerMechFactory {
+		if opts.UserPassVerifier == nil {
+			return nil
+		}
+
+		userPassVerifier := UserPassVerifier(opts.UserPassVerifier)
+		authzVerifier := AuthzVerifier(opts.AuthzVerifier)
+		return func(*sasl.ConnState) sasl.ServerMech {
+			return NewServerMech(userPassVerifier, authzVerifier)
+		}
+	})
+
+	sasl.RegisterClientMech(MechName, sasl.MechStrengthPlaintext, sasl.MechPlaintext, func(opts *sasl.ClientOptions) sasl.ClientMechFactory {
+		if opts.Username == "" {
+			return nil
+		}
+
+		authz, username, password := opts.Authz, opts.Username, opts.Password
+		return func(*sasl.ConnState) sasl.ClientMech {
+			return &ClientMech{
+				authz:    authz,
+				username: username,
+				password: append([]byte(nil), password...),
+			}
+		}
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+
+	"github.com/craiggwilson/go-sasl"
 )
 
 // AuthzVerifier verifies the client's authorization identity.
@@ -26,7 +28,6 @@ func NewServerMech(userPassVerifier UserPassVerifier, authzVerifier AuthzVerifie
 type ServerMech struct {
 	Authz    string
 	Username string
-	Password string
 
 	authzVerifier    AuthzVerifier
 	userPassVerifier UserPassVerifier
@@ -61,11 +62,11 @@ func (m *ServerMech) Next(ctx context.Context, response []byte) ([]byte, error)
 
 	m.Authz = string(parts[0])
 	m.Username = string(parts[1])
-	m.Password = string(parts[2])
 
 	var err error
 	if m.userPassVerifier != nil {
-		err = m.userPassVerifier(ctx, m.Username, m.Password)
+		// the password is not kept once verified.
+		err = m.userPassVerifier(ctx, m.Username, string(parts[2]))
 	}
 	if err == nil && m.authzVerifier != nil {
 		err = m.authzVerifier(ctx, m.Username, m.Authz)
@@ -79,3 +80,16 @@ func (m *ServerMech) Next(ctx context.Context, response []byte) ([]byte, error)
 func (m *ServerMech) Completed() bool {
 	return m.done
 }
+
+// Result returns the result of the completed exchange.
+func (m *ServerMech) Result() *sasl.Result {
+	authz := m.Authz
+	if authz == "" {
+		authz = m.Username
+	}
+	return &sasl.Result{
+		Mechanism:        MechName,
+		AuthenticationID: m.Username,
+		AuthorizationID:  authz,
+	}
+}
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ClientMechProvider returns a new client mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ClientMechProvider func(mechName string) sasl.ClientMech
+
+// Authenticate conducts SASL authentication as a frontend. If the caller's
+// startup loop has already read the AuthenticationSASL request it is passed as
+// req; otherwise req is nil and the request is read from rw. When the
+// connection uses TLS, tlsState is non-nil and a -PLUS mechanism offered by
+// the backend is preferred, bound to the connection with tls-server-end-point.
+// Authenticate returns once the backend sends AuthenticationOk.
+func Authenticate(ctx context.Context, rw io.ReadWriter, req *Message, provider ClientMechProvider, tlsState *tls.ConnectionState) error {
+	var err error
+	if req == nil {
+		if req, err = ReadMessage(rw); err != nil {
+			return err
+		}
+	}
+
+	if req.Type == MessageTypeErrorResponse {
+		return parseError(req.Body)
+	}
+
+	code, data, err := parseAuthentication(req)
+	if err != nil {
+		return err
+	}
+	if code != AuthenticationSASL {
+		return fmt.Errorf("postgres: expected AuthenticationSASL, but got authentication request %d", code)
+	}
+
+	var offered []string
+	for len(data) > 0 && data[0] != 0 {
+		var name string
+		if name, data, err = readCString(data); err != nil {
+			return err
+		}
+		offered = append(offered, name)
+	}
+
+	mech, err := selectMech(offered, provider, tlsState)
+	if err != nil {
+		return err
+	}
+
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("postgres: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	body := append([]byte(mechName), 0)
+	if response == nil {
+		body = append(body, 0xff, 0xff, 0xff, 0xff)
+	} else {
+		body = binary.BigEndian.AppendUint32(body, uint32(len(response)))
+		body = append(body, response...)
+	}
+	if err = WriteMessage(rw, &Message{Type: MessageTypeSASLResponse, Body: body}); err != nil {
+		return err
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		msg, err := ReadMessage(rw)
+		if err != nil {
+			return err
+		}
+
+		if msg.Type == MessageTypeErrorResponse {
+			return parseError(msg.Body)
+		}
+
+		code, data, err := parseAuthentication(msg)
+		if err != nil {
+			return err
+		}
+
+		switch code {
+		case AuthenticationSASLContinue:
+			if response, err = mech.Next(ctx, data); err != nil {
+				return fmt.Errorf("postgres: sasl mechanism %s: client failed to provide response: %v", mechName, err)
+			}
+			if err = WriteMessage(rw, &Message{Type: MessageTypeSASLResponse, Body: response}); err != nil {
+				return err
+			}
+		case AuthenticationSASLFinal:
+			if len(data) > 0 || !mech.Completed() {
+				if _, err = mech.Next(ctx, data); err != nil {
+					return fmt.Errorf("postgres: sasl mechanism %s: unable to verify server: %v", mechName, err)
+				}
+			}
+		case AuthenticationOk:
+			if !mech.Completed() {
+				return fmt.Errorf("postgres: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return nil
+		default:
+			return fmt.Errorf("postgres: unexpected authentication request %d", code)
+		}
+	}
+}
+
+// selectMech picks the first offered mechanism supported by provider,
+// preferring channel binding variants when the connection uses TLS. When the
+// connection could be bound but no -PLUS variant was offered at all, a
+// mechanism implementing sasl.ChannelBindingSupporter is told so, letting the
+// backend detect that the offer was stripped.
+func selectMech(offered []string, provider ClientMechProvider, tlsState *tls.ConnectionState) (sasl.ClientMech, error) {
+	var cbData []byte
+	if tlsState != nil && len(tlsState.PeerCertificates) > 0 {
+		cbData, _ = sasl.TLSServerEndPoint(tlsState.PeerCertificates[0])
+	}
+
+	plusOffered := false
+	if cbData != nil {
+		for _, name := range offered {
+			if !strings.HasSuffix(name, "-PLUS") {
+				continue
+			}
+			plusOffered = true
+
+			mech := provider(name)
+			if binder, ok := mech.(sasl.ChannelBinder); ok {
+				binder.SetChannelBinding(sasl.ChannelBindingTLSServerEndPoint, cbData)
+				return mech, nil
+			}
+		}
+	}
+
+	for _, name := range offered {
+		if strings.HasSuffix(name, "-PLUS") {
+			continue
+		}
+		if mech := provider(name); mech != nil {
+			if supporter, ok := mech.(sasl.ChannelBindingSupporter); ok {
+				supporter.SetChannelBindingSupported(cbData != nil && !plusOffered)
+			}
+			return mech, nil
+		}
+	}
+
+	return nil, fmt.Errorf("postgres: none of the offered sasl mechanisms are supported: %s", strings.Join(offered, ", "))
+}
@@ -0,0 +1,139 @@
+// Package postgres runs SASL mechanisms over the PostgreSQL frontend/backend
+// protocol's AuthenticationSASL, SASLInitialResponse, AuthenticationSASLContinue,
+// SASLResponse and AuthenticationSASLFinal messages
+// (https://www.postgresql.org/docs/current/sasl-authentication.html).
+//
+// PostgreSQL uses SCRAM-SHA-256 and SCRAM-SHA-256-PLUS, which the
+// ClientMechProvider and ServerMechProvider can create with the scramsha256
+// package. Other mechanisms, such as SCRAM-SHA-1, work between peers that
+// both offer them.
+package postgres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Message types used during authentication.
+const (
+	MessageTypeAuthentication byte = 'R'
+	MessageTypeSASLResponse   byte = 'p'
+	MessageTypeErrorResponse  byte = 'E'
+)
+
+// Authentication request codes carried by MessageTypeAuthentication.
+const (
+	AuthenticationOk           int32 = 0
+	AuthenticationSASL         int32 = 10
+	AuthenticationSASLContinue int32 = 11
+	AuthenticationSASLFinal    int32 = 12
+)
+
+// maxMessageLen bounds the size of a single message read from the wire.
+const maxMessageLen = 1 << 20
+
+var errTruncated = errors.New("postgres: truncated message")
+
+// Message is a single protocol message.
+type Message struct {
+	Type byte
+	Body []byte
+}
+
+// ReadMessage reads a single typed message from r.
+func ReadMessage(r io.Reader) (*Message, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	n := int32(binary.BigEndian.Uint32(header[1:]))
+	if n < 4 || n > maxMessageLen {
+		return nil, fmt.Errorf("postgres: invalid message length %d", n)
+	}
+
+	body := make([]byte, n-4)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &Message{Type: header[0], Body: body}, nil
+}
+
+// WriteMessage writes a single typed message to w.
+func WriteMessage(w io.Writer, msg *Message) error {
+	b := make([]byte, 5, 5+len(msg.Body))
+	b[0] = msg.Type
+	binary.BigEndian.PutUint32(b[1:], uint32(4+len(msg.Body)))
+	_, err := w.Write(append(b, msg.Body...))
+	return err
+}
+
+// Error is an ErrorResponse sent by the backend.
+type Error struct {
+	Severity string
+	Code     string
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("postgres: %s: %s (SQLSTATE %s)", e.Severity, e.Message, e.Code)
+}
+
+func parseError(body []byte) *Error {
+	e := &Error{}
+	for len(body) > 1 {
+		field := body[0]
+		end := bytes.IndexByte(body[1:], 0)
+		if end < 0 {
+			break
+		}
+		value := string(body[1 : 1+end])
+		body = body[2+end:]
+
+		switch field {
+		case 'S':
+			e.Severity = value
+		case 'C':
+			e.Code = value
+		case 'M':
+			e.Message = value
+		}
+	}
+	return e
+}
+
+func errorMessage(e *Error) *Message {
+	var b []byte
+	b = appendField(b, 'S', e.Severity)
+	b = appendField(b, 'V', e.Severity)
+	b = appendField(b, 'C', e.Code)
+	b = appendField(b, 'M', e.Message)
+	return &Message{Type: MessageTypeErrorResponse, Body: append(b, 0)}
+}
+
+func appendField(b []byte, field byte, value string) []byte {
+	return append(append(append(b, field), value...), 0)
+}
+
+func authenticationMessage(code int32, data []byte) *Message {
+	b := binary.BigEndian.AppendUint32(nil, uint32(code))
+	return &Message{Type: MessageTypeAuthentication, Body: append(b, data...)}
+}
+
+func parseAuthentication(msg *Message) (int32, []byte, error) {
+	if msg.Type != MessageTypeAuthentication || len(msg.Body) < 4 {
+		return 0, nil, fmt.Errorf("postgres: expected authentication message, but got %q", msg.Type)
+	}
+	return int32(binary.BigEndian.Uint32(msg.Body)), msg.Body[4:], nil
+}
+
+func readCString(b []byte) (string, []byte, error) {
+	end := bytes.IndexByte(b, 0)
+	if end < 0 {
+		return "", nil, errTruncated
+	}
+	return string(b[:end]), b[end+1:], nil
+}
@@ -0,0 +1,259 @@
+package postgres_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	mrand "math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/postgres"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+	"github.com/craiggwilson/go-sasl/scramsha256"
+)
+
+func TestAuthenticate(t *testing.T) {
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		_, storedKey, serverKey := scramsha256.GenerateKeys("mcjack", []byte("blah"), 100)
+		return &scramsha1.StoredUser{
+			Salt:       []byte("blah"),
+			Iterations: 100,
+			StoredKey:  storedKey,
+			ServerKey:  serverKey,
+		}, nil
+	}
+
+	// using math/rand to make the nonces predictable. Actual implementation should use crypto/rand.
+	mr := mrand.New(mrand.NewSource(1))
+
+	serverCert := newCertificate(t)
+	otherCert := newCertificate(t)
+
+	tests := []struct {
+		name       string
+		password   string
+		serverCert *x509.Certificate
+		clientCert *x509.Certificate
+		stripPlus  bool
+		mechName   string
+		clientErr  string
+		serverErr  string
+	}{
+		{"scram", "mcjack", nil, nil, false, scramsha256.MechName, "", ""},
+		{"scram-wrong", "wrong", nil, nil, false, scramsha256.MechName,
+			"postgres: FATAL: SASL authentication failed (SQLSTATE 28P01)",
+			"postgres: sasl mechanism SCRAM-SHA-256: invalid response: client key mismatch"},
+		{"scram-plus", "mcjack", serverCert, serverCert, false, scramsha256.MechNamePlus, "", ""},
+		{"scram-plus-mismatch", "mcjack", serverCert, otherCert, false, scramsha256.MechNamePlus,
+			"postgres: FATAL: SASL authentication failed (SQLSTATE 28P01)",
+			"postgres: sasl mechanism SCRAM-SHA-256-PLUS: invalid response: channel bindings don't match"},
+		{"scram-tls-without-plus", "mcjack", nil, serverCert, false, scramsha256.MechName, "", ""},
+		{"scram-plus-stripped", "mcjack", serverCert, serverCert, true, scramsha256.MechName,
+			"postgres: FATAL: SASL authentication failed (SQLSTATE 28P01)",
+			"postgres: sasl mechanism SCRAM-SHA-256: invalid initial response: server does support channel binding"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+
+			type result struct {
+				mech sasl.ServerMech
+				err  error
+			}
+			serverResult := make(chan result, 1)
+			go func() {
+				defer serverConn.Close()
+				mech, err := postgres.Serve(context.Background(), serverConn,
+					[]string{scramsha256.MechNamePlus, scramsha256.MechName},
+					func(mechName string) sasl.ServerMech {
+						return scramsha256.NewServerMech(storedUserProvider, nil, 16, mr)
+					},
+					test.serverCert)
+				serverResult <- result{mech, err}
+			}()
+
+			var tlsState *tls.ConnectionState
+			if test.clientCert != nil {
+				tlsState = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{test.clientCert}}
+			}
+
+			var req *postgres.Message
+			if test.stripPlus {
+				// a man in the middle removes the -PLUS variant from the
+				// offered mechanisms.
+				var err error
+				if req, err = postgres.ReadMessage(clientConn); err != nil {
+					t.Fatalf("unable to read AuthenticationSASL: %v", err)
+				}
+				req.Body = bytes.Replace(req.Body, []byte(scramsha256.MechNamePlus+"\x00"), nil, 1)
+			}
+
+			var selected string
+			clientErr := postgres.Authenticate(context.Background(), clientConn, req, func(mechName string) sasl.ClientMech {
+				selected = mechName
+				return scramsha256.NewClientMech("", "jack", test.password, 16, mr)
+			}, tlsState)
+
+			r := <-serverResult
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, r.err)
+
+			if selected != test.mechName {
+				t.Fatalf("expected mechanism %s to be selected, but got %s", test.mechName, selected)
+			}
+		})
+	}
+}
+
+// The example exchange of RFC7677 section 3.
+const (
+	rfcClientNonce = "rOprNGfwEbeRWgbNEkqO"
+	rfcServerNonce = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	rfcSalt        = "W22ZaJ0SNY7soEsUEjb6gQ=="
+	rfcClientFirst = "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"
+	rfcServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfcClientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfcServerFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+func TestAuthenticateRFC7677(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	// the backend side of the exchange, as sent by PostgreSQL.
+	backendErr := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		backendErr <- converseRFC7677(serverConn, []*postgres.Message{
+			authenticationMessage(postgres.AuthenticationSASL, scramsha256.MechName+"\x00\x00"),
+			{Type: postgres.MessageTypeSASLResponse, Body: initialResponse(scramsha256.MechName, rfcClientFirst)},
+			authenticationMessage(postgres.AuthenticationSASLContinue, rfcServerFirst),
+			{Type: postgres.MessageTypeSASLResponse, Body: []byte(rfcClientFinal)},
+			authenticationMessage(postgres.AuthenticationSASLFinal, rfcServerFinal),
+			authenticationMessage(postgres.AuthenticationOk, ""),
+		}, true)
+	}()
+
+	err := postgres.Authenticate(context.Background(), clientConn, nil, func(mechName string) sasl.ClientMech {
+		return scramsha256.NewClientMech("", "user", "pencil", uint16(len(rfcClientNonce)), bytes.NewReader([]byte(rfcClientNonce)))
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected no client error, but got %v", err)
+	}
+	if err = <-backendErr; err != nil {
+		t.Fatalf("expected the RFC7677 exchange, but %v", err)
+	}
+}
+
+func TestServeRFC7677(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	// the frontend side of the exchange, as sent by libpq.
+	frontendErr := make(chan error, 1)
+	go func() {
+		defer clientConn.Close()
+		frontendErr <- converseRFC7677(clientConn, []*postgres.Message{
+			authenticationMessage(postgres.AuthenticationSASL, scramsha256.MechName+"\x00\x00"),
+			{Type: postgres.MessageTypeSASLResponse, Body: initialResponse(scramsha256.MechName, rfcClientFirst)},
+			authenticationMessage(postgres.AuthenticationSASLContinue, rfcServerFirst),
+			{Type: postgres.MessageTypeSASLResponse, Body: []byte(rfcClientFinal)},
+			authenticationMessage(postgres.AuthenticationSASLFinal, rfcServerFinal),
+			authenticationMessage(postgres.AuthenticationOk, ""),
+		}, false)
+	}()
+
+	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		salt, err := base64.StdEncoding.DecodeString(rfcSalt)
+		if err != nil {
+			return nil, err
+		}
+		_, storedKey, serverKey := scramsha256.GenerateKeys("pencil", salt, 4096)
+		return &scramsha1.StoredUser{Salt: salt, Iterations: 4096, StoredKey: storedKey, ServerKey: serverKey}, nil
+	}
+
+	mech, err := postgres.Serve(context.Background(), serverConn, []string{scramsha256.MechNamePlus, scramsha256.MechName}, func(mechName string) sasl.ServerMech {
+		return scramsha256.NewServerMech(storedUserProvider, nil, uint16(len(rfcServerNonce)), bytes.NewReader([]byte(rfcServerNonce)))
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected no server error, but got %v", err)
+	}
+	if err = <-frontendErr; err != nil {
+		t.Fatalf("expected the RFC7677 exchange, but %v", err)
+	}
+	if username := mech.(*scramsha1.ServerMech).Username; username != "user" {
+		t.Fatalf("expected user to be authenticated, but got %q", username)
+	}
+}
+
+// converseRFC7677 plays one side of the exchange over conn, sending the
+// messages of the backend when backend is set, and of the frontend otherwise,
+// and expecting the others.
+func converseRFC7677(conn net.Conn, msgs []*postgres.Message, backend bool) error {
+	for _, msg := range msgs {
+		if (msg.Type == postgres.MessageTypeAuthentication) == backend {
+			if err := postgres.WriteMessage(conn, msg); err != nil {
+				return err
+			}
+			continue
+		}
+
+		actual, err := postgres.ReadMessage(conn)
+		if err != nil {
+			return err
+		}
+		if actual.Type != msg.Type || !bytes.Equal(actual.Body, msg.Body) {
+			return fmt.Errorf("expected message %q %q, but got %q %q", msg.Type, msg.Body, actual.Type, actual.Body)
+		}
+	}
+	return nil
+}
+
+func authenticationMessage(code int32, data string) *postgres.Message {
+	return &postgres.Message{Type: postgres.MessageTypeAuthentication, Body: append(binary.BigEndian.AppendUint32(nil, uint32(code)), data...)}
+}
+
+func initialResponse(mechName, response string) []byte {
+	body := binary.BigEndian.AppendUint32(append([]byte(mechName), 0), uint32(len(response)))
+	return append(body, response...)
+}
+
+func newCertificate(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unable to parse certificate: %v", err)
+	}
+	return cert
+}
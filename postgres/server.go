@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ServerMechProvider returns a new server mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ServerMechProvider func(mechName string) sasl.ServerMech
+
+// Serve conducts SASL authentication as a backend. The mechanisms are offered
+// in order of preference, except that -PLUS variants are only offered when
+// cert, the backend's TLS certificate, is non-nil. When a -PLUS variant was
+// offered but the frontend selects the mechanism without it, a mechanism
+// implementing sasl.ChannelBindingSupporter rejects a frontend claiming that
+// the backend does not support channel binding. On success,
+// AuthenticationSASLFinal and AuthenticationOk are sent and the completed
+// mechanism is returned; on failure an ErrorResponse is sent.
+func Serve(ctx context.Context, rw io.ReadWriter, mechanisms []string, provider ServerMechProvider, cert *x509.Certificate) (sasl.ServerMech, error) {
+	var cbData []byte
+	if cert != nil {
+		var err error
+		if cbData, err = sasl.TLSServerEndPoint(cert); err != nil {
+			return nil, err
+		}
+	}
+
+	var offered []string
+	var data []byte
+	for _, name := range mechanisms {
+		if strings.HasSuffix(name, "-PLUS") && cbData == nil {
+			continue
+		}
+		offered = append(offered, name)
+		data = append(append(data, name...), 0)
+	}
+	if err := WriteMessage(rw, authenticationMessage(AuthenticationSASL, append(data, 0))); err != nil {
+		return nil, err
+	}
+
+	msg, err := ReadMessage(rw)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MessageTypeSASLResponse {
+		return nil, fail(rw, "08P01", "expected SASL response", fmt.Errorf("postgres: expected SASLInitialResponse, but got %q", msg.Type))
+	}
+
+	mechName, rest, err := readCString(msg.Body)
+	if err != nil || len(rest) < 4 {
+		return nil, fail(rw, "08P01", "malformed SASLInitialResponse", errTruncated)
+	}
+
+	var response []byte
+	if n := int32(binary.BigEndian.Uint32(rest)); n >= 0 {
+		if int(n) > len(rest)-4 {
+			return nil, fail(rw, "08P01", "malformed SASLInitialResponse", errTruncated)
+		}
+		response = rest[4 : 4+n]
+	}
+
+	var mech sasl.ServerMech
+	if contains(offered, mechName) {
+		mech = provider(mechName)
+	}
+	if mech == nil {
+		return nil, fail(rw, "08P01", "selected SASL authentication mechanism is not supported", fmt.Errorf("postgres: sasl mechanism %s is not supported", mechName))
+	}
+
+	if strings.HasSuffix(mechName, "-PLUS") {
+		binder, ok := mech.(sasl.ChannelBinder)
+		if !ok {
+			return nil, fail(rw, "08P01", "channel binding is not supported", fmt.Errorf("postgres: sasl mechanism %s does not support channel binding", mechName))
+		}
+		binder.SetChannelBinding(sasl.ChannelBindingTLSServerEndPoint, cbData)
+	} else if supporter, ok := mech.(sasl.ChannelBindingSupporter); ok {
+		supporter.SetChannelBindingSupported(contains(offered, mechName+"-PLUS"))
+	}
+
+	_, challenge, err := mech.Start(ctx, response)
+	for {
+		if err != nil {
+			return nil, fail(rw, "28P01", "SASL authentication failed", fmt.Errorf("postgres: sasl mechanism %s: %v", mechName, err))
+		}
+
+		if mech.Completed() {
+			break
+		}
+
+		if err = WriteMessage(rw, authenticationMessage(AuthenticationSASLContinue, challenge)); err != nil {
+			return nil, err
+		}
+
+		if msg, err = ReadMessage(rw); err != nil {
+			return nil, err
+		}
+		if msg.Type != MessageTypeSASLResponse {
+			return nil, fail(rw, "08P01", "expected SASL response", fmt.Errorf("postgres: expected SASLResponse, but got %q", msg.Type))
+		}
+
+		challenge, err = mech.Next(ctx, msg.Body)
+	}
+
+	if err = WriteMessage(rw, authenticationMessage(AuthenticationSASLFinal, challenge)); err != nil {
+		return nil, err
+	}
+	if err = WriteMessage(rw, authenticationMessage(AuthenticationOk, nil)); err != nil {
+		return nil, err
+	}
+	return mech, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fail sends a fatal ErrorResponse and returns err.
+func fail(w io.Writer, code, message string, err error) error {
+	WriteMessage(w, errorMessage(&Error{Severity: "FATAL", Code: code, Message: message}))
+	return err
+}
@@ -0,0 +1,280 @@
+package sasl
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MechFlags describe the security properties of a mechanism. Mechanisms with
+// any flag set are only enabled by NewServerWithDefaults and
+// NewClientWithDefaults when the options allow it.
+type MechFlags uint
+
+const (
+	// MechPlaintext marks mechanisms that send the password in the clear.
+	MechPlaintext MechFlags = 1 << iota
+	// MechAnonymous marks mechanisms that do not authenticate the client.
+	MechAnonymous
+	// MechChannelBinding marks mechanisms that bind the exchange to the
+	// underlying channel. They are only offered, and can only be used, when
+	// the ConnState has channel binding.
+	MechChannelBinding
+)
+
+// MechStrength ranks mechanisms by the protection they offer. Registered
+// mechanisms are preferred strongest first, whatever the order in which
+// their packages were imported.
+type MechStrength int
+
+const (
+	// MechStrengthAnonymous is for mechanisms that do not authenticate the
+	// client, such as ANONYMOUS.
+	MechStrengthAnonymous MechStrength = 10
+	// MechStrengthPlaintext is for mechanisms that send the password in the
+	// clear, such as PLAIN.
+	MechStrengthPlaintext MechStrength = 20
+	// MechStrengthExternal is for mechanisms relying on credentials
+	// established outside of SASL, such as EXTERNAL.
+	MechStrengthExternal MechStrength = 30
+	// MechStrengthChallengeResponse is for mechanisms proving knowledge of
+	// the password without revealing it, such as SCRAM-SHA-1.
+	MechStrengthChallengeResponse MechStrength = 40
+	// MechStrengthChannelBinding is for challenge-response mechanisms that
+	// also bind the exchange to the channel, such as SCRAM-SHA-1-PLUS.
+	MechStrengthChannelBinding MechStrength = 50
+)
+
+// UserPassVerifier verifies a username and password.
+type UserPassVerifier func(ctx context.Context, username, password string) error
+
+// AuthzVerifier verifies that an authenticated user may act as the requested
+// authorization identity.
+type AuthzVerifier func(ctx context.Context, username, authz string) error
+
+// MechConfig is mechanism specific configuration, such as
+// scramsha1.ServerConfig.
+type MechConfig interface {
+	// MechName returns the name of the configured mechanism.
+	MechName() string
+}
+
+// ServerOptions configures the mechanisms of a server created by
+// NewServerWithDefaults. A mechanism is only enabled when the options hold
+// everything it needs.
+type ServerOptions struct {
+	// UserPassVerifier verifies the passwords received by mechanisms such as
+	// PLAIN.
+	UserPassVerifier UserPassVerifier
+	// AuthzVerifier verifies authorization identities for all mechanisms
+	// accepting one. When nil, any authorization identity is accepted.
+	AuthzVerifier AuthzVerifier
+	// Configs holds mechanism specific configuration.
+	Configs []MechConfig
+
+	// AllowPlaintext enables mechanisms flagged MechPlaintext.
+	AllowPlaintext bool
+	// AllowAnonymous enables mechanisms flagged MechAnonymous.
+	AllowAnonymous bool
+}
+
+// Config returns the configuration for the named mechanism, or nil if there
+// is none.
+func (o *ServerOptions) Config(mechName string) MechConfig {
+	return findConfig(o.Configs, mechName)
+}
+
+// ClientOptions configures the mechanisms of a client created by
+// NewClientWithDefaults. A mechanism is only enabled when the options hold
+// everything it needs.
+type ClientOptions struct {
+	// Authz is the authorization identity to act as, if any.
+	Authz string
+	// Username and Password are the credentials sent by password based
+	// mechanisms. Each exchange works on a copy of Password, which it wipes
+	// once done; Password itself may be wiped once the Client is no longer
+	// used.
+	Username string
+	Password []byte
+	// Trace is the trace information sent by mechanisms such as ANONYMOUS.
+	Trace string
+	// Configs holds mechanism specific configuration.
+	Configs []MechConfig
+
+	// AllowPlaintext enables mechanisms flagged MechPlaintext.
+	AllowPlaintext bool
+	// AllowAnonymous enables mechanisms flagged MechAnonymous.
+	AllowAnonymous bool
+}
+
+// Config returns the configuration for the named mechanism, or nil if there
+// is none.
+func (o *ClientOptions) Config(mechName string) MechConfig {
+	return findConfig(o.Configs, mechName)
+}
+
+func findConfig(configs []MechConfig, mechName string) MechConfig {
+	for _, c := range configs {
+		if c.MechName() == mechName {
+			return c
+		}
+	}
+	return nil
+}
+
+// ServerMechConfigurer returns a factory for the mechanism configured by
+// opts, or nil if opts do not configure it.
+type ServerMechConfigurer func(opts *ServerOptions) ServerMechFactory
+
+// ClientMechConfigurer returns a factory for the mechanism configured by
+// opts, or nil if opts do not configure it.
+type ClientMechConfigurer func(opts *ClientOptions) ClientMechFactory
+
+type serverRegistration struct {
+	mechName  string
+	strength  MechStrength
+	flags     MechFlags
+	configure ServerMechConfigurer
+}
+
+type clientRegistration struct {
+	mechName  string
+	strength  MechStrength
+	flags     MechFlags
+	configure ClientMechConfigurer
+}
+
+// prefer reports whether a mechanism should be preferred over another,
+// ordering by strength and then by name.
+func prefer(strength MechStrength, mechName string, otherStrength MechStrength, otherMechName string) bool {
+	if strength != otherStrength {
+		return strength > otherStrength
+	}
+	return mechName < otherMechName
+}
+
+var registry struct {
+	mu      sync.RWMutex
+	servers []serverRegistration
+	clients []clientRegistration
+}
+
+// RegisterServerMech makes a server mechanism available to
+// NewServerWithDefaults. It is intended to be called from the init function
+// of the mechanism's package, and panics if called twice for the same
+// mechanism.
+func RegisterServerMech(mechName string, strength MechStrength, flags MechFlags, configure ServerMechConfigurer) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, r := range registry.servers {
+		if r.mechName == mechName {
+			panic("sasl: RegisterServerMech called twice for mechanism " + mechName)
+		}
+	}
+	registry.servers = append(registry.servers, serverRegistration{mechName, strength, flags, configure})
+	sort.Slice(registry.servers, func(i, j int) bool {
+		a, b := registry.servers[i], registry.servers[j]
+		return prefer(a.strength, a.mechName, b.strength, b.mechName)
+	})
+}
+
+// RegisterClientMech makes a client mechanism available to
+// NewClientWithDefaults. It is intended to be called from the init function
+// of the mechanism's package, and panics if called twice for the same
+// mechanism.
+func RegisterClientMech(mechName string, strength MechStrength, flags MechFlags, configure ClientMechConfigurer) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, r := range registry.clients {
+		if r.mechName == mechName {
+			panic("sasl: RegisterClientMech called twice for mechanism " + mechName)
+		}
+	}
+	registry.clients = append(registry.clients, clientRegistration{mechName, strength, flags, configure})
+	sort.Slice(registry.clients, func(i, j int) bool {
+		a, b := registry.clients[i], registry.clients[j]
+		return prefer(a.strength, a.mechName, b.strength, b.mechName)
+	})
+}
+
+// lookupServerMech returns the strength and flags the named server mechanism
+// was registered with, or zeros if it was not.
+func lookupServerMech(mechName string) (MechStrength, MechFlags) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	for _, r := range registry.servers {
+		if r.mechName == mechName {
+			return r.strength, r.flags
+		}
+	}
+	return 0, 0
+}
+
+// lookupClientMech returns the strength and flags the named client mechanism
+// was registered with, or zeros if it was not.
+func lookupClientMech(mechName string) (MechStrength, MechFlags) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	for _, r := range registry.clients {
+		if r.mechName == mechName {
+			return r.strength, r.flags
+		}
+	}
+	return 0, 0
+}
+
+// sortMechNames sorts mechanism names in order of preference, by the
+// strength returned by lookup and then by name.
+func sortMechNames(mechNames []string, lookup func(string) (MechStrength, MechFlags)) {
+	strengths := make(map[string]MechStrength, len(mechNames))
+	for _, mechName := range mechNames {
+		strengths[mechName], _ = lookup(mechName)
+	}
+	sort.Slice(mechNames, func(i, j int) bool {
+		a, b := mechNames[i], mechNames[j]
+		return prefer(strengths[a], a, strengths[b], b)
+	})
+}
+
+// NewServerWithDefaults creates a Server with every registered mechanism that
+// opts configure and allow, strongest first. Mechanisms are registered by
+// importing their packages.
+func NewServerWithDefaults(opts *ServerOptions) *Server {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	s := &Server{}
+	for _, r := range registry.servers {
+		if !allowed(r.flags, opts.AllowPlaintext, opts.AllowAnonymous) {
+			continue
+		}
+		if factory := r.configure(opts); factory != nil {
+			s.RegisterMechFactory(r.mechName, factory)
+		}
+	}
+	return s
+}
+
+// NewClientWithDefaults creates a Client with every registered mechanism that
+// opts configure and allow, strongest first. Mechanisms are registered by
+// importing their packages.
+func NewClientWithDefaults(opts *ClientOptions) *Client {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	c := &Client{}
+	for _, r := range registry.clients {
+		if !allowed(r.flags, opts.AllowPlaintext, opts.AllowAnonymous) {
+			continue
+		}
+		if factory := r.configure(opts); factory != nil {
+			c.RegisterMechFactory(r.mechName, factory)
+		}
+	}
+	return c
+}
+
+func allowed(flags MechFlags, allowPlaintext, allowAnonymous bool) bool {
+	return (flags&MechPlaintext == 0 || allowPlaintext) &&
+		(flags&MechAnonymous == 0 || allowAnonymous)
+}
@@ -0,0 +1,354 @@
+package sasl_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/anonymous"
+	"github.com/craiggwilson/go-sasl/external"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+	"github.com/craiggwilson/go-sasl/scramsha256"
+)
+
+func TestDefaults(t *testing.T) {
+	serverOpts := defaultServerOptions()
+	clientOpts := defaultClientOptions()
+
+	tests := []struct {
+		name           string
+		mechName       string
+		allowPlaintext bool
+		allowAnonymous bool
+		authz          string
+		clientErr      string
+		serverErr      string
+		result         *sasl.Result
+	}{
+		{"scram", scramsha1.MechName, false, false, "", "", "",
+			&sasl.Result{Mechanism: scramsha1.MechName, AuthenticationID: "jack", AuthorizationID: "jack", Attributes: map[string]string{}}},
+		{"scram-authz", scramsha1.MechName, false, false, "joe",
+			"sasl mechanism SCRAM-SHA-1: client failed to provide response: other-error",
+			"sasl mechanism SCRAM-SHA-1: server failed to provide challenge: jack is not authorized to act as joe", nil},
+		{"scram-sha-256", scramsha256.MechName, false, false, "", "", "",
+			&sasl.Result{Mechanism: scramsha256.MechName, AuthenticationID: "jack", AuthorizationID: "jack", Attributes: map[string]string{}}},
+		{"plain", plain.MechName, true, false, "", "", "",
+			&sasl.Result{Mechanism: plain.MechName, AuthenticationID: "jack", AuthorizationID: "jack"}},
+		{"plain-authz", plain.MechName, true, false, "jack", "", "",
+			&sasl.Result{Mechanism: plain.MechName, AuthenticationID: "jack", AuthorizationID: "jack"}},
+		{"plain-disallowed", plain.MechName, false, false, "", "sasl mechanism 'PLAIN' has not been registered", "context canceled", nil},
+		{"anonymous", anonymous.MechName, false, true, "", "", "",
+			&sasl.Result{Mechanism: anonymous.MechName, Attributes: map[string]string{"trace": "jack@example.com"}}},
+		{"anonymous-disallowed", anonymous.MechName, false, false, "", "sasl mechanism 'ANONYMOUS' has not been registered", "context canceled", nil},
+		{"external-unconfigured", external.MechName, false, false, "", "context canceled", "sasl mechanism 'EXTERNAL' has not been registered", nil},
+		{"scram-plus-unbound", scramsha1.MechNamePlus, false, false, "", "sasl mechanism 'SCRAM-SHA-1-PLUS' requires channel binding", "context canceled", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serverOpts := serverOpts
+			serverOpts.AllowPlaintext = test.allowPlaintext
+			serverOpts.AllowAnonymous = test.allowAnonymous
+			server := sasl.NewServerWithDefaults(&serverOpts)
+
+			clientOpts := clientOpts
+			clientOpts.Authz = test.authz
+			clientOpts.AllowPlaintext = test.allowPlaintext
+			clientOpts.AllowAnonymous = test.allowAnonymous
+			client := sasl.NewClientWithDefaults(&clientOpts)
+
+			result, clientErr, serverErr := converse(client, server, nil, test.mechName)
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, serverErr)
+
+			if serverErr == nil && !reflect.DeepEqual(result, test.result) {
+				t.Fatalf("expected result %+v, but got %+v", test.result, result)
+			}
+		})
+	}
+}
+
+func TestDefaultsChannelBinding(t *testing.T) {
+	serverOpts := defaultServerOptions()
+	clientOpts := defaultClientOptions()
+	server := sasl.NewServerWithDefaults(&serverOpts)
+	client := sasl.NewClientWithDefaults(&clientOpts)
+
+	state := &sasl.ConnState{ChannelBindingType: sasl.ChannelBindingTLSServerEndPoint, ChannelBinding: []byte("endpoint")}
+	for _, mechName := range []string{scramsha1.MechNamePlus, scramsha256.MechNamePlus} {
+		result, clientErr, serverErr := converse(client, server, state, mechName)
+		if clientErr != nil || serverErr != nil {
+			t.Fatalf("expected no %s errors, but got %v and %v", mechName, clientErr, serverErr)
+		}
+		if result.Mechanism != mechName || result.ChannelBinding != sasl.ChannelBindingTLSServerEndPoint {
+			t.Fatalf("expected a channel bound %s result, but got %+v", mechName, result)
+		}
+	}
+
+	// SCRAM-SHA-1-PLUS was offered, so a client able to bind the connection
+	// but choosing SCRAM-SHA-1 must have had the offer stripped.
+	_, clientErr, serverErr := converse(client, server, state, scramsha1.MechName)
+	testhelpers.VerifyError(t, "client", "context canceled", clientErr)
+	testhelpers.VerifyError(t, "server", "sasl mechanism SCRAM-SHA-1: unable to start exchange: invalid initial response: server does support channel binding", serverErr)
+}
+
+func TestDefaultsOrder(t *testing.T) {
+	serverOpts := defaultServerOptions()
+	serverOpts.Configs = append(serverOpts.Configs, &external.ServerConfig{
+		Verifier: func(context.Context, string) error { return nil },
+	})
+	serverOpts.AllowPlaintext = true
+	serverOpts.AllowAnonymous = true
+	server := sasl.NewServerWithDefaults(&serverOpts)
+
+	clientOpts := defaultClientOptions()
+	clientOpts.AllowPlaintext = true
+	clientOpts.AllowAnonymous = true
+	client := sasl.NewClientWithDefaults(&clientOpts)
+
+	expected := []string{scramsha256.MechNamePlus, scramsha1.MechNamePlus, scramsha256.MechName, scramsha1.MechName, external.MechName, plain.MechName, anonymous.MechName}
+	if actual := server.Mechanisms(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected server mechanisms %v, but got %v", expected, actual)
+	}
+	if actual := client.Mechanisms(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected client mechanisms %v, but got %v", expected, actual)
+	}
+
+	expected = expected[2:]
+	if actual := server.MechanismsFor(nil); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected server mechanisms %v without channel binding, but got %v", expected, actual)
+	}
+	if actual := client.MechanismsFor(&sasl.ConnState{}); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected client mechanisms %v without channel binding, but got %v", expected, actual)
+	}
+}
+
+func TestRegisterServerMechTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected registering %s twice to panic", plain.MechName)
+		}
+	}()
+
+	sasl.RegisterServerMech(plain.MechName, sasl.MechStrengthPlaintext, 0, func(*sasl.ServerOptions) sasl.ServerMechFactory { return nil })
+}
+
+func TestServerMechanisms(t *testing.T) {
+	factory := func(*sasl.ConnState) sasl.ServerMech { return plain.NewServerMech(nil, nil) }
+
+	var server sasl.Server
+	server.RegisterMechFactory("C", factory)
+	server.RegisterMechFactory(anonymous.MechName, factory)
+	server.RegisterMechFactory("A", factory)
+	server.RegisterMechFactory(plain.MechName, factory)
+	server.RegisterMechFactory("B", factory)
+	server.RegisterMechFactory(scramsha1.MechName, factory)
+	server.RegisterMechFactory("C", factory)
+	server.UnregisterMechFactory("A")
+	server.UnregisterMechFactory("D")
+
+	expected := []string{scramsha1.MechName, plain.MechName, anonymous.MechName, "B", "C"}
+	if actual := server.Mechanisms(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, but got %v", expected, actual)
+	}
+
+	var reloaded sasl.Server
+	reloaded.RegisterMechFactory("D", factory)
+	reloaded.RegisterMechFactory(external.MechName, factory)
+	reloaded.RegisterMechFactory("B", factory)
+	server.ReplaceMechFactories(&reloaded)
+	reloaded.UnregisterMechFactory("D")
+
+	expected = []string{external.MechName, "B", "D"}
+	if actual := server.Mechanisms(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, but got %v", expected, actual)
+	}
+
+	var client sasl.Client
+	client.RegisterMechFactory("A", func(*sasl.ConnState) sasl.ClientMech { return plain.NewClientMech("", "jack", "mcjack") })
+	client.RegisterMechFactory(plain.MechName, func(*sasl.ConnState) sasl.ClientMech { return plain.NewClientMech("", "jack", "mcjack") })
+	client.RegisterMechFactory("B", func(*sasl.ConnState) sasl.ClientMech { return plain.NewClientMech("", "jack", "mcjack") })
+	client.RegisterMechFactory(scramsha1.MechNamePlus, func(*sasl.ConnState) sasl.ClientMech { return plain.NewClientMech("", "jack", "mcjack") })
+	client.UnregisterMechFactory("A")
+
+	expected = []string{scramsha1.MechNamePlus, plain.MechName, "B"}
+	if actual := client.Mechanisms(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, but got %v", expected, actual)
+	}
+	expected = []string{plain.MechName, "B"}
+	if actual := client.MechanismsFor(nil); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v without channel binding, but got %v", expected, actual)
+	}
+}
+
+func TestConcurrentRegistration(t *testing.T) {
+	server := sasl.NewServerWithDefaults(&sasl.ServerOptions{
+		UserPassVerifier: func(context.Context, string, string) error { return nil },
+		AllowPlaintext:   true,
+	})
+	client := sasl.NewClientWithDefaults(&sasl.ClientOptions{
+		Username:       "jack",
+		Password:       []byte("mcjack"),
+		AllowPlaintext: true,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				server.RegisterMechFactory("TEMP", func(*sasl.ConnState) sasl.ServerMech { return plain.NewServerMech(nil, nil) })
+				server.UnregisterMechFactory("TEMP")
+				server.ReplaceMechFactories(sasl.NewServerWithDefaults(&sasl.ServerOptions{
+					UserPassVerifier: func(context.Context, string, string) error { return nil },
+					AllowPlaintext:   true,
+				}))
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				client.RegisterMechFactory("TEMP", func(*sasl.ConnState) sasl.ClientMech { return plain.NewClientMech("", "", "") })
+				client.UnregisterMechFactory("TEMP")
+				client.Mechanisms()
+				server.Mechanisms()
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, clientErr, serverErr := converse(client, server, nil, plain.MechName); clientErr != nil || serverErr != nil {
+					t.Errorf("expected no errors, but got %v and %v", clientErr, serverErr)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAuthDisposesMechs(t *testing.T) {
+	disposed := make(chan string, 2)
+
+	var client sasl.Client
+	client.RegisterMechFactory(plain.MechName, func(*sasl.ConnState) sasl.ClientMech {
+		return &disposingClientMech{ClientMech: plain.NewClientMech("", "jack", "mcjack"), disposed: disposed}
+	})
+	var server sasl.Server
+	server.RegisterMechFactory(plain.MechName, func(*sasl.ConnState) sasl.ServerMech {
+		return &disposingServerMech{ServerMech: plain.NewServerMech(nil, nil), disposed: disposed}
+	})
+
+	if _, clientErr, serverErr := converse(&client, &server, nil, plain.MechName); clientErr != nil || serverErr != nil {
+		t.Fatalf("expected no errors, but got %v and %v", clientErr, serverErr)
+	}
+	if first, second := <-disposed, <-disposed; first == second {
+		t.Fatalf("expected both mechanisms to be disposed, but got %s twice", first)
+	}
+}
+
+type disposingClientMech struct {
+	sasl.ClientMech
+	disposed chan<- string
+}
+
+func (m *disposingClientMech) Dispose() { m.disposed <- "client" }
+
+type disposingServerMech struct {
+	sasl.ServerMech
+	disposed chan<- string
+}
+
+func (m *disposingServerMech) Dispose() { m.disposed <- "server" }
+
+func defaultServerOptions() sasl.ServerOptions {
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if username != "jack" || password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	storedUserProvider := func(hash *scramsha1.Hash) scramsha1.StoredUserProvider {
+		return func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+			_, storedKey, serverKey := hash.GenerateKeys("mcjack", []byte("blah"), 100)
+			return &scramsha1.StoredUser{
+				Salt:       []byte("blah"),
+				Iterations: 100,
+				StoredKey:  storedKey,
+				ServerKey:  serverKey,
+			}, nil
+		}
+	}
+
+	authzVerifier := func(_ context.Context, username, authz string) error {
+		if authz != "" && authz != username {
+			return fmt.Errorf("cannot impersonate %s", authz)
+		}
+		return nil
+	}
+
+	return sasl.ServerOptions{
+		UserPassVerifier: userPassVerifier,
+		AuthzVerifier:    authzVerifier,
+		Configs: []sasl.MechConfig{
+			&scramsha1.ServerConfig{StoredUserProvider: storedUserProvider(scramsha1.SHA1)},
+			&scramsha1.ServerConfig{Hash: scramsha1.SHA256, StoredUserProvider: storedUserProvider(scramsha1.SHA256)},
+		},
+	}
+}
+
+func defaultClientOptions() sasl.ClientOptions {
+	return sasl.ClientOptions{
+		Username: "jack",
+		Password: []byte("mcjack"),
+		Trace:    "jack@example.com",
+	}
+}
+
+func converse(client *sasl.Client, server *sasl.Server, state *sasl.ConnState, mechName string) (*sasl.Result, error, error) {
+	clientToServer := make(chan []byte, 1)
+	serverToClient := make(chan []byte, 1)
+
+	clientErr := make(chan error, 1)
+	serverErr := make(chan error, 1)
+	var result *sasl.Result
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		err := client.Auth(ctx, state, mechName, serverToClient, clientToServer)
+		if err != nil {
+			cancel()
+		}
+		clientErr <- err
+	}()
+
+	go func() {
+		var err error
+		select {
+		case response := <-clientToServer:
+			result, err = server.Auth(ctx, state, mechName, response, clientToServer, serverToClient)
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			cancel()
+		}
+		serverErr <- err
+	}()
+
+	cerr, serr := <-clientErr, <-serverErr
+	return result, cerr, serr
+}
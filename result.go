@@ -0,0 +1,49 @@
+package sasl
+
+// Result describes a completed authentication.
+type Result struct {
+	// Mechanism is the name of the mechanism used.
+	Mechanism string
+	// AuthenticationID is the identity whose credentials were verified. It
+	// is empty when the mechanism does not authenticate the client itself,
+	// as with ANONYMOUS and EXTERNAL.
+	AuthenticationID string
+	// AuthorizationID is the identity the client acts as. It is the
+	// AuthenticationID when the client did not request another identity.
+	AuthorizationID string
+	// Realm is the realm of the AuthenticationID, if the mechanism has one.
+	Realm string
+	// SSF is the security strength factor of the security layer negotiated,
+	// or 0 when there is none.
+	SSF int
+	// ChannelBinding is the channel binding type the exchange was bound to,
+	// or empty when it was not bound.
+	ChannelBinding string
+	// Attributes holds mechanism specific attributes, such as OAuth claims,
+	// the subject of a certificate or SCRAM extensions.
+	Attributes map[string]string
+}
+
+// ResultProvider is implemented by server mechanisms able to describe the
+// authentication they completed.
+type ResultProvider interface {
+	// Result returns the result of the completed exchange.
+	Result() *Result
+}
+
+// ResultOf returns the result of the exchange completed by mech. For
+// mechanisms that do not implement ResultProvider, only the Mechanism is set,
+// and only when mechName is given.
+func ResultOf(mech ServerMech, mechName string) *Result {
+	var r *Result
+	if p, ok := mech.(ResultProvider); ok {
+		r = p.Result()
+	}
+	if r == nil {
+		r = &Result{}
+	}
+	if r.Mechanism == "" {
+		r.Mechanism = mechName
+	}
+	return r
+}
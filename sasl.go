@@ -140,3 +140,8 @@ func (e *Error) Error() string {
 	}
 	return s
 }
+
+// Unwrap returns the inner error.
+func (e *Error) Unwrap() error {
+	return e.Inner
+}
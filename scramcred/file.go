@@ -0,0 +1,159 @@
+package scramcred
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+// NewFileStore loads the credentials in the file at path and, when
+// pollInterval is positive, reloads them whenever the file changes.
+//
+// Each line of the file holds a username and an RFC5803 credential separated
+// by the first ':', such as "jack:SCRAM-SHA-1$4096:...". A user may have a
+// line for each mechanism. Blank lines and lines starting with '#' are
+// ignored.
+func NewFileStore(path string, pollInterval time.Duration) (*FileStore, error) {
+	s := &FileStore{
+		path: path,
+		done: make(chan struct{}),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	if pollInterval > 0 {
+		go s.poll(pollInterval)
+	}
+	return s, nil
+}
+
+// FileStore serves credentials from a file.
+type FileStore struct {
+	path string
+	done chan struct{}
+	once sync.Once
+
+	mu      sync.RWMutex
+	creds   map[string]map[string]*Credential
+	modTime time.Time
+	size    int64
+	lastErr error
+}
+
+// Lookup returns the user's credential for the named mechanism, or nil if
+// there is none.
+func (s *FileStore) Lookup(username, mechName string) *Credential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.creds[username][mechName]
+}
+
+// StoredUser implements scramsha1.StoredUserProvider for SCRAM-SHA-1.
+func (s *FileStore) StoredUser(ctx context.Context, username string) (*scramsha1.StoredUser, error) {
+	return s.StoredUserProvider(scramsha1.MechName)(ctx, username)
+}
+
+// StoredUserProvider returns the scramsha1.StoredUserProvider serving the
+// users' credentials for the named mechanism, such as SCRAM-SHA-256.
+func (s *FileStore) StoredUserProvider(mechName string) scramsha1.StoredUserProvider {
+	return func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+		c := s.Lookup(username, mechName)
+		if c == nil {
+			return nil, fmt.Errorf("scramcred: no %s credential for user %q: %w", mechName, username, scramsha1.ErrUnknownUser)
+		}
+		return c.StoredUser()
+	}
+}
+
+// Reload reads the file again. When the file cannot be read or parsed, the
+// previously loaded credentials are kept.
+func (s *FileStore) Reload() error {
+	info, err := os.Stat(s.path)
+	if err == nil {
+		var data []byte
+		if data, err = os.ReadFile(s.path); err == nil {
+			var creds map[string]map[string]*Credential
+			if creds, err = parseFile(data); err == nil {
+				s.mu.Lock()
+				s.creds, s.modTime, s.size, s.lastErr = creds, info.ModTime(), info.Size(), nil
+				s.mu.Unlock()
+				return nil
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.lastErr = err
+	s.mu.Unlock()
+	return err
+}
+
+// LastError returns the error of the most recent reload, or nil if it
+// succeeded.
+func (s *FileStore) LastError() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastErr
+}
+
+// Close stops watching the file for changes.
+func (s *FileStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *FileStore) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(s.path)
+		s.mu.RLock()
+		changed := err != nil || !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+		s.mu.RUnlock()
+		if changed {
+			s.Reload()
+		}
+	}
+}
+
+func parseFile(data []byte) (map[string]map[string]*Credential, error) {
+	creds := make(map[string]map[string]*Credential)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, secret, ok := strings.Cut(line, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("scramcred: line %d: expected username and credential", lineNo)
+		}
+
+		c, err := Parse(secret)
+		if err != nil {
+			return nil, fmt.Errorf("scramcred: line %d: %v", lineNo, err)
+		}
+
+		if creds[username] == nil {
+			creds[username] = make(map[string]*Credential)
+		}
+		creds[username][c.Mechanism] = c
+	}
+	return creds, scanner.Err()
+}
@@ -0,0 +1,191 @@
+// Package scramcred encodes and decodes stored SCRAM credentials in the
+// formats used by existing user databases: the authPassword syntax of
+// RFC5803 (https://tools.ietf.org/html/rfc5803), which PostgreSQL also uses
+// for its SCRAM-SHA-256 secrets, and the credentials documents of MongoDB
+// users. Credentials can be migrated without reissuing passwords.
+package scramcred
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+// hashes are the hash functions of the SCRAM mechanisms by name.
+var hashes = map[string]*scramsha1.Hash{
+	scramsha1.SHA1.MechName(false):   scramsha1.SHA1,
+	scramsha1.SHA256.MechName(false): scramsha1.SHA256,
+	scramsha1.SHA512.MechName(false): scramsha1.SHA512,
+}
+
+// Credential is a stored SCRAM credential.
+type Credential struct {
+	Mechanism  string
+	Iterations int
+	Salt       []byte
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// Parse parses a credential in the RFC5803 form
+// "SCRAM-SHA-1$<iterations>:<salt>$<StoredKey>:<ServerKey>", with base64
+// encoded values. PostgreSQL secrets use the same form.
+func Parse(s string) (*Credential, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("scramcred: invalid credential: expected 3 '$' separated parts")
+	}
+
+	iterations, salt, ok := strings.Cut(parts[1], ":")
+	if !ok {
+		return nil, fmt.Errorf("scramcred: invalid credential: expected iterations and salt")
+	}
+	storedKey, serverKey, ok := strings.Cut(parts[2], ":")
+	if !ok {
+		return nil, fmt.Errorf("scramcred: invalid credential: expected stored key and server key")
+	}
+
+	c := &Credential{Mechanism: parts[0]}
+	var err error
+	if c.Iterations, err = strconv.Atoi(iterations); err != nil || c.Iterations <= 0 {
+		return nil, fmt.Errorf("scramcred: invalid credential: invalid iterations %q", iterations)
+	}
+	if c.Salt, err = decode("salt", salt); err != nil {
+		return nil, err
+	}
+	if c.StoredKey, err = decode("stored key", storedKey); err != nil {
+		return nil, err
+	}
+	if c.ServerKey, err = decode("server key", serverKey); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// String formats the credential in the RFC5803 form.
+func (c *Credential) String() string {
+	return c.Mechanism + "$" + strconv.Itoa(c.Iterations) + ":" + encode(c.Salt) + "$" + encode(c.StoredKey) + ":" + encode(c.ServerKey)
+}
+
+// StoredUser converts a SCRAM-SHA-1, SCRAM-SHA-256 or SCRAM-SHA-512
+// credential for use by a scramsha1.ServerMech using the mechanism's hash
+// function.
+func (c *Credential) StoredUser() (*scramsha1.StoredUser, error) {
+	if hashes[c.Mechanism] == nil {
+		return nil, fmt.Errorf("scramcred: %s credential cannot be used with scramsha1", c.Mechanism)
+	}
+	if c.Iterations > math.MaxUint16 {
+		return nil, fmt.Errorf("scramcred: %d iterations are not supported by %s", c.Iterations, c.Mechanism)
+	}
+	return &scramsha1.StoredUser{
+		Salt:       c.Salt,
+		Iterations: uint16(c.Iterations),
+		StoredKey:  c.StoredKey,
+		ServerKey:  c.ServerKey,
+	}, nil
+}
+
+// mongoCredential is a mechanism entry of a MongoDB credentials document.
+type mongoCredential struct {
+	IterationCount int    `json:"iterationCount"`
+	Salt           string `json:"salt"`
+	StoredKey      string `json:"storedKey"`
+	ServerKey      string `json:"serverKey"`
+}
+
+// ParseMongoDB parses the JSON form of the credentials document of a MongoDB
+// user, such as {"SCRAM-SHA-1": {"iterationCount": 10000, "salt": ...}},
+// returning the credentials sorted by mechanism. Entries for mechanisms other
+// than SCRAM are ignored. MongoDB's SCRAM-SHA-1 keys are derived from the
+// digest computed by mongodb.PasswordDigest rather than the password itself,
+// which only matters to clients.
+func ParseMongoDB(data []byte) ([]*Credential, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("scramcred: invalid credentials document: %v", err)
+	}
+
+	var creds []*Credential
+	for mechName, raw := range doc {
+		if !strings.HasPrefix(mechName, "SCRAM-") {
+			continue
+		}
+
+		var mc mongoCredential
+		if err := json.Unmarshal(raw, &mc); err != nil {
+			return nil, fmt.Errorf("scramcred: invalid %s credential: %v", mechName, err)
+		}
+
+		c := &Credential{Mechanism: mechName, Iterations: mc.IterationCount}
+		var err error
+		if c.Salt, err = decode("salt", mc.Salt); err != nil {
+			return nil, err
+		}
+		if c.StoredKey, err = decode("stored key", mc.StoredKey); err != nil {
+			return nil, err
+		}
+		if c.ServerKey, err = decode("server key", mc.ServerKey); err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+
+	sort.Slice(creds, func(i, j int) bool { return creds[i].Mechanism < creds[j].Mechanism })
+	return creds, nil
+}
+
+// MarshalMongoDB formats credentials as the JSON form of a MongoDB
+// credentials document.
+func MarshalMongoDB(creds []*Credential) ([]byte, error) {
+	doc := make(map[string]mongoCredential, len(creds))
+	for _, c := range creds {
+		doc[c.Mechanism] = mongoCredential{
+			IterationCount: c.Iterations,
+			Salt:           encode(c.Salt),
+			StoredKey:      encode(c.StoredKey),
+			ServerKey:      encode(c.ServerKey),
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func encode(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decode(name, s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("scramcred: invalid credential: invalid %s", name)
+	}
+	return b, nil
+}
+
+// Derive derives the credential for password with the named SCRAM mechanism:
+// SCRAM-SHA-1, SCRAM-SHA-256 or SCRAM-SHA-512.
+func Derive(mechName, password string, salt []byte, iterations int) (*Credential, error) {
+	hash := hashes[mechName]
+	if hash == nil {
+		return nil, fmt.Errorf("scramcred: unsupported mechanism %s", mechName)
+	}
+	if iterations <= 0 {
+		return nil, fmt.Errorf("scramcred: invalid iterations %d", iterations)
+	}
+
+	clientKey, storedKey, serverKey := hash.GenerateKeys(password, salt, iterations)
+	clear(clientKey)
+
+	return &Credential{
+		Mechanism:  mechName,
+		Iterations: iterations,
+		Salt:       salt,
+		StoredKey:  storedKey,
+		ServerKey:  serverKey,
+	}, nil
+}
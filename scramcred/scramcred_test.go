@@ -0,0 +1,217 @@
+package scramcred_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/scramcred"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+// the RFC5802 example credential for user "user" with password "pencil".
+const pencil = "SCRAM-SHA-1$4096:QSXCR+Q6sek8bf92$6dlGYMOdZcOPutkcNY8U2g7vK9Y=:D+CSWLOshSulAsxiupA+qs2/fTE="
+
+func TestParse(t *testing.T) {
+	salt, _ := base64.StdEncoding.DecodeString("QSXCR+Q6sek8bf92")
+	_, storedKey, serverKey := scramsha1.GenerateKeys("pencil", salt, 4096)
+
+	c, err := scramcred.Parse(pencil)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	if c.Mechanism != scramsha1.MechName || c.Iterations != 4096 || !bytes.Equal(c.Salt, salt) {
+		t.Fatalf("unexpected credential %+v", c)
+	}
+	if !bytes.Equal(c.StoredKey, storedKey) || !bytes.Equal(c.ServerKey, serverKey) {
+		t.Fatalf("keys do not match the password")
+	}
+	if c.String() != pencil {
+		t.Fatalf("expected %q, but got %q", pencil, c.String())
+	}
+
+	pg := "SCRAM-SHA-256$4096:c2FsdA==$c3RvcmVk:c2VydmVy"
+	c, err = scramcred.Parse(pg)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	if c.String() != pg {
+		t.Fatalf("expected %q, but got %q", pg, c.String())
+	}
+	if storedUser, err := c.StoredUser(); err != nil || string(storedUser.Salt) != "salt" {
+		t.Fatalf("expected a SCRAM-SHA-256 stored user, but got %+v (%v)", storedUser, err)
+	}
+
+	c, err = scramcred.Parse("SCRAM-MD5$4096:c2FsdA==$c3RvcmVk:c2VydmVy")
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	_, err = c.StoredUser()
+	testhelpers.VerifyError(t, "convert", "scramcred: SCRAM-MD5 credential cannot be used with scramsha1", err)
+
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"SCRAM-SHA-1$4096:c2FsdA==", "scramcred: invalid credential: expected 3 '$' separated parts"},
+		{"SCRAM-SHA-1$4096$c3RvcmVk:c2VydmVy", "scramcred: invalid credential: expected iterations and salt"},
+		{"SCRAM-SHA-1$4096:c2FsdA==$c3RvcmVk", "scramcred: invalid credential: expected stored key and server key"},
+		{"SCRAM-SHA-1$0:c2FsdA==$c3RvcmVk:c2VydmVy", "scramcred: invalid credential: invalid iterations \"0\""},
+		{"SCRAM-SHA-1$4096:!!$c3RvcmVk:c2VydmVy", "scramcred: invalid credential: invalid salt"},
+		{"SCRAM-SHA-1$4096:c2FsdA==$:c2VydmVy", "scramcred: invalid credential: invalid stored key"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := scramcred.Parse(test.input)
+			testhelpers.VerifyError(t, "parse", test.err, err)
+		})
+	}
+}
+
+func TestMongoDB(t *testing.T) {
+	sha1, _ := scramcred.Parse(pencil)
+	sha256, _ := scramcred.Parse("SCRAM-SHA-256$15000:c2FsdA==$c3RvcmVk:c2VydmVy")
+
+	doc, err := scramcred.MarshalMongoDB([]*scramcred.Credential{sha256, sha1})
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	creds, err := scramcred.ParseMongoDB(doc)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	if len(creds) != 2 || creds[0].String() != sha1.String() || creds[1].String() != sha256.String() {
+		t.Fatalf("unexpected credentials %v", creds)
+	}
+
+	creds, err = scramcred.ParseMongoDB([]byte(`{"MONGODB-CR": "x", "SCRAM-SHA-1": {"iterationCount": 10000, "salt": "c2FsdA==", "storedKey": "c3RvcmVk", "serverKey": "c2VydmVy"}}`))
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	if len(creds) != 1 || creds[0].Iterations != 10000 {
+		t.Fatalf("unexpected credentials %v", creds)
+	}
+
+	_, err = scramcred.ParseMongoDB([]byte(`{"SCRAM-SHA-1": {"iterationCount": 10000, "salt": "", "storedKey": "c3RvcmVk", "serverKey": "c2VydmVy"}}`))
+	testhelpers.VerifyError(t, "parse", "scramcred: invalid credential: invalid salt", err)
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scram")
+	write := func(content string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("unable to write file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("unable to set file time: %v", err)
+		}
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("# users\n\nuser:"+pencil+"\n", start)
+
+	store, err := scramcred.NewFileStore(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	defer store.Close()
+
+	storedUser, err := store.StoredUser(context.Background(), "user")
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	if storedUser.Iterations != 4096 {
+		t.Fatalf("unexpected stored user %+v", storedUser)
+	}
+
+	_, err = store.StoredUser(context.Background(), "jack")
+	testhelpers.VerifyError(t, "lookup", "scramcred: no SCRAM-SHA-1 credential for user \"jack\": scramsha1: unknown user", err)
+	_, err = store.StoredUserProvider("SCRAM-SHA-256")(context.Background(), "user")
+	testhelpers.VerifyError(t, "lookup", "scramcred: no SCRAM-SHA-256 credential for user \"user\": scramsha1: unknown user", err)
+
+	write("jack:"+pencil+"\n", start.Add(time.Minute))
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Lookup("jack", scramsha1.MechName) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the file to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if store.Lookup("user", scramsha1.MechName) != nil {
+		t.Fatalf("expected removed user to be gone")
+	}
+
+	write("jack\n", start.Add(2*time.Minute))
+	err = store.Reload()
+	testhelpers.VerifyError(t, "reload", "scramcred: line 1: expected username and credential", err)
+	testhelpers.VerifyError(t, "reload", "scramcred: line 1: expected username and credential", store.LastError())
+	if store.Lookup("jack", scramsha1.MechName) == nil {
+		t.Fatalf("expected previous credentials to be kept")
+	}
+}
+
+func TestDerive(t *testing.T) {
+	c, err := scramcred.Derive("SCRAM-SHA-1", "pencil", []byte("salt"), 4096)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	_, storedKey, serverKey := scramsha1.GenerateKeys("pencil", []byte("salt"), 4096)
+	if !bytes.Equal(c.StoredKey, storedKey) || !bytes.Equal(c.ServerKey, serverKey) {
+		t.Fatalf("expected keys to match scramsha1")
+	}
+
+	// the RFC7677 example for user "user" with password "pencil".
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	c, err = scramcred.Derive("SCRAM-SHA-256", "pencil", salt, 4096)
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	authMessage := "n=user,r=rOprNGfwEbeRWgbNEkqO," +
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096," +
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	mac := hmac.New(sha256.New, c.ServerKey)
+	mac.Write([]byte(authMessage))
+	if base64.StdEncoding.EncodeToString(mac.Sum(nil)) != "6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=" {
+		t.Fatalf("expected the server key to produce the RFC7677 server signature")
+	}
+
+	_, err = scramcred.Derive("SCRAM-MD5", "pencil", salt, 4096)
+	testhelpers.VerifyError(t, "derive", "scramcred: unsupported mechanism SCRAM-MD5", err)
+}
+
+func TestDeriveExchange(t *testing.T) {
+	// using math/rand to make the nonces predictable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	for _, hash := range []*scramsha1.Hash{scramsha1.SHA1, scramsha1.SHA256, scramsha1.SHA512} {
+		t.Run(hash.Name, func(t *testing.T) {
+			c, err := scramcred.Derive(hash.MechName(false), "pencil", []byte("salt"), 4096)
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+			storedUserProvider := func(context.Context, string) (*scramsha1.StoredUser, error) {
+				return c.StoredUser()
+			}
+
+			client := scramsha1.NewClientMech("", "user", "pencil", 16, mr)
+			client.SetHash(hash)
+			server := scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+			server.SetHash(hash)
+			testhelpers.RunClientServerTest(t, client, server, "", "")
+
+			if result := server.Result(); result.Mechanism != c.Mechanism {
+				t.Fatalf("expected a %s result, but got %+v", c.Mechanism, result)
+			}
+		})
+	}
+}
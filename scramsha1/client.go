@@ -1,75 +1,195 @@
 package scramsha1
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
+	hmaclib "crypto/hmac"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
-)
 
-var usernameSanitizer = strings.NewReplacer("=", "=3D", ",", "=2D")
+	"github.com/craiggwilson/go-sasl"
+)
 
 // NewClientMech creates a new ClientMech.
 func NewClientMech(authz, username, password string, nonceLen uint16, nonceSource io.Reader) *ClientMech {
 	return &ClientMech{
 		authz:       authz,
 		username:    username,
-		password:    password,
+		password:    []byte(password),
+		hash:        SHA1,
+		nonceLen:    nonceLen,
+		nonceSource: nonceSource,
+	}
+}
+
+// NewClientMechWithProvider creates a ClientMech obtaining its credentials
+// from provider: the username when the exchange starts and, unless provided
+// along with the username, the password or salted password once the server
+// has sent the salt and iteration count.
+func NewClientMechWithProvider(provider sasl.CredentialProvider, nonceLen uint16, nonceSource io.Reader) *ClientMech {
+	return &ClientMech{
+		provider:    provider,
+		hash:        SHA1,
 		nonceLen:    nonceLen,
 		nonceSource: nonceSource,
 	}
 }
 
-// ClientMech implements the client side portion of SCRAM-SHA-1.
+// NewClientMechWithKeys creates a ClientMech authenticating with keys
+// derived beforehand, e.g. by an earlier exchange, instead of a password. The
+// exchange fails if the server sends a different salt or iteration count.
+func NewClientMechWithKeys(authz, username string, keys *Keys, nonceLen uint16, nonceSource io.Reader) *ClientMech {
+	return &ClientMech{
+		authz:       authz,
+		username:    username,
+		keys:        keys,
+		hash:        SHA1,
+		nonceLen:    nonceLen,
+		nonceSource: nonceSource,
+	}
+}
+
+// ClientMech implements the client side portion of SCRAM-SHA-1, or of
+// another SCRAM mechanism once SetHash is called.
 type ClientMech struct {
 	authz       string
 	username    string
-	password    string
+	password    []byte
+	keys        *Keys
+	ownsKeys    bool
+	retainKeys  bool
+	keyCache    KeyCache
+	provider    sasl.CredentialProvider
+	hash        *Hash
 	nonceLen    uint16
 	nonceSource io.Reader
+	extensions  map[string]string
+	cbType      string
+	cbData      []byte
+	cbSupported bool
 
 	// state
 	step                   uint8
 	clientNonce            []byte
+	gs2header              string
 	clientFirstMessageBare string
 	serverSignature        []byte
+	pendingCacheKey        *KeyCacheKey
+}
+
+// SetHash makes the mechanism use hash instead of SHA-1, e.g. SHA256 for
+// SCRAM-SHA-256.
+func (m *ClientMech) SetHash(hash *Hash) {
+	m.hash = hash
+}
+
+// SetKeyCache makes the mechanism look up the keys for its credentials in
+// cache before deriving them from the password, and store them afterwards.
+func (m *ClientMech) SetKeyCache(cache KeyCache) {
+	m.keyCache = cache
+}
+
+// Keys returns the keys used by the exchange once the server's salt and
+// iteration count have been received, or nil before then. Keys derived by
+// the mechanism are wiped once the exchange ends, unless SetRetainKeys is
+// called or they are stored in the KeyCache.
+func (m *ClientMech) Keys() *Keys {
+	return m.keys
+}
+
+// SetRetainKeys makes the mechanism leave the keys it derives for the caller
+// to get with Keys once the exchange ends, e.g. to create the next
+// mechanism with NewClientMechWithKeys, instead of wiping them.
+func (m *ClientMech) SetRetainKeys(retain bool) {
+	m.retainKeys = retain
+}
+
+// SetExtensions sets extension attributes to append to the client-first
+// message, such as the tokenauth extension used by Kafka delegation tokens.
+func (m *ClientMech) SetExtensions(extensions map[string]string) {
+	m.extensions = extensions
+}
+
+// SetChannelBinding binds the exchange to the underlying channel using the
+// channel binding type and data, selecting the -PLUS variant of the
+// mechanism, such as SCRAM-SHA-1-PLUS.
+func (m *ClientMech) SetChannelBinding(cbType string, data []byte) {
+	m.cbType = cbType
+	m.cbData = data
+}
+
+// SetChannelBindingSupported tells the mechanism that the client could bind
+// the exchange to the channel although the server did not offer the -PLUS
+// variant of the mechanism. The client-first-message then carries the "y" flag, so
+// that a server which did offer it detects that the offer was stripped.
+func (m *ClientMech) SetChannelBindingSupported(supported bool) {
+	m.cbSupported = supported
 }
 
 // Start initializes the mechanism and begins the authentication exchange.
-func (m *ClientMech) Start(_ context.Context) (string, []byte, error) {
+func (m *ClientMech) Start(ctx context.Context) (string, []byte, error) {
+	mechName := m.mechName()
+
+	if m.provider != nil {
+		cred, err := m.provider(ctx, &sasl.CredentialRequest{
+			Mechanism: mechName,
+			Types:     sasl.CredentialUsername,
+			Prompt:    "Username",
+		})
+		if err != nil {
+			return mechName, nil, fmt.Errorf("unable to obtain credentials: %w", err)
+		}
+		m.authz, m.username, m.password = cred.Authz, cred.Username, cred.Password
+	}
+
 	var err error
 	m.clientNonce, err = generateNonce(m.nonceLen, m.nonceSource)
 	if err != nil {
-		return MechName, nil, fmt.Errorf("unable to generate nonce of length %d: %v", m.nonceLen, err)
+		return mechName, nil, fmt.Errorf("unable to generate nonce of length %d: %v", m.nonceLen, err)
 	}
 
-	gs2header := "n,"
-	if m.authz != "" {
-		gs2header += "a=" + m.authz
+	msg := &ClientFirstMessage{
+		CBFlag:     "n",
+		Authz:      m.authz,
+		Username:   m.username,
+		Nonce:      string(m.clientNonce),
+		Extensions: sortedExtensions(m.extensions),
 	}
-	gs2header += ","
-
-	m.clientFirstMessageBare = "n=" + usernameSanitizer.Replace(m.username) + ",r=" + string(m.clientNonce)
+	switch {
+	case m.cbType != "":
+		msg.CBFlag, msg.CBName = "p", m.cbType
+	case m.cbSupported:
+		msg.CBFlag = "y"
+	}
+	m.gs2header = msg.GS2Header()
+	m.clientFirstMessageBare = msg.Bare()
 
-	clientFirstMessage := gs2header + m.clientFirstMessageBare
+	return mechName, []byte(msg.String()), nil
+}
 
-	return MechName, []byte(clientFirstMessage), nil
+// mechName returns the name of the negotiated variant of the mechanism.
+func (m *ClientMech) mechName() string {
+	return m.hash.MechName(m.cbType != "")
 }
 
 // Next continues the exchange.
 func (m *ClientMech) Next(ctx context.Context, challenge []byte) ([]byte, error) {
 	m.step++
+	var response []byte
+	var err error
 	switch m.step {
 	case 1:
-		return m.step1(ctx, challenge)
+		response, err = m.step1(ctx, challenge)
 	case 2:
-		return m.step2(ctx, challenge)
+		response, err = m.step2(ctx, challenge)
 	default:
-		return nil, fmt.Errorf("unexpected challenge")
+		err = fmt.Errorf("unexpected challenge")
+	}
+
+	if err != nil || m.Completed() {
+		m.Dispose()
 	}
+	return response, err
 }
 
 // Completed indicates if the authentication exchange is complete from
@@ -78,75 +198,119 @@ func (m *ClientMech) Completed() bool {
 	return m.step >= 2
 }
 
-func (m *ClientMech) step1(ctx context.Context, challenge []byte) ([]byte, error) {
-	fields := bytes.Split(challenge, []byte{','})
-	if len(fields) < 3 {
-		return nil, fmt.Errorf("invalid challenge")
+// Dispose wipes the password, the expected server signature and the Keys
+// derived by the mechanism. Keys passed to NewClientMechWithKeys, shared with
+// the KeyCache or retained with SetRetainKeys are left alone.
+func (m *ClientMech) Dispose() {
+	clear(m.password)
+	clear(m.serverSignature)
+	if m.ownsKeys && !m.retainKeys {
+		clear(m.keys.ClientKey)
+		clear(m.keys.ServerKey)
+		m.keys = nil
+		m.ownsKeys = false
 	}
+}
 
-	if !bytes.HasPrefix(fields[0], []byte("r=")) {
-		return nil, fmt.Errorf("invalid challenge: expected nonce")
+func (m *ClientMech) step1(ctx context.Context, challenge []byte) ([]byte, error) {
+	msg, err := ParseServerFirstMessage(challenge)
+	if err != nil {
+		return nil, err
 	}
-	r := fields[0][2:]
-	if !bytes.HasPrefix(r, m.clientNonce) {
+	if len(msg.Nonce) <= len(m.clientNonce) || !strings.HasPrefix(msg.Nonce, string(m.clientNonce)) {
 		return nil, fmt.Errorf("invalid challenge: nonce mismatch")
 	}
 
-	if !bytes.HasPrefix(fields[1], []byte("s=")) {
-		return nil, fmt.Errorf("invalid challenge: expected salt")
+	final := &ClientFinalMessage{
+		ChannelBinding: append([]byte(m.gs2header), m.cbData...),
+		Nonce:          msg.Nonce,
 	}
-	s := make([]byte, base64.StdEncoding.DecodedLen(len(fields[1][2:])))
-	n, err := base64.StdEncoding.Decode(s, fields[1][2:])
-	if err != nil {
-		return nil, fmt.Errorf("invalid challenge: invalid salt")
-	}
-	s = s[:n]
+	authMessage := m.clientFirstMessageBare + "," + string(challenge) + "," + final.WithoutProof()
 
-	if !bytes.HasPrefix(fields[2], []byte("i=")) {
-		return nil, fmt.Errorf("invalid challenge: expected iteration-count")
-	}
-	i, err := strconv.Atoi(string(fields[2][2:]))
+	keys, owned, err := m.deriveKeys(ctx, msg.Salt, msg.Iterations)
 	if err != nil {
-		return nil, fmt.Errorf("invalid challenge: invalid iteration-count")
+		return nil, err
 	}
+	m.keys, m.ownsKeys = keys, owned
+	clear(m.password)
+	storedKey := m.hash.sum(keys.ClientKey)
 
-	const channelBinding = "c=biws" // base64 of gs2-channel-binding
+	clientSignature := m.hash.hmac(storedKey, authMessage)
+	m.serverSignature = m.hash.hmac(keys.ServerKey, authMessage)
 
-	clientFinalMessageWithoutProof := channelBinding + ",r=" + string(r)
-	authMessage := m.clientFirstMessageBare + "," + string(challenge) + "," + clientFinalMessageWithoutProof
+	final.Proof = xor(keys.ClientKey, clientSignature)
+	clear(clientSignature)
+	clear(storedKey)
+	return []byte(final.String()), nil
+}
 
-	// TODO: it's possible to cache the stored key and server key
-	clientKey, storedKey, serverKey := GenerateKeys(m.password, s, uint16(i))
+// deriveKeys returns the keys for the server's salt and iteration count, using
+// pre-derived or cached keys when available, and whether they were derived by
+// the mechanism.
+func (m *ClientMech) deriveKeys(ctx context.Context, salt []byte, iterations int) (*Keys, bool, error) {
+	if m.keys != nil {
+		if !m.keys.matches(salt, iterations) {
+			return nil, false, fmt.Errorf("invalid challenge: salt or iteration-count differs from the derived keys")
+		}
+		if len(m.keys.ClientKey) != m.hash.New().Size() {
+			return nil, false, fmt.Errorf("the derived keys are not %s keys", m.hash.Name)
+		}
+		return m.keys, false, nil
+	}
 
-	clientSignature := hmac(storedKey, authMessage)
-	m.serverSignature = hmac(serverKey, authMessage)
+	password := m.password
+	if m.provider != nil && len(password) == 0 {
+		cred, err := m.provider(ctx, &sasl.CredentialRequest{
+			Mechanism:  m.mechName(),
+			Types:      sasl.CredentialPassword | sasl.CredentialSaltedPassword,
+			Username:   m.username,
+			Prompt:     "Password for " + m.username,
+			Salt:       salt,
+			Iterations: iterations,
+		})
+		if err != nil {
+			return nil, false, fmt.Errorf("unable to obtain credentials: %w", err)
+		}
 
-	clientProof := xor(clientKey, clientSignature)
-	proof := "p=" + base64.StdEncoding.EncodeToString(clientProof)
-	clientFinalMessage := clientFinalMessageWithoutProof + "," + proof
-	return []byte(clientFinalMessage), nil
-}
+		if cred.SaltedPassword != nil {
+			defer clear(cred.SaltedPassword)
+			return m.hash.NewKeys(cred.SaltedPassword, salt, iterations), true, nil
+		}
+		m.password = cred.Password
+		password = m.password
+	}
 
-func (m *ClientMech) step2(ctx context.Context, challenge []byte) ([]byte, error) {
-	fields := bytes.Split(challenge, []byte{','})
-	if bytes.HasPrefix(fields[0], []byte("e=")) {
-		return nil, fmt.Errorf(string(fields[0][2:]))
+	if m.keyCache == nil {
+		return m.hash.newKeysFromPassword(password, salt, iterations), true, nil
 	}
 
-	if !bytes.HasPrefix(fields[0], []byte("v=")) {
-		return nil, fmt.Errorf("invalid challenge: expected server signature")
+	cacheKey := newKeyCacheKey(m.hash, m.username, password, salt, iterations)
+	if keys, ok := m.keyCache.Get(cacheKey); ok {
+		return keys, false, nil
 	}
 
-	v := make([]byte, base64.StdEncoding.DecodedLen(len(fields[0][2:])))
-	n, err := base64.StdEncoding.Decode(v, fields[0][2:])
+	// the keys are only cached once the server has proven they are right.
+	m.pendingCacheKey = &cacheKey
+	return m.hash.newKeysFromPassword(password, salt, iterations), true, nil
+}
+
+func (m *ClientMech) step2(ctx context.Context, challenge []byte) ([]byte, error) {
+	msg, err := ParseServerFinalMessage(challenge)
 	if err != nil {
-		return nil, fmt.Errorf("invalid challenge: invalid server verification")
+		return nil, err
+	}
+	if msg.Error != "" {
+		return nil, &Error{ServerError: msg.Error, Message: msg.Error}
 	}
-	v = v[:n]
 
-	if !bytes.Equal(m.serverSignature, v) {
+	if !hmaclib.Equal(m.serverSignature, msg.Verifier) {
 		return nil, fmt.Errorf("invalid challenge: server signature mismatch")
 	}
 
+	if m.pendingCacheKey != nil {
+		m.keyCache.Put(*m.pendingCacheKey, m.keys)
+		m.ownsKeys = false
+	}
+
 	return nil, nil
 }
@@ -0,0 +1,110 @@
+package scramsha1
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+func TestDisposeWipesSecrets(t *testing.T) {
+	storedUserProvider := func(_ context.Context, username string) (*StoredUser, error) {
+		if username != "jack" {
+			return nil, ErrUnknownUser
+		}
+		_, storedKey, serverKey := GenerateKeys("password", []byte("blah"), 100)
+		return &StoredUser{Salt: []byte("blah"), Iterations: 100, StoredKey: storedKey, ServerKey: serverKey}, nil
+	}
+
+	// math/rand makes the nonces predictable. Actual implementations should
+	// use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		retain    bool
+		cache     bool
+		succeeds  bool
+		keysWiped bool
+	}{
+		{"completed", "jack", "password", false, false, true, true},
+		{"failed", "jack", "wrong", false, false, false, true},
+		{"unknown", "jane", "password", false, false, false, true},
+		{"retained", "jack", "password", true, false, true, false},
+		{"cached", "jack", "password", false, true, true, false},
+		{"failed-cached", "jack", "wrong", false, true, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := NewClientMech("", test.username, test.password, 16, mr)
+			client.SetRetainKeys(test.retain)
+			if test.cache {
+				client.SetKeyCache(NewLRUKeyCache(1))
+			}
+			server := NewServerMech(storedUserProvider, nil, 16, mr)
+			server.SetUnknownUserSecret([]byte("secret"), 0, 100)
+			password := client.password
+
+			_, response, err := client.Start(ctx)
+			if err != nil {
+				t.Fatalf("client failed to start: %v", err)
+			}
+			_, challenge, err := server.Start(ctx, response)
+			if err != nil {
+				t.Fatalf("server failed to start: %v", err)
+			}
+			if response, err = client.Next(ctx, challenge); err != nil {
+				t.Fatalf("client failed to provide response: %v", err)
+			}
+			serverSignature := client.serverSignature
+			keys := *client.keys
+			fake := server.storedUser
+			challenge, err = server.Next(ctx, response)
+			if (err == nil) != test.succeeds {
+				t.Fatalf("expected the server to succeed: %t, but got %v", test.succeeds, err)
+			}
+			if _, err = client.Next(ctx, challenge); (err == nil) != test.succeeds {
+				t.Fatalf("expected the client to succeed: %t, but got %v", test.succeeds, err)
+			}
+
+			if !isZero(password) || !isZero(serverSignature) {
+				t.Fatalf("expected the client's secrets to be wiped")
+			}
+			if wiped := isZero(keys.ClientKey) && isZero(keys.ServerKey); wiped != test.keysWiped {
+				t.Fatalf("expected the derived keys to be wiped: %t, but got %t", test.keysWiped, wiped)
+			}
+			if (client.Keys() == nil) != test.keysWiped {
+				t.Fatalf("expected the keys to be dropped: %t, but got %+v", test.keysWiped, client.Keys())
+			}
+			if server.storedUser != nil {
+				t.Fatalf("expected the server to drop the user's keys")
+			}
+			if test.username != "jack" && (!isZero(fake.StoredKey) || !isZero(fake.ServerKey)) {
+				t.Fatalf("expected the fake keys to be wiped")
+			}
+		})
+	}
+
+	// an abandoned exchange is wiped by Dispose.
+	client := NewClientMech("", "jack", "password", 16, mr)
+	password := client.password
+	if _, _, err := client.Start(ctx); err != nil {
+		t.Fatalf("client failed to start: %v", err)
+	}
+	client.Dispose()
+	if !isZero(password) {
+		t.Fatalf("expected the password to be wiped")
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return len(b) > 0
+}
@@ -0,0 +1,127 @@
+package scramsha1
+
+import (
+	"bytes"
+	"container/list"
+	hmaclib "crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"sync"
+)
+
+// Keys are the client side keys derived from a salted password.
+type Keys struct {
+	Salt       []byte
+	Iterations int
+	ClientKey  []byte
+	ServerKey  []byte
+}
+
+// NewKeys derives the SCRAM-SHA-1 Keys from a password already salted with
+// the given salt and iteration count.
+func NewKeys(saltedPassword, salt []byte, iterations int) *Keys {
+	return SHA1.NewKeys(saltedPassword, salt, iterations)
+}
+
+// KeyCacheKey identifies the Keys derived for a user. The password is
+// represented by a fingerprint keyed with a secret generated for the
+// process, so cache entries cannot be used to guess it.
+type KeyCacheKey struct {
+	Username            string
+	PasswordFingerprint string
+	Salt                string
+	Iterations          int
+	Hash                string
+}
+
+// KeyCache caches Keys so that reconnecting with the same credentials does
+// not repeat the expensive salting of the password. Implementations must be
+// safe for concurrent use.
+type KeyCache interface {
+	Get(key KeyCacheKey) (*Keys, bool)
+	Put(key KeyCacheKey, keys *Keys)
+}
+
+var fingerprintSecret struct {
+	once sync.Once
+	key  []byte
+}
+
+func newKeyCacheKey(hash *Hash, username string, password, salt []byte, iterations int) KeyCacheKey {
+	fingerprintSecret.once.Do(func() {
+		fingerprintSecret.key = make([]byte, 32)
+		rand.Read(fingerprintSecret.key)
+	})
+
+	mac := hmaclib.New(sha256.New, fingerprintSecret.key)
+	mac.Write(password)
+
+	return KeyCacheKey{
+		Username:            username,
+		PasswordFingerprint: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		Salt:                string(salt),
+		Iterations:          iterations,
+		Hash:                hash.Name,
+	}
+}
+
+// NewLRUKeyCache creates a KeyCache holding the size most recently used
+// entries.
+func NewLRUKeyCache(size int) *LRUKeyCache {
+	return &LRUKeyCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[KeyCacheKey]*list.Element),
+	}
+}
+
+// LRUKeyCache is a KeyCache evicting the least recently used entry when full.
+type LRUKeyCache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[KeyCacheKey]*list.Element
+}
+
+type lruEntry struct {
+	key  KeyCacheKey
+	keys *Keys
+}
+
+// Get implements KeyCache.
+func (c *LRUKeyCache) Get(key KeyCacheKey) (*Keys, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).keys, true
+}
+
+// Put implements KeyCache.
+func (c *LRUKeyCache) Put(key KeyCacheKey, keys *Keys) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry).keys = keys
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, keys: keys})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (k *Keys) matches(salt []byte, iterations int) bool {
+	return k.Iterations == iterations && bytes.Equal(k.Salt, salt)
+}
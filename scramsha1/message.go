@@ -0,0 +1,424 @@
+package scramsha1
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Server error values sent in the e= attribute of the server-final-message,
+// as defined by RFC5802 (https://tools.ietf.org/html/rfc5802#section-7).
+const (
+	ServerErrorInvalidEncoding                 = "invalid-encoding"
+	ServerErrorExtensionsNotSupported          = "extensions-not-supported"
+	ServerErrorInvalidProof                    = "invalid-proof"
+	ServerErrorChannelBindingsDontMatch        = "channel-bindings-dont-match"
+	ServerErrorServerDoesSupportChannelBinding = "server-does-support-channel-binding"
+	ServerErrorChannelBindingNotSupported      = "channel-binding-not-supported"
+	ServerErrorUnsupportedChannelBindingType   = "unsupported-channel-binding-type"
+	ServerErrorUnknownUser                     = "unknown-user"
+	ServerErrorInvalidUsernameEncoding         = "invalid-username-encoding"
+	ServerErrorNoResources                     = "no-resources"
+	ServerErrorOtherError                      = "other-error"
+)
+
+// maxIterations bounds the iteration count accepted by clients, so that a
+// server cannot make them spin.
+const maxIterations = 1 << 20
+
+// Error is an error of the exchange along with the server-error value it is,
+// or was, reported as.
+type Error struct {
+	ServerError string
+	Message     string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(serverError, format string, args ...interface{}) *Error {
+	return &Error{ServerError: serverError, Message: fmt.Sprintf(format, args...)}
+}
+
+// ServerErrorOf returns the server-error value to report err with, which is
+// other-error unless err is, or wraps, an *Error.
+func ServerErrorOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.ServerError
+	}
+	return ServerErrorOtherError
+}
+
+// Extension is an extension attribute. RFC5802 only allows single letter
+// names, but longer ones are accepted, as used by Kafka's tokenauth.
+type Extension struct {
+	Name  string
+	Value string
+}
+
+// ClientFirstMessage is the client-first-message.
+type ClientFirstMessage struct {
+	// CBFlag is "n", "y" or "p", in which case CBName is the channel binding
+	// type.
+	CBFlag     string
+	CBName     string
+	Authz      string
+	Username   string
+	Nonce      string
+	Extensions []Extension
+}
+
+// ParseClientFirstMessage parses and validates a client-first-message.
+func ParseClientFirstMessage(b []byte) (*ClientFirstMessage, error) {
+	fields := strings.Split(string(b), ",")
+	if len(fields) < 4 {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid client-first-message: expected gs2-header, username and nonce")
+	}
+
+	m := &ClientFirstMessage{}
+	switch {
+	case fields[0] == "n" || fields[0] == "y":
+		m.CBFlag = fields[0]
+	case strings.HasPrefix(fields[0], "p="):
+		m.CBFlag, m.CBName = "p", fields[0][2:]
+		if !isCBName(m.CBName) {
+			return nil, newError(ServerErrorInvalidEncoding, "invalid client-first-message: invalid channel binding type")
+		}
+	default:
+		return nil, newError(ServerErrorInvalidEncoding, "invalid client-first-message: expected p, n, or y")
+	}
+
+	if fields[1] != "" {
+		if !strings.HasPrefix(fields[1], "a=") {
+			return nil, newError(ServerErrorInvalidEncoding, "invalid client-first-message: expected authzid")
+		}
+		var ok bool
+		if m.Authz, ok = decodeSASLName(fields[1][2:]); !ok {
+			return nil, newError(ServerErrorInvalidEncoding, "invalid client-first-message: invalid authzid encoding")
+		}
+	}
+
+	attrs, err := parseAttrs("client-first-message", fields[2:])
+	if err != nil {
+		return nil, err
+	}
+	if attrs[0].Name == "m" {
+		return nil, newError(ServerErrorExtensionsNotSupported, "invalid client-first-message: mandatory extensions are not supported")
+	}
+
+	if attrs[0].Name != "n" {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid client-first-message: expected username")
+	}
+	var ok bool
+	if m.Username, ok = decodeSASLName(attrs[0].Value); !ok {
+		return nil, newError(ServerErrorInvalidUsernameEncoding, "invalid client-first-message: invalid username encoding")
+	}
+
+	if m.Nonce, err = parseNonce("client-first-message", attrs[1]); err != nil {
+		return nil, err
+	}
+
+	if m.Extensions, err = parseExtensions("client-first-message", attrs[2:]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GS2Header returns the gs2-header of the message.
+func (m *ClientFirstMessage) GS2Header() string {
+	header := m.CBFlag
+	if m.CBFlag == "p" {
+		header = "p=" + m.CBName
+	}
+	header += ","
+	if m.Authz != "" {
+		header += "a=" + saslNameEscaper.Replace(m.Authz)
+	}
+	return header + ","
+}
+
+// Bare returns the client-first-message-bare.
+func (m *ClientFirstMessage) Bare() string {
+	return "n=" + saslNameEscaper.Replace(m.Username) + ",r=" + m.Nonce + formatExtensions(m.Extensions)
+}
+
+// String returns the message as sent.
+func (m *ClientFirstMessage) String() string {
+	return m.GS2Header() + m.Bare()
+}
+
+// ServerFirstMessage is the server-first-message.
+type ServerFirstMessage struct {
+	Nonce      string
+	Salt       []byte
+	Iterations int
+	Extensions []Extension
+}
+
+// ParseServerFirstMessage parses and validates a server-first-message.
+func ParseServerFirstMessage(b []byte) (*ServerFirstMessage, error) {
+	attrs, err := parseAttrs("server-first-message", strings.Split(string(b), ","))
+	if err != nil {
+		return nil, err
+	}
+	if attrs[0].Name == "m" {
+		return nil, newError(ServerErrorExtensionsNotSupported, "invalid server-first-message: mandatory extensions are not supported")
+	}
+	if len(attrs) < 3 {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid server-first-message: expected nonce, salt and iteration-count")
+	}
+
+	m := &ServerFirstMessage{}
+	if m.Nonce, err = parseNonce("server-first-message", attrs[0]); err != nil {
+		return nil, err
+	}
+
+	if attrs[1].Name != "s" {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid server-first-message: expected salt")
+	}
+	if m.Salt, err = decodeBase64("server-first-message", "salt", attrs[1].Value); err != nil {
+		return nil, err
+	}
+
+	if attrs[2].Name != "i" {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid server-first-message: expected iteration-count")
+	}
+	i := attrs[2].Value
+	m.Iterations, err = strconv.Atoi(i)
+	if err != nil || i[0] < '1' || i[0] > '9' || m.Iterations > maxIterations {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid server-first-message: invalid iteration-count")
+	}
+
+	if m.Extensions, err = parseExtensions("server-first-message", attrs[3:]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// String returns the message as sent.
+func (m *ServerFirstMessage) String() string {
+	return "r=" + m.Nonce + ",s=" + base64.StdEncoding.EncodeToString(m.Salt) + ",i=" + strconv.Itoa(m.Iterations) + formatExtensions(m.Extensions)
+}
+
+// ClientFinalMessage is the client-final-message.
+type ClientFinalMessage struct {
+	// ChannelBinding is the gs2-header followed by the channel binding data.
+	ChannelBinding []byte
+	Nonce          string
+	Extensions     []Extension
+	Proof          []byte
+}
+
+// ParseClientFinalMessage parses and validates a client-final-message.
+func ParseClientFinalMessage(b []byte) (*ClientFinalMessage, error) {
+	attrs, err := parseAttrs("client-final-message", strings.Split(string(b), ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) < 3 {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid client-final-message: expected channel binding, nonce and proof")
+	}
+
+	m := &ClientFinalMessage{}
+	if attrs[0].Name != "c" {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid client-final-message: expected channel binding")
+	}
+	if m.ChannelBinding, err = decodeBase64("client-final-message", "channel binding", attrs[0].Value); err != nil {
+		return nil, err
+	}
+
+	if m.Nonce, err = parseNonce("client-final-message", attrs[1]); err != nil {
+		return nil, err
+	}
+
+	last := attrs[len(attrs)-1]
+	if last.Name != "p" {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid client-final-message: expected proof")
+	}
+	if m.Proof, err = decodeBase64("client-final-message", "proof", last.Value); err != nil {
+		return nil, err
+	}
+
+	if m.Extensions, err = parseExtensions("client-final-message", attrs[2:len(attrs)-1]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WithoutProof returns the client-final-message-without-proof.
+func (m *ClientFinalMessage) WithoutProof() string {
+	return "c=" + base64.StdEncoding.EncodeToString(m.ChannelBinding) + ",r=" + m.Nonce + formatExtensions(m.Extensions)
+}
+
+// String returns the message as sent.
+func (m *ClientFinalMessage) String() string {
+	return m.WithoutProof() + ",p=" + base64.StdEncoding.EncodeToString(m.Proof)
+}
+
+// ServerFinalMessage is the server-final-message, carrying either an Error
+// or the server's Verifier.
+type ServerFinalMessage struct {
+	Error      string
+	Verifier   []byte
+	Extensions []Extension
+}
+
+// ParseServerFinalMessage parses and validates a server-final-message.
+func ParseServerFinalMessage(b []byte) (*ServerFinalMessage, error) {
+	attrs, err := parseAttrs("server-final-message", strings.Split(string(b), ","))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ServerFinalMessage{}
+	switch attrs[0].Name {
+	case "e":
+		m.Error = attrs[0].Value
+	case "v":
+		if m.Verifier, err = decodeBase64("server-final-message", "verifier", attrs[0].Value); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, newError(ServerErrorInvalidEncoding, "invalid server-final-message: expected server error or verifier")
+	}
+
+	if m.Extensions, err = parseExtensions("server-final-message", attrs[1:]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// String returns the message as sent.
+func (m *ServerFinalMessage) String() string {
+	if m.Error != "" {
+		return "e=" + m.Error + formatExtensions(m.Extensions)
+	}
+	return "v=" + base64.StdEncoding.EncodeToString(m.Verifier) + formatExtensions(m.Extensions)
+}
+
+var saslNameEscaper = strings.NewReplacer("=", "=3D", ",", "=2C")
+
+// decodeSASLName reverses saslNameEscaper, rejecting any other use of '='.
+func decodeSASLName(s string) (string, bool) {
+	if s == "" || !utf8.ValidString(s) {
+		return "", false
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '=' {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(s[i:], "=2C"):
+			b.WriteByte(',')
+		case strings.HasPrefix(s[i:], "=3D"):
+			b.WriteByte('=')
+		default:
+			return "", false
+		}
+		i += 2
+	}
+	return b.String(), true
+}
+
+// parseAttrs splits fields into attributes, requiring at least one.
+func parseAttrs(msgName string, fields []string) ([]Extension, error) {
+	attrs := make([]Extension, 0, len(fields))
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || !isAlpha(name) || value == "" || !utf8.ValidString(value) || strings.IndexByte(value, 0) >= 0 {
+			return nil, newError(ServerErrorInvalidEncoding, "invalid %s: invalid attribute %q", msgName, field)
+		}
+		attrs = append(attrs, Extension{Name: name, Value: value})
+	}
+	if len(attrs) == 0 {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid %s: empty message", msgName)
+	}
+	return attrs, nil
+}
+
+// parseExtensions validates trailing attributes as extensions, rejecting
+// attributes defined by RFC5802 appearing out of place.
+func parseExtensions(msgName string, attrs []Extension) ([]Extension, error) {
+	for _, attr := range attrs {
+		if len(attr.Name) == 1 && strings.Contains("acemnprsvi", attr.Name) {
+			return nil, newError(ServerErrorInvalidEncoding, "invalid %s: unexpected attribute %s", msgName, attr.Name)
+		}
+	}
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+	return attrs, nil
+}
+
+func formatExtensions(extensions []Extension) string {
+	var s string
+	for _, e := range extensions {
+		s += "," + e.Name + "=" + e.Value
+	}
+	return s
+}
+
+// sortedExtensions returns the extensions in a map ordered by name.
+func sortedExtensions(extensions map[string]string) []Extension {
+	result := make([]Extension, 0, len(extensions))
+	for name, value := range extensions {
+		result = append(result, Extension{Name: name, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func parseNonce(msgName string, attr Extension) (string, error) {
+	if attr.Name != "r" {
+		return "", newError(ServerErrorInvalidEncoding, "invalid %s: expected nonce", msgName)
+	}
+	for i := 0; i < len(attr.Value); i++ {
+		if c := attr.Value[i]; c < 0x21 || c > 0x7e {
+			return "", newError(ServerErrorInvalidEncoding, "invalid %s: nonce contains non-printable characters", msgName)
+		}
+	}
+	return attr.Value, nil
+}
+
+// decodeBase64 decodes s, requiring it to be in canonical form.
+func decodeBase64(msgName, what, s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || base64.StdEncoding.EncodeToString(b) != s {
+		return nil, newError(ServerErrorInvalidEncoding, "invalid %s: invalid %s encoding", msgName, what)
+	}
+	return b, nil
+}
+
+func isAlpha(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isCBName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package scramsha1
+
+import (
+	"crypto/rand"
+	"io"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// defaultNonceLen is the nonce length used by mechanisms created by
+// sasl.NewServerWithDefaults and sasl.NewClientWithDefaults.
+const defaultNonceLen = 24
+
+// ServerConfig configures the SCRAM-SHA-1 and SCRAM-SHA-1-PLUS ServerMechs
+// created by sasl.NewServerWithDefaults, or those of another hash function.
+type ServerConfig struct {
+	// Hash selects the mechanisms configured, defaulting to SHA1. The
+	// StoredUserProvider must return keys derived with it.
+	Hash               *Hash
+	StoredUserProvider StoredUserProvider
+	// NonceLen and NonceSource default to 24 and crypto/rand.
+	NonceLen    uint16
+	NonceSource io.Reader
+	// UnknownUserSecret, UnknownUserSaltLen and UnknownUserIterations are
+	// passed to ServerMech.SetUnknownUserSecret. Without a secret, unknown
+	// users are not hidden.
+	UnknownUserSecret     []byte
+	UnknownUserSaltLen    int
+	UnknownUserIterations uint16
+}
+
+// MechName implements sasl.MechConfig.
+func (c *ServerConfig) MechName() string {
+	if c.Hash != nil {
+		return c.Hash.MechName(false)
+	}
+	return MechName
+}
+
+func init() {
+	Register(SHA1, sasl.MechStrengthChallengeResponse, sasl.MechStrengthChannelBinding)
+}
+
+// Register registers the SCRAM mechanism using hash, and its -PLUS variant,
+// with the given strengths for use by sasl.NewServerWithDefaults and
+// sasl.NewClientWithDefaults. Servers enable them when configured with a
+// ServerConfig for hash. It is called by the init function of the package
+// providing the hash function's mechanisms, such as scramsha256.
+func Register(hash *Hash, strength, plusStrength sasl.MechStrength) {
+	sasl.RegisterServerMech(hash.MechName(false), strength, 0, func(opts *sasl.ServerOptions) sasl.ServerMechFactory {
+		return serverMechFactory(opts, hash, false)
+	})
+	sasl.RegisterServerMech(hash.MechName(true), plusStrength, sasl.MechChannelBinding, func(opts *sasl.ServerOptions) sasl.ServerMechFactory {
+		return serverMechFactory(opts, hash, true)
+	})
+
+	sasl.RegisterClientMech(hash.MechName(false), strength, 0, func(opts *sasl.ClientOptions) sasl.ClientMechFactory {
+		return clientMechFactory(opts, hash, false)
+	})
+	sasl.RegisterClientMech(hash.MechName(true), plusStrength, sasl.MechChannelBinding, func(opts *sasl.ClientOptions) sasl.ClientMechFactory {
+		return clientMechFactory(opts, hash, true)
+	})
+}
+
+// serverMechFactory returns the factory for the mechanism using hash, or its
+// -PLUS variant binding the exchange to the connection's channel when plus is
+// set.
+func serverMechFactory(opts *sasl.ServerOptions, hash *Hash, plus bool) sasl.ServerMechFactory {
+	config, _ := opts.Config(hash.MechName(false)).(*ServerConfig)
+	if config == nil || config.StoredUserProvider == nil {
+		return nil
+	}
+
+	storedUserProvider := config.StoredUserProvider
+	authzVerifier := AuthzVerifier(opts.AuthzVerifier)
+	nonceLen, nonceSource := nonceOptions(config.NonceLen, config.NonceSource)
+	secret, saltLen, iterations := config.UnknownUserSecret, config.UnknownUserSaltLen, config.UnknownUserIterations
+	return func(state *sasl.ConnState) sasl.ServerMech {
+		mech := NewServerMech(storedUserProvider, authzVerifier, nonceLen, nonceSource)
+		mech.SetHash(hash)
+		mech.SetUnknownUserSecret(secret, saltLen, iterations)
+		if plus {
+			mech.SetChannelBinding(state.ChannelBindingType, state.ChannelBinding)
+		} else {
+			// the -PLUS variant is offered along with it whenever the
+			// connection has channel binding.
+			mech.SetChannelBindingSupported(state.HasChannelBinding())
+		}
+		return mech
+	}
+}
+
+// clientMechFactory returns the factory for the mechanism using hash, or its
+// -PLUS variant binding the exchange to the connection's channel when plus is
+// set.
+func clientMechFactory(opts *sasl.ClientOptions, hash *Hash, plus bool) sasl.ClientMechFactory {
+	if opts.Username == "" {
+		return nil
+	}
+
+	authz, username, password := opts.Authz, opts.Username, opts.Password
+	nonceLen, nonceSource := nonceOptions(0, nil)
+	return func(state *sasl.ConnState) sasl.ClientMech {
+		mech := NewClientMech(authz, username, "", nonceLen, nonceSource)
+		mech.password = append([]byte(nil), password...)
+		mech.SetHash(hash)
+		if plus {
+			mech.SetChannelBinding(state.ChannelBindingType, state.ChannelBinding)
+		} else {
+			// the -PLUS variant is preferred, so the mechanism is only
+			// used over a connection with channel binding when the server
+			// did not offer it.
+			mech.SetChannelBindingSupported(state.HasChannelBinding())
+		}
+		return mech
+	}
+}
+
+func nonceOptions(nonceLen uint16, nonceSource io.Reader) (uint16, io.Reader) {
+	if nonceLen == 0 {
+		nonceLen = defaultNonceLen
+	}
+	if nonceSource == nil {
+		nonceSource = rand.Reader
+	}
+	return nonceLen, nonceSource
+}
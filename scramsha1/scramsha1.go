@@ -1,25 +1,100 @@
 // Package scramsha1 implements the client and server portions of
-// RFC5802 (https://tools.ietf.org/html/rfc5802).
+// RFC5802 (https://tools.ietf.org/html/rfc5802). The mechanisms can be
+// switched to another hash function with SetHash, as done by the scramsha256
+// package for RFC7677 (https://tools.ietf.org/html/rfc7677).
 package scramsha1
 
 import (
 	hmaclib "crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
 	"io"
 
-	"golang.org/x/crypto/pbkdf2"
+	"github.com/craiggwilson/go-sasl/internal/pbkdf2"
 )
 
 // ScramSha1 mechanism name.
 const MechName = "SCRAM-SHA-1"
 
+// MechNamePlus is the name of the channel binding variant of the mechanism.
+const MechNamePlus = "SCRAM-SHA-1-PLUS"
+
+// Hash is a hash function a SCRAM mechanism is built on.
+type Hash struct {
+	// Name is the name of the hash function within the mechanism name, such
+	// as "SHA-1".
+	Name string
+	New  func() hash.Hash
+}
+
+// The hash functions of SCRAM-SHA-1, SCRAM-SHA-256 and SCRAM-SHA-512, the
+// latter being used by Kafka.
+var (
+	SHA1   = &Hash{Name: "SHA-1", New: sha1.New}
+	SHA256 = &Hash{Name: "SHA-256", New: sha256.New}
+	SHA512 = &Hash{Name: "SHA-512", New: sha512.New}
+)
+
+// MechName returns the name of the mechanism using the hash function, or of
+// its channel binding variant when plus is set.
+func (h *Hash) MechName(plus bool) string {
+	if plus {
+		return "SCRAM-" + h.Name + "-PLUS"
+	}
+	return "SCRAM-" + h.Name
+}
+
+// GenerateKeys generates all the keys needed for the mechanism.
+func (h *Hash) GenerateKeys(password string, salt []byte, iterations int) (clientKey []byte, storedKey []byte, serverKey []byte) {
+	saltedPassword := h.SaltPassword(password, salt, iterations)
+	defer clear(saltedPassword)
+	return h.deriveKeys(saltedPassword)
+}
+
+// SaltPassword returns the salted password, Hi(password, salt, i), from which
+// the keys are derived.
+func (h *Hash) SaltPassword(password string, salt []byte, iterations int) []byte {
+	return pbkdf2.Hi(h.New, []byte(password), salt, iterations)
+}
+
+// NewKeys derives the Keys from a password already salted with the given
+// salt and iteration count.
+func (h *Hash) NewKeys(saltedPassword, salt []byte, iterations int) *Keys {
+	clientKey, _, serverKey := h.deriveKeys(saltedPassword)
+	return &Keys{
+		Salt:       salt,
+		Iterations: iterations,
+		ClientKey:  clientKey,
+		ServerKey:  serverKey,
+	}
+}
+
 // GenerateKeys generates all the keys needed for the mechanism.
 func GenerateKeys(password string, salt []byte, iterations uint16) (clientKey []byte, storedKey []byte, serverKey []byte) {
-	// TODO: implement pbkdf2 locally to not need a dependency
-	saltedPassword := pbkdf2.Key([]byte(password), salt, int(iterations), 20, sha1.New)
-	clientKey = hmac(saltedPassword, "Client Key")
-	storedKey = h(clientKey)
-	serverKey = hmac(saltedPassword, "Server Key")
+	return SHA1.GenerateKeys(password, salt, int(iterations))
+}
+
+// SaltPassword returns the salted password, Hi(password, salt, i), from which
+// the keys are derived. It can be stored or handed to a CredentialProvider
+// in place of the password.
+func SaltPassword(password string, salt []byte, iterations uint16) []byte {
+	return SHA1.SaltPassword(password, salt, int(iterations))
+}
+
+// newKeysFromPassword derives the Keys from password, wiping the salted
+// password afterwards.
+func (h *Hash) newKeysFromPassword(password, salt []byte, iterations int) *Keys {
+	saltedPassword := pbkdf2.Hi(h.New, password, salt, iterations)
+	defer clear(saltedPassword)
+	return h.NewKeys(saltedPassword, salt, iterations)
+}
+
+func (h *Hash) deriveKeys(saltedPassword []byte) (clientKey []byte, storedKey []byte, serverKey []byte) {
+	clientKey = h.hmac(saltedPassword, "Client Key")
+	storedKey = h.sum(clientKey)
+	serverKey = h.hmac(saltedPassword, "Server Key")
 	return
 }
 
@@ -34,7 +109,7 @@ func generateNonce(length uint16, source io.Reader) ([]byte, error) {
 		}
 
 		for i := 0; i < n; i++ {
-			if nonceTemp[i] < 32 || nonceTemp[i] >= 127 || nonceTemp[i] == 44 {
+			if nonceTemp[i] <= 32 || nonceTemp[i] >= 127 || nonceTemp[i] == 44 {
 				continue
 			}
 			nonce[idx] = nonceTemp[i]
@@ -46,16 +121,16 @@ func generateNonce(length uint16, source io.Reader) ([]byte, error) {
 	}
 }
 
-func h(data []byte) []byte {
-	h := sha1.New()
-	h.Write(data)
-	return h.Sum(nil)
+func (h *Hash) sum(data []byte) []byte {
+	d := h.New()
+	d.Write(data)
+	return d.Sum(nil)
 }
 
-func hmac(data []byte, key string) []byte {
-	h := hmaclib.New(sha1.New, data)
-	io.WriteString(h, key)
-	return h.Sum(nil)
+func (h *Hash) hmac(data []byte, key string) []byte {
+	mac := hmaclib.New(h.New, data)
+	io.WriteString(mac, key)
+	return mac.Sum(nil)
 }
 
 func xor(a []byte, b []byte) []byte {
@@ -1,27 +1,21 @@
 package scramsha1_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"testing"
+	"testing/iotest"
 
+	"github.com/craiggwilson/go-sasl"
 	"github.com/craiggwilson/go-sasl/internal/testhelpers"
 	"github.com/craiggwilson/go-sasl/scramsha1"
 )
 
 func TestScramSha1Mech(t *testing.T) {
-
-	storedUserProvider := func(_ context.Context, username string) (*scramsha1.StoredUser, error) {
-		_, storedKey, serverKey := scramsha1.GenerateKeys("password", []byte("blah"), 100)
-		return &scramsha1.StoredUser{
-			Salt:       []byte("blah"),
-			Iterations: 100,
-			StoredKey:  storedKey,
-			ServerKey:  serverKey,
-		}, nil
-	}
-
 	authzVerifier := func(_ context.Context, username, authz string) error {
 		if authz != "" && authz != "jane" {
 			return fmt.Errorf("cannot impersonate %s", authz)
@@ -38,12 +32,11 @@ func TestScramSha1Mech(t *testing.T) {
 	}{
 		{"", "jack", "password", "", ""},
 		{"jane", "jack", "password", "", ""},
-		{"", "jack", "wrong", "sasl mechanism SCRAM-SHA-1: client failed to provide response: other-error", "sasl mechanism SCRAM-SHA-1: server failed to provide challenge: invalid response: client key mismatch"},
+		{"", "jack", "wrong", "sasl mechanism SCRAM-SHA-1: client failed to provide response: invalid-proof", "sasl mechanism SCRAM-SHA-1: server failed to provide challenge: invalid response: client key mismatch"},
 		{"joe", "jack", "password", "sasl mechanism SCRAM-SHA-1: client failed to provide response: other-error", "sasl mechanism SCRAM-SHA-1: server failed to provide challenge: jack is not authorized to act as joe"},
 	}
 
-	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
-	mr := rand.New(rand.NewSource(1))
+	mr := newNonceSource()
 
 	for _, test := range tests {
 		t.Run(fmt.Sprintf("%s:%s:%s", test.authz, test.username, test.password), func(t *testing.T) {
@@ -56,3 +49,515 @@ func TestScramSha1Mech(t *testing.T) {
 		})
 	}
 }
+
+func TestScramSha1MechResume(t *testing.T) {
+	mr := newNonceSource()
+	ctx := context.Background()
+
+	client := scramsha1.NewClientMech("", "jack", "password", 16, mr)
+	server := scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+
+	_, response, err := client.Start(ctx)
+	if err != nil {
+		t.Fatalf("client failed to start: %v", err)
+	}
+	_, challenge, err := server.Start(ctx, response)
+	if err != nil {
+		t.Fatalf("server failed to start: %v", err)
+	}
+
+	state, err := server.MarshalState()
+	if err != nil {
+		t.Fatalf("unable to export state: %v", err)
+	}
+
+	resumed := scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+	if err = resumed.UnmarshalState(state); err != nil {
+		t.Fatalf("unable to restore state: %v", err)
+	}
+	if resumed.Username != "jack" || resumed.Completed() {
+		t.Fatalf("expected an exchange in progress for jack, but got %q", resumed.Username)
+	}
+
+	if response, err = client.Next(ctx, challenge); err != nil {
+		t.Fatalf("client failed to provide response: %v", err)
+	}
+	if challenge, err = resumed.Next(ctx, response); err != nil {
+		t.Fatalf("resumed server failed to provide challenge: %v", err)
+	}
+	if _, err = client.Next(ctx, challenge); err != nil {
+		t.Fatalf("client failed to verify server: %v", err)
+	}
+	if !client.Completed() || !resumed.Completed() {
+		t.Fatalf("expected the exchange to be completed")
+	}
+	if result := resumed.Result(); result.AuthenticationID != "jack" || result.AuthorizationID != "jack" || result.ChannelBinding != "" {
+		t.Fatalf("expected jack to be authenticated without channel binding, but got %+v", result)
+	}
+
+	if _, err = resumed.MarshalState(); err == nil {
+		t.Fatalf("expected an error exporting a completed exchange")
+	}
+	if err = scramsha1.NewServerMech(storedUserProvider, nil, 16, mr).UnmarshalState([]byte(`{"Step":2}`)); err == nil {
+		t.Fatalf("expected an error restoring a completed exchange")
+	}
+}
+
+func TestScramSha1MechWithProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  *sasl.Credential
+		password  *sasl.Credential
+		clientErr string
+		serverErr string
+	}{
+		{"password-upfront", &sasl.Credential{Username: "jack", Password: []byte("password")}, nil, "", ""},
+		{"password-lazily", &sasl.Credential{Username: "jack"}, &sasl.Credential{Password: []byte("password")}, "", ""},
+		{"salted-password", &sasl.Credential{Username: "jack"}, &sasl.Credential{SaltedPassword: scramsha1.SaltPassword("password", []byte("blah"), 100)}, "", ""},
+		{"wrong", &sasl.Credential{Username: "jack"}, &sasl.Credential{Password: []byte("wrong")},
+			"sasl mechanism SCRAM-SHA-1: client failed to provide response: invalid-proof",
+			"sasl mechanism SCRAM-SHA-1: server failed to provide challenge: invalid response: client key mismatch"},
+		{"canceled-username", nil, nil,
+			"sasl mechanism SCRAM-SHA-1: unable to start exchange: unable to obtain credentials: sasl: credential request canceled",
+			"context canceled"},
+		{"canceled-password", &sasl.Credential{Username: "jack"}, nil,
+			"sasl mechanism SCRAM-SHA-1: client failed to provide response: unable to obtain credentials: sasl: credential request canceled",
+			"context canceled"},
+	}
+
+	mr := newNonceSource()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := func(_ context.Context, req *sasl.CredentialRequest) (*sasl.Credential, error) {
+				cred := test.username
+				if req.Types&sasl.CredentialUsername == 0 {
+					if req.Username != "jack" || string(req.Salt) != "blah" || req.Iterations != 100 {
+						t.Errorf("unexpected credential request %+v", req)
+					}
+					cred = test.password
+				}
+				if cred == nil {
+					return nil, sasl.ErrCanceled
+				}
+				return cred, nil
+			}
+
+			testhelpers.RunClientServerTest(t,
+				scramsha1.NewClientMechWithProvider(provider, 16, mr),
+				scramsha1.NewServerMech(storedUserProvider, nil, 16, mr),
+				test.clientErr,
+				test.serverErr,
+			)
+
+			for _, cred := range []*sasl.Credential{test.username, test.password} {
+				if cred != nil && (!wiped(cred.Password) || !wiped(cred.SaltedPassword)) {
+					t.Fatalf("expected the provided secrets to be wiped, but got %+v", cred)
+				}
+			}
+		})
+	}
+
+	// both credential requests name the negotiated variant.
+	var requested []string
+	provider := func(_ context.Context, req *sasl.CredentialRequest) (*sasl.Credential, error) {
+		requested = append(requested, req.Mechanism)
+		if req.Types&sasl.CredentialUsername != 0 {
+			return &sasl.Credential{Username: "jack"}, nil
+		}
+		return &sasl.Credential{Password: []byte("password")}, nil
+	}
+	client := scramsha1.NewClientMechWithProvider(provider, 16, mr)
+	client.SetChannelBinding("tls-unique", []byte("data"))
+	server := scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+	server.SetChannelBinding("tls-unique", []byte("data"))
+	testhelpers.RunClientServerTest(t, client, server, "", "")
+	if len(requested) != 2 || requested[0] != scramsha1.MechNamePlus || requested[1] != scramsha1.MechNamePlus {
+		t.Fatalf("expected two requests for %s, but got %v", scramsha1.MechNamePlus, requested)
+	}
+}
+
+// countingKeyCache records the use of a KeyCache.
+type countingKeyCache struct {
+	scramsha1.KeyCache
+	hits, puts int
+}
+
+func (c *countingKeyCache) Get(key scramsha1.KeyCacheKey) (*scramsha1.Keys, bool) {
+	keys, ok := c.KeyCache.Get(key)
+	if ok {
+		c.hits++
+	}
+	return keys, ok
+}
+
+func (c *countingKeyCache) Put(key scramsha1.KeyCacheKey, keys *scramsha1.Keys) {
+	c.puts++
+	c.KeyCache.Put(key, keys)
+}
+
+func TestScramSha1MechKeyCache(t *testing.T) {
+	mr := newNonceSource()
+
+	cache := &countingKeyCache{KeyCache: scramsha1.NewLRUKeyCache(1)}
+
+	tests := []struct {
+		username  string
+		password  string
+		clientErr string
+		serverErr string
+		hits      int
+		puts      int
+	}{
+		{"jack", "password", "", "", 0, 1},
+		{"jack", "password", "", "", 1, 1},
+		{"jack", "wrong",
+			"sasl mechanism SCRAM-SHA-1: client failed to provide response: invalid-proof",
+			"sasl mechanism SCRAM-SHA-1: server failed to provide challenge: invalid response: client key mismatch",
+			1, 1},
+		{"jane", "password", "", "", 1, 2},
+		{"jack", "password", "", "", 1, 3},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d:%s:%s", i, test.username, test.password), func(t *testing.T) {
+			client := scramsha1.NewClientMech("", test.username, test.password, 16, mr)
+			client.SetKeyCache(cache)
+
+			testhelpers.RunClientServerTest(t,
+				client,
+				scramsha1.NewServerMech(storedUserProvider, nil, 16, mr),
+				test.clientErr,
+				test.serverErr,
+			)
+
+			if cache.hits != test.hits || cache.puts != test.puts {
+				t.Fatalf("expected %d hits and %d puts, but got %d and %d", test.hits, test.puts, cache.hits, cache.puts)
+			}
+		})
+	}
+}
+
+func TestScramSha1MechWithKeys(t *testing.T) {
+	mr := newNonceSource()
+
+	first := scramsha1.NewClientMech("", "jack", "password", 16, mr)
+	first.SetRetainKeys(true)
+	testhelpers.RunClientServerTest(t, first, scramsha1.NewServerMech(storedUserProvider, nil, 16, mr), "", "")
+
+	tests := []struct {
+		name      string
+		keys      *scramsha1.Keys
+		clientErr string
+		serverErr string
+	}{
+		{"previous-exchange", first.Keys(), "", ""},
+		{"salted-password", scramsha1.NewKeys(scramsha1.SaltPassword("password", []byte("blah"), 100), []byte("blah"), 100), "", ""},
+		{"different-salt", scramsha1.NewKeys(scramsha1.SaltPassword("password", []byte("salt"), 100), []byte("salt"), 100),
+			"sasl mechanism SCRAM-SHA-1: client failed to provide response: invalid challenge: salt or iteration-count differs from the derived keys",
+			"context canceled"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testhelpers.RunClientServerTest(t,
+				scramsha1.NewClientMechWithKeys("", "jack", test.keys, 16, mr),
+				scramsha1.NewServerMech(storedUserProvider, nil, 16, mr),
+				test.clientErr,
+				test.serverErr,
+			)
+		})
+	}
+}
+
+func TestScramSha1MechUnknownUser(t *testing.T) {
+	mr := newNonceSource()
+	ctx := context.Background()
+
+	// joe's keys were upgraded to a higher iteration count than jack's.
+	provider := func(ctx context.Context, username string) (*scramsha1.StoredUser, error) {
+		if username == "joe" {
+			_, storedKey, serverKey := scramsha1.GenerateKeys("password", []byte("salt of joe"), 4096)
+			return &scramsha1.StoredUser{Salt: []byte("salt of joe"), Iterations: 4096, StoredKey: storedKey, ServerKey: serverKey}, nil
+		}
+		return jackOnlyProvider(ctx, username)
+	}
+
+	// each call stands for a separate instance, or the same one restarted.
+	serverFirst := func(username string) *scramsha1.ServerFirstMessage {
+		server := scramsha1.NewServerMech(provider, nil, 16, mr)
+		server.SetUnknownUserSecret([]byte("secret"), 4, 100)
+		_, challenge, err := server.Start(ctx, []byte("n,,n="+username+",r=abcdef"))
+		if err != nil {
+			t.Fatalf("expected no error for %s, but got %v", username, err)
+		}
+		msg, err := scramsha1.ParseServerFirstMessage(challenge)
+		if err != nil {
+			t.Fatalf("expected a server-first-message for %s, but got %v", username, err)
+		}
+		return msg
+	}
+
+	// unknown users look like known ones with the configured shape.
+	known, unknown := serverFirst("jack"), serverFirst("jane")
+	if len(unknown.Salt) != len(known.Salt) || unknown.Iterations != known.Iterations {
+		t.Fatalf("expected the salt length and iteration count of jack, %d and %d, but got %d and %d",
+			len(known.Salt), known.Iterations, len(unknown.Salt), unknown.Iterations)
+	}
+
+	// looking up a user with another shape does not change them.
+	serverFirst("joe")
+	if again := serverFirst("jane"); string(again.Salt) != string(unknown.Salt) || again.Iterations != unknown.Iterations {
+		t.Fatalf("expected a stable salt and iteration count, but got %q and %d, then %q and %d",
+			unknown.Salt, unknown.Iterations, again.Salt, again.Iterations)
+	}
+	if other := serverFirst("jill"); string(other.Salt) == string(unknown.Salt) {
+		t.Fatalf("expected unknown users to get different salts")
+	}
+
+	wrongPassword := "sasl mechanism SCRAM-SHA-1: server failed to provide challenge: invalid response: client key mismatch"
+	tests := []struct {
+		username  string
+		password  string
+		secret    []byte
+		clientErr string
+		serverErr string
+	}{
+		{"jack", "password", []byte("secret"), "", ""},
+		{"jack", "wrong", []byte("secret"), "sasl mechanism SCRAM-SHA-1: client failed to provide response: invalid-proof", wrongPassword},
+		{"jane", "password", []byte("secret"), "sasl mechanism SCRAM-SHA-1: client failed to provide response: invalid-proof", wrongPassword},
+		{"jane", "password", nil, "context canceled", "sasl mechanism SCRAM-SHA-1: unable to start exchange: could not get salt and iteration count for user 'jane'"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s:%s:%t", test.username, test.password, test.secret != nil), func(t *testing.T) {
+			server := scramsha1.NewServerMech(jackOnlyProvider, nil, 16, mr)
+			server.SetUnknownUserSecret(test.secret, 4, 100)
+			testhelpers.RunClientServerTest(t,
+				scramsha1.NewClientMech("", test.username, test.password, 16, mr),
+				server,
+				test.clientErr,
+				test.serverErr,
+			)
+		})
+	}
+}
+
+func TestParseMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		parse       func([]byte) (fmt.Stringer, error)
+		input       string
+		err         string
+		serverError string
+	}{
+		{"client-first", parseClientFirst, "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL", "", ""},
+		{"client-first authz", parseClientFirst, "p=tls-unique,a=j=2Co=3De,n=ja=2Cck,r=abc,x=ext", "", ""},
+		{"client-first short", parseClientFirst, "n,,n=user", "invalid client-first-message: expected gs2-header, username and nonce", scramsha1.ServerErrorInvalidEncoding},
+		{"client-first flag", parseClientFirst, "x,,n=user,r=abc", "invalid client-first-message: expected p, n, or y", scramsha1.ServerErrorInvalidEncoding},
+		{"client-first cb-name", parseClientFirst, "p=tls unique,,n=user,r=abc", "invalid client-first-message: invalid channel binding type", scramsha1.ServerErrorInvalidEncoding},
+		{"client-first authzid", parseClientFirst, "n,x=jane,n=user,r=abc", "invalid client-first-message: expected authzid", scramsha1.ServerErrorInvalidEncoding},
+		{"client-first mext", parseClientFirst, "n,,m=ext,n=user,r=abc", "invalid client-first-message: mandatory extensions are not supported", scramsha1.ServerErrorExtensionsNotSupported},
+		{"client-first username", parseClientFirst, "n,,r=abc,n=user", "invalid client-first-message: expected username", scramsha1.ServerErrorInvalidEncoding},
+		{"client-first username encoding", parseClientFirst, "n,,n=us=er,r=abc", "invalid client-first-message: invalid username encoding", scramsha1.ServerErrorInvalidUsernameEncoding},
+		{"client-first nonce", parseClientFirst, "n,,n=user,r=a\x01c", "invalid client-first-message: nonce contains non-printable characters", scramsha1.ServerErrorInvalidEncoding},
+		{"client-first attribute", parseClientFirst, "n,,n=user,r=abc,=x", "invalid client-first-message: invalid attribute \"=x\"", scramsha1.ServerErrorInvalidEncoding},
+		{"client-first duplicate", parseClientFirst, "n,,n=user,r=abc,r=def", "invalid client-first-message: unexpected attribute r", scramsha1.ServerErrorInvalidEncoding},
+		{"server-first", parseServerFirst, "r=abcdef,s=QSXCR+Q6sek8bf92,i=4096", "", ""},
+		{"server-first mext", parseServerFirst, "m=ext,r=abcdef,s=QSXCR+Q6sek8bf92,i=4096", "invalid server-first-message: mandatory extensions are not supported", scramsha1.ServerErrorExtensionsNotSupported},
+		{"server-first salt", parseServerFirst, "r=abcdef,s=QSXCR+Q6sek8bf9,i=4096", "invalid server-first-message: invalid salt encoding", scramsha1.ServerErrorInvalidEncoding},
+		{"server-first iterations", parseServerFirst, "r=abcdef,s=QSXCR+Q6sek8bf92,i=0", "invalid server-first-message: invalid iteration-count", scramsha1.ServerErrorInvalidEncoding},
+		{"server-first signed iterations", parseServerFirst, "r=abcdef,s=QSXCR+Q6sek8bf92,i=+1", "invalid server-first-message: invalid iteration-count", scramsha1.ServerErrorInvalidEncoding},
+		{"server-first huge iterations", parseServerFirst, "r=abcdef,s=QSXCR+Q6sek8bf92,i=2000000000", "invalid server-first-message: invalid iteration-count", scramsha1.ServerErrorInvalidEncoding},
+		{"server-first order", parseServerFirst, "r=abcdef,i=4096,s=QSXCR+Q6sek8bf92", "invalid server-first-message: expected salt", scramsha1.ServerErrorInvalidEncoding},
+		{"client-final", parseClientFinal, "c=biws,r=abcdef,x=ext,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=", "", ""},
+		{"client-final proof", parseClientFinal, "c=biws,r=abcdef", "invalid client-final-message: expected channel binding, nonce and proof", scramsha1.ServerErrorInvalidEncoding},
+		{"client-final trailing", parseClientFinal, "c=biws,r=abcdef,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=,x=ext", "invalid client-final-message: expected proof", scramsha1.ServerErrorInvalidEncoding},
+		{"client-final channel binding", parseClientFinal, "c=bi\nws,r=abcdef,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=", "invalid client-final-message: invalid channel binding encoding", scramsha1.ServerErrorInvalidEncoding},
+		{"server-final", parseServerFinal, "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=", "", ""},
+		{"server-final error", parseServerFinal, "e=invalid-proof", "", ""},
+		{"server-final unexpected", parseServerFinal, "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=,v=rmF9pqV8S7suAoZWja4dJRkFsKQ=", "invalid server-final-message: unexpected attribute v", scramsha1.ServerErrorInvalidEncoding},
+		{"server-final empty", parseServerFinal, "", "invalid server-final-message: invalid attribute \"\"", scramsha1.ServerErrorInvalidEncoding},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := test.parse([]byte(test.input))
+			testhelpers.VerifyError(t, "parse", test.err, err)
+			if err != nil {
+				if actual := scramsha1.ServerErrorOf(err); actual != test.serverError {
+					t.Fatalf("expected server error %s, but got %s", test.serverError, actual)
+				}
+				return
+			}
+			if msg.String() != test.input {
+				t.Fatalf("expected %q to serialize unchanged, but got %q", test.input, msg.String())
+			}
+		})
+	}
+
+	if actual := scramsha1.ServerErrorOf(fmt.Errorf("other")); actual != scramsha1.ServerErrorOtherError {
+		t.Fatalf("expected other-error, but got %s", actual)
+	}
+}
+
+func parseClientFirst(b []byte) (fmt.Stringer, error) { return scramsha1.ParseClientFirstMessage(b) }
+func parseServerFirst(b []byte) (fmt.Stringer, error) { return scramsha1.ParseServerFirstMessage(b) }
+func parseClientFinal(b []byte) (fmt.Stringer, error) { return scramsha1.ParseClientFinalMessage(b) }
+func parseServerFinal(b []byte) (fmt.Stringer, error) { return scramsha1.ParseServerFinalMessage(b) }
+
+func TestScramSha1MechStrict(t *testing.T) {
+	mr := newNonceSource()
+	ctx := context.Background()
+
+	// a short client-first-message used to panic.
+	_, _, err := scramsha1.NewServerMech(storedUserProvider, nil, 16, mr).Start(ctx, []byte("n,,n=jack"))
+	testhelpers.VerifyError(t, "server", "invalid client-first-message: expected gs2-header, username and nonce", err)
+
+	_, _, err = scramsha1.NewServerMech(storedUserProvider, nil, 16, mr).Start(ctx, []byte("p=tls-unique,,n=jack,r=abc"))
+	if scramsha1.ServerErrorOf(err) != scramsha1.ServerErrorChannelBindingNotSupported {
+		t.Fatalf("expected channel-binding-not-supported, but got %v", err)
+	}
+
+	server := scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+	server.SetChannelBinding("tls-unique", []byte("data"))
+	_, _, err = server.Start(ctx, []byte("y,,n=jack,r=abc"))
+	if scramsha1.ServerErrorOf(err) != scramsha1.ServerErrorServerDoesSupportChannelBinding {
+		t.Fatalf("expected server-does-support-channel-binding, but got %v", err)
+	}
+
+	// usernames are escaped by the client and unescaped by the server.
+	server = scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+	testhelpers.RunClientServerTest(t,
+		scramsha1.NewClientMech("", "ja,ck=", "password", 16, mr),
+		server,
+		"",
+		"",
+	)
+	if server.Username != "ja,ck=" {
+		t.Fatalf("expected username ja,ck=, but got %q", server.Username)
+	}
+
+	// a malformed client-final-message is answered with invalid-encoding.
+	server = scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+	if _, _, err = server.Start(ctx, []byte("n,,n=jack,r=abc")); err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	challenge, err := server.Next(ctx, []byte("c=biws,r=abc"))
+	testhelpers.VerifyError(t, "server", "invalid client-final-message: expected channel binding, nonce and proof", err)
+	if string(challenge) != "e=invalid-encoding" {
+		t.Fatalf("expected e=invalid-encoding, but got %q", challenge)
+	}
+}
+
+func TestScramSha1MechServerErrors(t *testing.T) {
+	failingProvider := func(context.Context, string) (*scramsha1.StoredUser, error) {
+		return nil, fmt.Errorf("database is down")
+	}
+
+	tests := []struct {
+		name        string
+		provider    scramsha1.StoredUserProvider
+		cbType      string
+		nonceSource io.Reader
+		response    string
+		serverError string
+	}{
+		{"invalid-encoding", storedUserProvider, "", nil, "x,,n=jack,r=abc", "invalid-encoding"},
+		{"extensions-not-supported", storedUserProvider, "", nil, "n,,m=ext,n=jack,r=abc", "extensions-not-supported"},
+		{"invalid-username-encoding", storedUserProvider, "", nil, "n,,n=ja=ck,r=abc", "invalid-username-encoding"},
+		{"channel-binding-not-supported", storedUserProvider, "", nil, "p=tls-server-end-point,,n=jack,r=abc", "channel-binding-not-supported"},
+		{"unsupported-channel-binding-type", storedUserProvider, "tls-server-end-point", nil, "p=tls-unique,,n=jack,r=abc", "unsupported-channel-binding-type"},
+		{"server-does-support-channel-binding", storedUserProvider, "tls-server-end-point", nil, "y,,n=jack,r=abc", "server-does-support-channel-binding"},
+		{"channel-binding-required", storedUserProvider, "tls-server-end-point", nil, "n,,n=jack,r=abc", "channel-bindings-dont-match"},
+		{"unknown-user", jackOnlyProvider, "", nil, "n,,n=jane,r=abc", "unknown-user"},
+		{"provider-failure", failingProvider, "", nil, "n,,n=jack,r=abc", "other-error"},
+		{"no-resources", storedUserProvider, "", iotest.ErrReader(errors.New("no entropy")), "n,,n=jack,r=abc", "no-resources"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nonceSource := test.nonceSource
+			if nonceSource == nil {
+				nonceSource = newNonceSource()
+			}
+			server := scramsha1.NewServerMech(test.provider, nil, 16, nonceSource)
+			if test.cbType != "" {
+				server.SetChannelBinding(test.cbType, []byte("data"))
+			}
+
+			_, challenge, err := server.Start(context.Background(), []byte(test.response))
+			if err == nil {
+				t.Fatalf("expected an error, but got none")
+			}
+			if challenge != nil {
+				t.Fatalf("expected no challenge, but got %q", challenge)
+			}
+			if actual := scramsha1.ServerErrorOf(err); actual != test.serverError {
+				t.Fatalf("expected %s, but got %v", test.serverError, err)
+			}
+		})
+	}
+}
+
+func TestScramSha1MechChannelBindingSupported(t *testing.T) {
+	mr := newNonceSource()
+
+	tests := []struct {
+		name            string
+		clientSupported bool
+		serverSupported bool
+		clientErr       string
+		serverErr       string
+	}{
+		{"neither", false, false, "", ""},
+		{"client", true, false, "", ""},
+		{"server", false, true, "", ""},
+		{"both", true, true,
+			"context canceled",
+			"sasl mechanism SCRAM-SHA-1: unable to start exchange: invalid initial response: server does support channel binding"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := scramsha1.NewClientMech("", "jack", "password", 16, mr)
+			client.SetChannelBindingSupported(test.clientSupported)
+			server := scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+			server.SetChannelBindingSupported(test.serverSupported)
+
+			testhelpers.RunClientServerTest(t, client, server, test.clientErr, test.serverErr)
+		})
+	}
+}
+
+// newNonceSource uses math/rand to make the nonces predictable. Actual
+// implementations should use crypto/rand.
+// wiped reports whether b holds only zeros.
+func wiped(b []byte) bool {
+	return bytes.Count(b, []byte{0}) == len(b)
+}
+
+func newNonceSource() *rand.Rand {
+	return rand.New(rand.NewSource(1))
+}
+
+// storedUserProvider returns the keys for the password "password" whatever
+// the username.
+func storedUserProvider(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+	_, storedKey, serverKey := scramsha1.GenerateKeys("password", []byte("blah"), 100)
+	return &scramsha1.StoredUser{
+		Salt:       []byte("blah"),
+		Iterations: 100,
+		StoredKey:  storedKey,
+		ServerKey:  serverKey,
+	}, nil
+}
+
+// jackOnlyProvider is a storedUserProvider reporting users other than jack
+// as unknown.
+func jackOnlyProvider(ctx context.Context, username string) (*scramsha1.StoredUser, error) {
+	if username != "jack" {
+		return nil, fmt.Errorf("no user %s: %w", username, scramsha1.ErrUnknownUser)
+	}
+	return storedUserProvider(ctx, username)
+}
@@ -3,10 +3,14 @@ package scramsha1
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
+	hmaclib "crypto/hmac"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"strconv"
+	"strings"
+
+	"github.com/craiggwilson/go-sasl"
 )
 
 // AuthzVerifier verifies the client's authorization identity.
@@ -17,6 +21,7 @@ func NewServerMech(storedUserProvider StoredUserProvider, verifier AuthzVerifier
 	return &ServerMech{
 		storedUserProvider: storedUserProvider,
 		verifier:           verifier,
+		hash:               SHA1,
 		nonceLen:           nonceLen,
 		nonceSource:        nonceSource,
 	}
@@ -31,50 +36,134 @@ type StoredUser struct {
 }
 
 // StoredUserProvider returns the salt and iteration count for a given user.
+// It returns an error wrapping ErrUnknownUser when the user does not exist.
 type StoredUserProvider func(ctx context.Context, username string) (*StoredUser, error)
 
-// ServerMech implements the server side portion of SCRAM-SHA-1.
+// ErrUnknownUser is returned, possibly wrapped, by a StoredUserProvider when
+// the user does not exist.
+var ErrUnknownUser = errors.New("scramsha1: unknown user")
+
+// defaultUnknownUserSaltLen and defaultUnknownUserIterations describe the
+// keys made up for unknown users unless configured otherwise.
+const (
+	defaultUnknownUserSaltLen    = 16
+	defaultUnknownUserIterations = 4096
+)
+
+type extensionsKey struct{}
+
+// ExtensionsFromContext returns the extension attributes sent by the client.
+// It is intended for use by a StoredUserProvider, which is called with a
+// context carrying the extensions.
+func ExtensionsFromContext(ctx context.Context) map[string]string {
+	extensions, _ := ctx.Value(extensionsKey{}).(map[string]string)
+	return extensions
+}
+
+// ServerMech implements the server side portion of SCRAM-SHA-1, or of
+// another SCRAM mechanism once SetHash is called.
 type ServerMech struct {
-	Authz    string
-	Username string
+	Authz      string
+	Username   string
+	Extensions map[string]string
 
 	verifier           AuthzVerifier
 	storedUserProvider StoredUserProvider
+	hash               *Hash
 	nonceLen           uint16
 	nonceSource        io.Reader
+	cbType             string
+	cbData             []byte
+	cbSupported        bool
+	unknownUserSecret  []byte
+	unknownUserSaltLen int
+	unknownUserIter    uint16
 
 	// state
 	step       uint8
 	storedUser *StoredUser
+	unknown    bool
+	gs2header  string
 
 	nonce                  string
 	clientFirstMessageBare string
 	serverFirstMessage     string
 }
 
+// SetHash makes the mechanism use hash instead of SHA-1, e.g. SHA256 for
+// SCRAM-SHA-256. The StoredUserProvider must then return keys derived with
+// hash.
+func (m *ServerMech) SetHash(hash *Hash) {
+	m.hash = hash
+}
+
+// SetChannelBinding requires the client to bind the exchange to the
+// underlying channel using the channel binding type and data, as done by the
+// -PLUS variant of the mechanism, such as SCRAM-SHA-1-PLUS.
+func (m *ServerMech) SetChannelBinding(cbType string, data []byte) {
+	m.cbType = cbType
+	m.cbData = data
+}
+
+// SetChannelBindingSupported tells the mechanism that its -PLUS variant was
+// offered alongside it. A client sending the "y" flag, claiming that the
+// server does not support channel binding, is then rejected, as the offer
+// must have been stripped on the way.
+func (m *ServerMech) SetChannelBindingSupported(supported bool) {
+	m.cbSupported = supported
+}
+
+// SetUnknownUserSecret hides which users exist. When the StoredUserProvider
+// reports ErrUnknownUser, the exchange continues with a salt of saltLen bytes
+// derived from the username and secret, and the given iteration count, and
+// fails at the proof as it does for a wrong password. A zero saltLen or
+// iterations stands for 16 bytes or 4096 iterations.
+//
+// The salt length and iteration count should be those of known users, and
+// the secret must be private and the same for every instance and across
+// restarts: an unknown user whose salt or iteration count differs from one
+// attempt to the next is given away. Without a secret, unknown users are
+// failed straight away with the unknown-user server error.
+func (m *ServerMech) SetUnknownUserSecret(secret []byte, saltLen int, iterations uint16) {
+	m.unknownUserSecret = secret
+	m.unknownUserSaltLen = saltLen
+	m.unknownUserIter = iterations
+}
+
 // Start initializes the mechanism and begins the authentication exchange.
 func (m *ServerMech) Start(ctx context.Context, initialResponse []byte) (string, []byte, error) {
 	if len(initialResponse) == 0 {
-		return MechName, nil, nil
+		return m.hash.MechName(false), nil, nil
 	}
 
 	challenge, err := m.Next(ctx, initialResponse)
-	return MechName, challenge, err
+	return m.hash.MechName(false), challenge, err
 }
 
-// Next continues the exchange.
+// Next continues the exchange. A failure of the client-final-message is
+// reported to the client with an e= attribute carrying the *Error's
+// server-error value, while that of the client-first-message only fails the
+// exchange, as RFC5802 has no message reporting it.
 func (m *ServerMech) Next(ctx context.Context, response []byte) ([]byte, error) {
 	m.step++
+	var challenge []byte
+	var err error
 	switch m.step {
 	case 1:
-		return m.step1(ctx, response)
+		challenge, err = m.step1(ctx, response)
 	case 2:
-		return m.step2(ctx, response)
+		challenge, err = m.step2(ctx, response)
+		if err != nil {
+			challenge = []byte("e=" + ServerErrorOf(err))
+		}
 	default:
-		return nil, fmt.Errorf("unexpected response")
+		return nil, newError(ServerErrorOtherError, "unexpected response")
 	}
 
-	return nil, nil
+	if err != nil || m.Completed() {
+		m.Dispose()
+	}
+	return challenge, err
 }
 
 // Completed indicates if the authentication exchange is complete from
@@ -83,107 +172,230 @@ func (m *ServerMech) Completed() bool {
 	return m.step >= 2
 }
 
-func (m *ServerMech) step1(ctx context.Context, response []byte) ([]byte, error) {
-	fields := bytes.Split(response, []byte{','})
+// Dispose drops the user's keys, wiping them when they were made up for an
+// unknown user. Keys returned by the StoredUserProvider belong to it and are
+// not wiped.
+func (m *ServerMech) Dispose() {
+	if m.unknown && m.storedUser != nil {
+		clear(m.storedUser.StoredKey)
+		clear(m.storedUser.ServerKey)
+	}
+	m.storedUser = nil
+}
 
-	if len(fields[0]) != 1 {
-		return nil, fmt.Errorf("invalid initial response")
+// Result returns the result of the completed exchange. Extensions sent by
+// the client are available as attributes.
+func (m *ServerMech) Result() *sasl.Result {
+	r := &sasl.Result{
+		Mechanism:        m.hash.MechName(false),
+		AuthenticationID: m.Username,
+		AuthorizationID:  m.Authz,
+		Attributes:       m.Extensions,
+	}
+	if r.AuthorizationID == "" {
+		r.AuthorizationID = m.Username
 	}
+	if strings.HasPrefix(m.gs2header, "p=") {
+		r.Mechanism = m.hash.MechName(true)
+		r.ChannelBinding = m.cbType
+	}
+	return r
+}
+
+// serverState is the exported state of an exchange awaiting the
+// client-final message.
+type serverState struct {
+	Step                   uint8
+	Authz                  string
+	Username               string
+	Extensions             map[string]string
+	GS2Header              string
+	Nonce                  string
+	ClientFirstMessageBare string
+	ServerFirstMessage     string
+}
 
-	if fields[0][0] != 'n' && fields[0][0] != 'y' {
-		return nil, fmt.Errorf("invalid initial response: expected p, n, or y")
+// MarshalState returns the state of an exchange awaiting the client-final
+// message. The user's keys are not included; they are requested again from
+// the StoredUserProvider when the exchange resumes.
+func (m *ServerMech) MarshalState() ([]byte, error) {
+	if m.step != 1 {
+		return nil, fmt.Errorf("state can only be exported while awaiting the client-final message")
 	}
 
-	if bytes.HasPrefix(fields[1], []byte("a=")) {
-		m.Authz = string(fields[1][2:])
+	return json.Marshal(&serverState{
+		Step:                   m.step,
+		Authz:                  m.Authz,
+		Username:               m.Username,
+		Extensions:             m.Extensions,
+		GS2Header:              m.gs2header,
+		Nonce:                  m.nonce,
+		ClientFirstMessageBare: m.clientFirstMessageBare,
+		ServerFirstMessage:     m.serverFirstMessage,
+	})
+}
+
+// UnmarshalState restores state returned by MarshalState into a newly
+// created ServerMech.
+func (m *ServerMech) UnmarshalState(b []byte) error {
+	var state serverState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("invalid state: %v", err)
+	}
+	if state.Step != 1 {
+		return fmt.Errorf("invalid state: unexpected step %d", state.Step)
 	}
 
-	if !bytes.HasPrefix(fields[2], []byte("n=")) {
-		return nil, fmt.Errorf("invalid initial response: expected username")
+	m.step = state.Step
+	m.Authz = state.Authz
+	m.Username = state.Username
+	m.Extensions = state.Extensions
+	m.gs2header = state.GS2Header
+	m.nonce = state.Nonce
+	m.clientFirstMessageBare = state.ClientFirstMessageBare
+	m.serverFirstMessage = state.ServerFirstMessage
+	m.storedUser = nil
+	return nil
+}
+
+func (m *ServerMech) step1(ctx context.Context, response []byte) ([]byte, error) {
+	msg, err := ParseClientFirstMessage(response)
+	if err != nil {
+		return nil, err
 	}
-	m.Username = string(fields[2][2:])
 
-	if !bytes.HasPrefix(fields[3], []byte("r=")) {
-		return nil, fmt.Errorf("invalid initial response: expected nonce")
+	switch {
+	case msg.CBFlag == "p" && m.cbType == "":
+		return nil, newError(ServerErrorChannelBindingNotSupported, "invalid initial response: channel binding is not supported")
+	case msg.CBFlag == "p" && msg.CBName != m.cbType:
+		return nil, newError(ServerErrorUnsupportedChannelBindingType, "invalid initial response: unsupported channel binding type")
+	case msg.CBFlag == "y" && (m.cbType != "" || m.cbSupported):
+		return nil, newError(ServerErrorServerDoesSupportChannelBinding, "invalid initial response: server does support channel binding")
+	case msg.CBFlag == "n" && m.cbType != "":
+		return nil, newError(ServerErrorChannelBindingsDontMatch, "invalid initial response: channel binding is required")
 	}
-	clientNonce := fields[3][2:]
 
-	m.clientFirstMessageBare = string(fields[2]) + "," + string(fields[3])
+	m.gs2header = msg.GS2Header()
+	m.Authz = msg.Authz
+	m.Username = msg.Username
+	m.Extensions = make(map[string]string)
+	for _, e := range msg.Extensions {
+		m.Extensions[e.Name] = e.Value
+	}
+	m.clientFirstMessageBare = msg.Bare()
 
 	serverNonce, err := generateNonce(m.nonceLen, m.nonceSource)
 	if err != nil {
-		return nil, fmt.Errorf("unable to generate nonce of length %d: %v", m.nonceLen, err)
+		return nil, newError(ServerErrorNoResources, "unable to generate nonce of length %d: %v", m.nonceLen, err)
 	}
 
-	m.storedUser, err = m.storedUserProvider(ctx, m.Username)
-	if err != nil {
-		return nil, fmt.Errorf("could not get salt and iteration count for user '%s'", m.Username)
+	if err = m.lookupStoredUser(ctx); err != nil {
+		return nil, err
 	}
 
-	m.nonce = "r=" + string(clientNonce) + string(serverNonce)
-	salt := "s=" + base64.StdEncoding.EncodeToString(m.storedUser.Salt)
-	iterationCount := "i=" + strconv.Itoa(int(m.storedUser.Iterations))
-
-	m.serverFirstMessage = m.nonce + "," + salt + "," + iterationCount
+	serverFirst := &ServerFirstMessage{
+		Nonce:      msg.Nonce + string(serverNonce),
+		Salt:       m.storedUser.Salt,
+		Iterations: int(m.storedUser.Iterations),
+	}
+	m.nonce = "r=" + serverFirst.Nonce
+	m.serverFirstMessage = serverFirst.String()
 
 	return []byte(m.serverFirstMessage), nil
 }
 
 func (m *ServerMech) step2(ctx context.Context, response []byte) ([]byte, error) {
-	fields := bytes.Split(response, []byte{','})
-	e := []byte("e=other-error")
-	if len(fields) < 3 {
-		return e, fmt.Errorf("invalid response")
-	}
-
-	if !bytes.HasPrefix(fields[0], []byte("c=")) {
-		return e, fmt.Errorf("invalid response: expected channel bindings")
+	msg, err := ParseClientFinalMessage(response)
+	if err != nil {
+		return nil, err
 	}
-	// TODO: does this need to be validated?
-	channelBinding := string(fields[0])
 
-	if !bytes.HasPrefix(fields[1], []byte("r=")) {
-		return e, fmt.Errorf("invalid response: expected nonce")
+	cbInput := []byte(m.gs2header)
+	if m.cbType != "" {
+		cbInput = append(cbInput, m.cbData...)
 	}
-	nonce := string(fields[1])
-	if m.nonce != nonce {
-		return e, fmt.Errorf("invalid response: nonce mismatch")
+	if !bytes.Equal(msg.ChannelBinding, cbInput) {
+		return nil, newError(ServerErrorChannelBindingsDontMatch, "invalid response: channel bindings don't match")
 	}
 
-	idx := 2
-	for idx < len(fields) && !bytes.HasPrefix(fields[idx], []byte("p=")) {
-		// ignore extensions
-		idx++
+	if "r="+msg.Nonce != m.nonce {
+		return nil, newError(ServerErrorOtherError, "invalid response: nonce mismatch")
 	}
 
-	if idx >= len(fields) {
-		return e, fmt.Errorf("invalid response: expected proof")
+	if m.storedUser == nil {
+		// the exchange was resumed from exported state.
+		if err = m.lookupStoredUser(ctx); err != nil {
+			return nil, err
+		}
 	}
 
-	p := make([]byte, base64.StdEncoding.DecodedLen(len(fields[idx][2:])))
-	n, err := base64.StdEncoding.Decode(p, fields[idx][2:])
-	if err != nil {
-		return e, fmt.Errorf("invalid response: invalid proof")
+	authMessage := m.clientFirstMessageBare + "," + m.serverFirstMessage + "," + msg.WithoutProof()
+	clientSignature := m.hash.hmac(m.storedUser.StoredKey, authMessage)
+	if len(msg.Proof) != len(clientSignature) {
+		return nil, newError(ServerErrorInvalidProof, "invalid response: invalid proof")
 	}
-	p = p[:n]
-
-	clientFinalMessageWithoutProof := channelBinding + "," + m.nonce
-	authMessage := m.clientFirstMessageBare + "," + m.serverFirstMessage + "," + clientFinalMessageWithoutProof
-	clientSignature := hmac(m.storedUser.StoredKey, authMessage)
-	clientKey := xor(p, clientSignature)
-	storedKey := h(clientKey)
-
-	if !bytes.Equal(storedKey, m.storedUser.StoredKey) {
-		return e, fmt.Errorf("invalid response: client key mismatch")
+	clientKey := xor(msg.Proof, clientSignature)
+	storedKey := m.hash.sum(clientKey)
+	match := hmaclib.Equal(storedKey, m.storedUser.StoredKey)
+	clear(clientSignature)
+	clear(clientKey)
+	clear(storedKey)
+
+	if !match || m.unknown {
+		return nil, newError(ServerErrorInvalidProof, "invalid response: client key mismatch")
 	}
 
 	if m.verifier != nil {
 		if err = m.verifier(ctx, m.Username, m.Authz); err != nil {
-			return e, fmt.Errorf("%s is not authorized to act as %s", m.Username, m.Authz)
+			return nil, newError(ServerErrorOtherError, "%s is not authorized to act as %s", m.Username, m.Authz)
 		}
 	}
 
-	serverSignature := hmac(m.storedUser.ServerKey, authMessage)
-	v := "v=" + base64.StdEncoding.EncodeToString(serverSignature)
-	return []byte(v), nil
+	serverFinal := &ServerFinalMessage{Verifier: m.hash.hmac(m.storedUser.ServerKey, authMessage)}
+	return []byte(serverFinal.String()), nil
+}
+
+// lookupStoredUser fetches the user's keys, substituting fake ones for
+// unknown users when they are to be hidden, or otherwise reporting them as
+// unknown-user. Other failures of the StoredUserProvider are reported as
+// other-error.
+func (m *ServerMech) lookupStoredUser(ctx context.Context) error {
+	storedUser, err := m.storedUserProvider(context.WithValue(ctx, extensionsKey{}, m.Extensions), m.Username)
+	switch {
+	case err == nil:
+	case !errors.Is(err, ErrUnknownUser):
+		return newError(ServerErrorOtherError, "could not get salt and iteration count for user '%s'", m.Username)
+	case m.unknownUserSecret == nil:
+		return newError(ServerErrorUnknownUser, "could not get salt and iteration count for user '%s'", m.Username)
+	default:
+		storedUser = m.fakeStoredUser()
+		m.unknown = true
+	}
+	m.storedUser = storedUser
+	return nil
+}
+
+// fakeStoredUser derives keys for an unknown user from the username and the
+// secret, so that repeated attempts see the same salt and iteration count.
+func (m *ServerMech) fakeStoredUser() *StoredUser {
+	saltLen, iterations := m.unknownUserSaltLen, m.unknownUserIter
+	if saltLen == 0 {
+		saltLen = defaultUnknownUserSaltLen
+	}
+	if iterations == 0 {
+		iterations = defaultUnknownUserIterations
+	}
+
+	var salt []byte
+	for i := 0; len(salt) < saltLen; i++ {
+		salt = append(salt, m.hash.hmac(m.unknownUserSecret, fmt.Sprintf("salt:%d:%s", i, m.Username))...)
+	}
+
+	key := m.hash.hmac(m.unknownUserSecret, "key:"+m.Username)
+	return &StoredUser{
+		Salt:       salt[:saltLen],
+		Iterations: iterations,
+		StoredKey:  m.hash.sum(key),
+		ServerKey:  key,
+	}
 }
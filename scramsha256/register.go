@@ -0,0 +1,11 @@
+package scramsha256
+
+import (
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+func init() {
+	// preferred to the SCRAM-SHA-1 mechanisms of the same kind.
+	scramsha1.Register(scramsha1.SHA256, sasl.MechStrengthChallengeResponse+1, sasl.MechStrengthChannelBinding+1)
+}
@@ -0,0 +1,44 @@
+// Package scramsha256 implements the client and server portions of
+// RFC7677 (https://tools.ietf.org/html/rfc7677). The mechanisms are those of
+// the scramsha1 package using SHA-256; sasl.NewServerWithDefaults enables
+// them when configured with a scramsha1.ServerConfig whose Hash is
+// scramsha1.SHA256.
+package scramsha256
+
+import (
+	"io"
+
+	"github.com/craiggwilson/go-sasl/scramsha1"
+)
+
+// MechName is the name of the mechanism.
+const MechName = "SCRAM-SHA-256"
+
+// MechNamePlus is the name of the channel binding variant of the mechanism.
+const MechNamePlus = "SCRAM-SHA-256-PLUS"
+
+// NewClientMech creates a new ClientMech.
+func NewClientMech(authz, username, password string, nonceLen uint16, nonceSource io.Reader) *scramsha1.ClientMech {
+	mech := scramsha1.NewClientMech(authz, username, password, nonceLen, nonceSource)
+	mech.SetHash(scramsha1.SHA256)
+	return mech
+}
+
+// NewServerMech creates a new ServerMech. The StoredUserProvider must return
+// keys generated by GenerateKeys.
+func NewServerMech(storedUserProvider scramsha1.StoredUserProvider, verifier scramsha1.AuthzVerifier, nonceLen uint16, nonceSource io.Reader) *scramsha1.ServerMech {
+	mech := scramsha1.NewServerMech(storedUserProvider, verifier, nonceLen, nonceSource)
+	mech.SetHash(scramsha1.SHA256)
+	return mech
+}
+
+// GenerateKeys generates all the keys needed for the mechanism.
+func GenerateKeys(password string, salt []byte, iterations uint16) (clientKey []byte, storedKey []byte, serverKey []byte) {
+	return scramsha1.SHA256.GenerateKeys(password, salt, int(iterations))
+}
+
+// SaltPassword returns the salted password, Hi(password, salt, i), from which
+// the keys are derived.
+func SaltPassword(password string, salt []byte, iterations uint16) []byte {
+	return scramsha1.SHA256.SaltPassword(password, salt, int(iterations))
+}
@@ -0,0 +1,99 @@
+package scramsha256_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+	"github.com/craiggwilson/go-sasl/scramsha256"
+)
+
+// The example exchange of RFC7677 section 3.
+const (
+	rfcClientNonce = "rOprNGfwEbeRWgbNEkqO"
+	rfcServerNonce = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	rfcSalt        = "W22ZaJ0SNY7soEsUEjb6gQ=="
+	rfcClientFirst = "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"
+	rfcServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfcClientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfcServerFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+func TestScramSha256MechRFC7677(t *testing.T) {
+	ctx := context.Background()
+
+	client := scramsha256.NewClientMech("", "user", "pencil", uint16(len(rfcClientNonce)), strings.NewReader(rfcClientNonce))
+	mechName, response, err := client.Start(ctx)
+	if err != nil {
+		t.Fatalf("client failed to start: %v", err)
+	}
+	if mechName != scramsha256.MechName || string(response) != rfcClientFirst {
+		t.Fatalf("expected %s client-first-message %q, but got %s %q", scramsha256.MechName, rfcClientFirst, mechName, response)
+	}
+
+	server := scramsha256.NewServerMech(rfcStoredUserProvider, nil, uint16(len(rfcServerNonce)), strings.NewReader(rfcServerNonce))
+	if _, challenge, err := server.Start(ctx, response); err != nil || string(challenge) != rfcServerFirst {
+		t.Fatalf("expected server-first-message %q, but got %q (%v)", rfcServerFirst, challenge, err)
+	}
+
+	if response, err = client.Next(ctx, []byte(rfcServerFirst)); err != nil || string(response) != rfcClientFinal {
+		t.Fatalf("expected client-final-message %q, but got %q (%v)", rfcClientFinal, response, err)
+	}
+	if challenge, err := server.Next(ctx, response); err != nil || string(challenge) != rfcServerFinal {
+		t.Fatalf("expected server-final-message %q, but got %q (%v)", rfcServerFinal, challenge, err)
+	}
+	if _, err = client.Next(ctx, []byte(rfcServerFinal)); err != nil {
+		t.Fatalf("client failed to verify server: %v", err)
+	}
+
+	if !client.Completed() || !server.Completed() {
+		t.Fatalf("expected the exchange to be completed")
+	}
+	if result := server.Result(); result.Mechanism != scramsha256.MechName || result.AuthenticationID != "user" {
+		t.Fatalf("expected user to be authenticated by %s, but got %+v", scramsha256.MechName, result)
+	}
+}
+
+func TestScramSha256Mech(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *scramsha1.ClientMech
+		clientErr string
+		serverErr string
+	}{
+		{"scram-sha-256", scramsha256.NewClientMech("", "user", "pencil", 16, rand.New(rand.NewSource(1))), "", ""},
+		{"wrong", scramsha256.NewClientMech("", "user", "wrong", 16, rand.New(rand.NewSource(1))),
+			"sasl mechanism SCRAM-SHA-256: client failed to provide response: invalid-proof",
+			"sasl mechanism SCRAM-SHA-256: server failed to provide challenge: invalid response: client key mismatch"},
+		{"scram-sha-1-client", scramsha1.NewClientMech("", "user", "pencil", 16, rand.New(rand.NewSource(1))),
+			"sasl mechanism SCRAM-SHA-1: client failed to provide response: invalid-proof",
+			"sasl mechanism SCRAM-SHA-256: server failed to provide challenge: invalid response: invalid proof"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testhelpers.RunClientServerTest(t,
+				test.client,
+				scramsha256.NewServerMech(rfcStoredUserProvider, nil, 16, rand.New(rand.NewSource(2))),
+				test.clientErr,
+				test.serverErr,
+			)
+		})
+	}
+}
+
+// rfcStoredUserProvider returns the keys of the RFC7677 example for the
+// password "pencil" whatever the username.
+func rfcStoredUserProvider(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+	salt, err := base64.StdEncoding.DecodeString(rfcSalt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	_, storedKey, serverKey := scramsha256.GenerateKeys("pencil", salt, 4096)
+	return &scramsha1.StoredUser{Salt: salt, Iterations: 4096, StoredKey: storedKey, ServerKey: serverKey}, nil
+}
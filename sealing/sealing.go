@@ -0,0 +1,162 @@
+// Package sealing protects data handed to an untrusted party, such as the
+// state of a sasl.StatefulServerMech carried by a client between requests,
+// by encrypting and authenticating it with AES-GCM and bounding its lifetime.
+package sealing
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const version byte = 1
+
+var (
+	// ErrExpired is returned by Open when the sealed data has expired.
+	ErrExpired = errors.New("sealing: sealed data has expired")
+	// ErrInvalid is returned by Open when the sealed data is malformed or
+	// fails authentication.
+	ErrInvalid = errors.New("sealing: sealed data is invalid")
+)
+
+// KeyProvider supplies the AES keys used for sealing. Keys are 16, 24 or 32
+// bytes long and identified by an id recorded in the sealed data, so keys can
+// be rotated while previously sealed data remains readable.
+type KeyProvider interface {
+	// CurrentKey returns the key used to seal new data and its id.
+	CurrentKey() (string, []byte, error)
+
+	// Key returns the key with the given id.
+	Key(id string) ([]byte, error)
+}
+
+// NewKeyRing creates a KeyRing sealing with the key named current.
+func NewKeyRing(current string, keys map[string][]byte) *KeyRing {
+	return &KeyRing{
+		current: current,
+		keys:    keys,
+	}
+}
+
+// KeyRing is a KeyProvider backed by a fixed set of keys.
+type KeyRing struct {
+	current string
+	keys    map[string][]byte
+}
+
+// CurrentKey implements KeyProvider.
+func (r *KeyRing) CurrentKey() (string, []byte, error) {
+	key, err := r.Key(r.current)
+	return r.current, key, err
+}
+
+// Key implements KeyProvider.
+func (r *KeyRing) Key(id string) ([]byte, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("sealing: unknown key %q", id)
+	}
+	return key, nil
+}
+
+// NewSealer creates a Sealer whose sealed data expires after lifetime.
+func NewSealer(keys KeyProvider, lifetime time.Duration) *Sealer {
+	return &Sealer{
+		keys:     keys,
+		lifetime: lifetime,
+	}
+}
+
+// Sealer seals and opens data.
+type Sealer struct {
+	keys     KeyProvider
+	lifetime time.Duration
+}
+
+// Lifetime returns the time after which sealed data expires.
+func (s *Sealer) Lifetime() time.Duration {
+	return s.lifetime
+}
+
+// Seal encrypts plaintext and authenticates it together with additionalData,
+// which is not included in the result and must be passed to Open unchanged.
+func (s *Sealer) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	id, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("sealing: key id is too long")
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{version, byte(len(id))}, id...)
+	header = binary.BigEndian.AppendUint64(header, uint64(time.Now().Add(s.lifetime).Unix()))
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ad := append(append([]byte{}, header...), additionalData...)
+	sealed := append(header, nonce...)
+	return aead.Seal(sealed, nonce, plaintext, ad), nil
+}
+
+// Open authenticates and decrypts data returned by Seal.
+func (s *Sealer) Open(sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < 2 || sealed[0] != version {
+		return nil, ErrInvalid
+	}
+
+	idLen := int(sealed[1])
+	if len(sealed) < 2+idLen+8 {
+		return nil, ErrInvalid
+	}
+	id := string(sealed[2 : 2+idLen])
+	header := sealed[:2+idLen+8]
+	expires := time.Unix(int64(binary.BigEndian.Uint64(sealed[2+idLen:])), 0)
+
+	key, err := s.keys.Key(id)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := sealed[len(header):]
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrInvalid
+	}
+
+	ad := append(append([]byte{}, header...), additionalData...)
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], ad)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	// the expiry is only trusted once authenticated.
+	if time.Now().After(expires) {
+		return nil, ErrExpired
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("sealing: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,67 @@
+package sealing_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/craiggwilson/go-sasl/sealing"
+)
+
+func TestSealer(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 16)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	old := sealing.NewSealer(sealing.NewKeyRing("1", map[string][]byte{"1": oldKey}), time.Minute)
+	rotated := sealing.NewSealer(sealing.NewKeyRing("2", map[string][]byte{"1": oldKey, "2": newKey}), time.Minute)
+	expired := sealing.NewSealer(sealing.NewKeyRing("1", map[string][]byte{"1": oldKey}), -time.Minute)
+	unknown := sealing.NewSealer(sealing.NewKeyRing("2", map[string][]byte{"2": newKey}), time.Minute)
+
+	tamper := func(b []byte) []byte {
+		b = append([]byte{}, b...)
+		b[len(b)-1] ^= 1
+		return b
+	}
+
+	tests := []struct {
+		name   string
+		sealer *sealing.Sealer
+		opener *sealing.Sealer
+		modify func([]byte) []byte
+		ad     string
+		err    error
+	}{
+		{"roundtrip", old, old, nil, "SCRAM-SHA-1", nil},
+		{"rotated", old, rotated, nil, "SCRAM-SHA-1", nil},
+		{"tampered", old, old, tamper, "SCRAM-SHA-1", sealing.ErrInvalid},
+		{"truncated", old, old, func(b []byte) []byte { return b[:10] }, "SCRAM-SHA-1", sealing.ErrInvalid},
+		{"additional-data", old, old, nil, "PLAIN", sealing.ErrInvalid},
+		{"unknown-key", old, unknown, nil, "SCRAM-SHA-1", sealing.ErrInvalid},
+		{"expired", expired, expired, nil, "SCRAM-SHA-1", sealing.ErrExpired},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plaintext := []byte("state")
+			sealed, err := test.sealer.Seal(plaintext, []byte("SCRAM-SHA-1"))
+			if err != nil {
+				t.Fatalf("unable to seal: %v", err)
+			}
+			if bytes.Contains(sealed, plaintext) {
+				t.Fatalf("expected sealed data to be encrypted")
+			}
+
+			if test.modify != nil {
+				sealed = test.modify(sealed)
+			}
+
+			opened, err := test.opener.Open(sealed, []byte(test.ad))
+			if err != test.err {
+				t.Fatalf("expected error %v, but got %v", test.err, err)
+			}
+			if err == nil && !bytes.Equal(opened, plaintext) {
+				t.Fatalf("expected %q, but got %q", plaintext, opened)
+			}
+		})
+	}
+}
@@ -1,17 +1,28 @@
 package sasl
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sync"
+)
 
-// ServerMechFactory is used to create a server mechanism.
-type ServerMechFactory func(state interface{}) ServerMech
+// ServerMechFactory is used to create a server mechanism for a connection.
+type ServerMechFactory func(state *ConnState) ServerMech
 
-// Server aids in the encapsulation of all the supported mechanisms.
+// Server aids in the encapsulation of all the supported mechanisms. It is
+// safe for concurrent use, so mechanisms may be registered while
+// authentications are in progress.
 type Server struct {
+	mu        sync.RWMutex
 	factories map[string]ServerMechFactory
 }
 
-// RegisterMechFactory registers the mechanism factory by name.
+// RegisterMechFactory registers the mechanism factory by name, replacing any
+// factory already registered under it.
 func (s *Server) RegisterMechFactory(mechName string, factory ServerMechFactory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.factories == nil {
 		s.factories = make(map[string]ServerMechFactory)
 	}
@@ -19,14 +30,84 @@ func (s *Server) RegisterMechFactory(mechName string, factory ServerMechFactory)
 	s.factories[mechName] = factory
 }
 
-// Auth authenticates/authorizes a user with the named mechanism.
-func (s *Server) Auth(ctx context.Context, state interface{}, mechName string, response []byte, incoming <-chan []byte, outgoing chan<- []byte) error {
+// UnregisterMechFactory removes the named mechanism. Authentications already
+// in progress with it are unaffected.
+func (s *Server) UnregisterMechFactory(mechName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.factories, mechName)
+}
+
+// ReplaceMechFactories atomically replaces the registered mechanisms with
+// those of other, e.g. a Server built from reloaded configuration with
+// NewServerWithDefaults.
+func (s *Server) ReplaceMechFactories(other *Server) {
+	other.mu.RLock()
+	factories := make(map[string]ServerMechFactory, len(other.factories))
+	for name, factory := range other.factories {
+		factories[name] = factory
+	}
+	other.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.factories = factories
+}
+
+// Mechanisms returns the names of the registered mechanisms in order of
+// preference: strongest first by the MechStrength they were registered with
+// by RegisterServerMech, then by name. Mechanisms missing from that registry come
+// last. The order does not depend on the order of registration.
+func (s *Server) Mechanisms() []string {
+	s.mu.RLock()
+	mechNames := make([]string, 0, len(s.factories))
+	for mechName := range s.factories {
+		mechNames = append(mechNames, mechName)
+	}
+	s.mu.RUnlock()
+
+	sortMechNames(mechNames, lookupServerMech)
+	return mechNames
+}
+
+// MechanismsFor returns the names of the registered mechanisms usable over a
+// connection in order of preference, leaving out those flagged
+// MechChannelBinding when the connection has no channel binding.
+func (s *Server) MechanismsFor(state *ConnState) []string {
+	mechNames := s.Mechanisms()
+	if state.HasChannelBinding() {
+		return mechNames
+	}
+
+	result := mechNames[:0]
+	for _, mechName := range mechNames {
+		if _, flags := lookupServerMech(mechName); flags&MechChannelBinding == 0 {
+			result = append(result, mechName)
+		}
+	}
+	return result
+}
+
+// Auth authenticates/authorizes a user with the named mechanism and returns
+// the result describing who authenticated. The state of the connection,
+// which may be nil, is passed to the mechanism's factory.
+func (s *Server) Auth(ctx context.Context, state *ConnState, mechName string, response []byte, incoming <-chan []byte, outgoing chan<- []byte) (*Result, error) {
+	s.mu.RLock()
 	factory, ok := s.factories[mechName]
+	s.mu.RUnlock()
 	if !ok {
-		return newError("sasl mechanism '%' has not been registered", nil)
+		return nil, newError(fmt.Sprintf("sasl mechanism '%s' has not been registered", mechName), nil)
+	}
+	if _, flags := lookupServerMech(mechName); flags&MechChannelBinding != 0 && !state.HasChannelBinding() {
+		return nil, newError(fmt.Sprintf("sasl mechanism '%s' requires channel binding", mechName), nil)
 	}
 
 	mech := factory(state)
+	defer Dispose(mech)
 
-	return ConverseAsServer(ctx, mech, response, incoming, outgoing)
+	if err := ConverseAsServer(ctx, mech, response, incoming, outgoing); err != nil {
+		return nil, err
+	}
+	return ResultOf(mech, mechName), nil
 }
@@ -0,0 +1,60 @@
+package smtp
+
+import (
+	"context"
+	"fmt"
+	netsmtp "net/smtp"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// NewAuth adapts mech to the net/smtp Auth interface so that any mechanism may
+// be used with net/smtp.Client. Unlike net/smtp.PlainAuth, the returned Auth
+// does not check whether the connection is encrypted.
+func NewAuth(ctx context.Context, mech sasl.ClientMech) netsmtp.Auth {
+	return &auth{
+		ctx:  ctx,
+		mech: mech,
+	}
+}
+
+type auth struct {
+	ctx  context.Context
+	mech sasl.ClientMech
+
+	// state
+	pending []byte
+}
+
+func (a *auth) Start(_ *netsmtp.ServerInfo) (string, []byte, error) {
+	mechName, response, err := a.mech.Start(a.ctx)
+	if err == nil && len(response) == 0 {
+		// net/smtp omits an empty initial response, so it must be sent in
+		// reply to the first challenge.
+		a.pending = []byte{}
+	}
+	return mechName, response, err
+}
+
+func (a *auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		if !a.mech.Completed() {
+			return nil, fmt.Errorf("smtp: server completed the exchange before the client")
+		}
+		return nil, nil
+	}
+
+	if a.pending != nil {
+		response := a.pending
+		a.pending = nil
+		return response, nil
+	}
+
+	response, err := a.mech.Next(a.ctx, fromServer)
+	if err == nil && response == nil {
+		// net/smtp stops the exchange on a nil response, but the server
+		// expects an empty line acknowledging its additional data.
+		response = []byte{}
+	}
+	return response, err
+}
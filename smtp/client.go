@@ -0,0 +1,78 @@
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Authenticate conducts an AUTH command as a client. The initial response is
+// sent along with the command unless doing so would exceed MaxLineLength, in
+// which case it is sent in reply to the server's first empty challenge.
+func Authenticate(ctx context.Context, rw *bufio.ReadWriter, mech sasl.ClientMech) error {
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("smtp: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	cmd := "AUTH " + mechName
+	pending := true
+	if ir := encodeInitialResponse(response); len(cmd)+len(ir)+3 <= MaxLineLength {
+		cmd += " " + ir
+		pending = false
+	}
+	if err = writeLine(rw.Writer, cmd); err != nil {
+		return err
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		code, text, err := readReply(rw.Reader)
+		if err != nil {
+			return err
+		}
+
+		switch code {
+		case 334:
+			if pending {
+				pending = false
+			} else {
+				challenge, err := base64.StdEncoding.DecodeString(text)
+				if err != nil {
+					return cancel(rw, fmt.Errorf("smtp: invalid challenge encoding: %v", err))
+				}
+
+				response, err = mech.Next(ctx, challenge)
+				if err != nil {
+					return cancel(rw, fmt.Errorf("smtp: sasl mechanism %s: client failed to provide response: %v", mechName, err))
+				}
+			}
+
+			if err = writeLine(rw.Writer, base64.StdEncoding.EncodeToString(response)); err != nil {
+				return err
+			}
+		case 235:
+			if !mech.Completed() {
+				return fmt.Errorf("smtp: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return nil
+		default:
+			return &StatusError{Code: code, Text: text}
+		}
+	}
+}
+
+// cancel aborts the exchange and waits for the server's reply before
+// returning err.
+func cancel(rw *bufio.ReadWriter, err error) error {
+	if werr := writeLine(rw.Writer, "*"); werr == nil {
+		readReply(rw.Reader)
+	}
+	return err
+}
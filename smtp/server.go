@@ -0,0 +1,89 @@
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Serve conducts the remainder of an AUTH command as a server. The caller's
+// command loop has already read the command line, typically with ParseAuth,
+// and passes the raw initial response argument, which is empty when the client
+// did not send one. Serve writes the final reply in every case.
+func Serve(ctx context.Context, rw *bufio.ReadWriter, mech sasl.ServerMech, initialResponse string) error {
+	var response []byte
+	if initialResponse != "" {
+		var err error
+		response, err = decodeInitialResponse(initialResponse)
+		if err != nil {
+			writeLine(rw.Writer, "501 5.5.2 Cannot decode initial response")
+			return fmt.Errorf("smtp: invalid initial response encoding: %v", err)
+		}
+	}
+
+	mechName, challenge, err := mech.Start(ctx, response)
+	for {
+		if err != nil {
+			writeLine(rw.Writer, failureReply(err))
+			return fmt.Errorf("smtp: sasl mechanism %s: %v", mechName, err)
+		}
+
+		if mech.Completed() && len(challenge) == 0 {
+			break
+		}
+
+		if err = writeLine(rw.Writer, "334 "+base64.StdEncoding.EncodeToString(challenge)); err != nil {
+			return err
+		}
+
+		var line string
+		if line, err = readLine(rw.Reader); err != nil {
+			if err == errLineTooLong {
+				writeLine(rw.Writer, "500 5.5.6 Authentication Exchange line is too long")
+			}
+			return err
+		}
+
+		if line == "*" {
+			writeLine(rw.Writer, "501 5.0.0 Authentication canceled")
+			return ErrCanceled
+		}
+
+		response, err = base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			writeLine(rw.Writer, "501 5.5.2 Cannot decode response")
+			return fmt.Errorf("smtp: invalid response encoding: %v", err)
+		}
+
+		if mech.Completed() {
+			// the final challenge carried additional data; the client
+			// acknowledges it with an empty response.
+			if len(response) != 0 {
+				writeLine(rw.Writer, "501 5.5.2 Unexpected response")
+				return fmt.Errorf("smtp: unexpected response after exchange completed")
+			}
+			break
+		}
+
+		challenge, err = mech.Next(ctx, response)
+	}
+
+	return writeLine(rw.Writer, "235 2.7.0 Authentication successful")
+}
+
+func failureReply(err error) string {
+	if errors.Is(err, ErrEncryptionRequired) {
+		return "538 5.7.11 Encryption required for requested authentication mechanism"
+	}
+
+	var temp interface{ Temporary() bool }
+	if errors.As(err, &temp) && temp.Temporary() {
+		return "454 4.7.0 Temporary authentication failure"
+	}
+
+	return "535 5.7.8 Authentication credentials invalid"
+}
@@ -0,0 +1,137 @@
+// Package smtp runs SASL mechanisms over the SMTP AUTH command as defined by
+// RFC4954 (https://tools.ietf.org/html/rfc4954).
+package smtp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxLineLength is the maximum length, including the trailing CRLF, of any
+// line sent during the authentication exchange.
+const MaxLineLength = 12288
+
+// ErrCanceled is returned by Serve when the client cancels the exchange.
+var ErrCanceled = errors.New("smtp: authentication canceled by client")
+
+// ErrEncryptionRequired may be returned, or wrapped, by a server mechanism to
+// report that the mechanism may only be used over an encrypted connection.
+var ErrEncryptionRequired = errors.New("smtp: encryption required for requested authentication mechanism")
+
+var errLineTooLong = errors.New("smtp: authentication exchange line is too long")
+
+// StatusError is returned by Authenticate when the server rejects the
+// exchange.
+type StatusError struct {
+	Code int
+	Text string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("smtp: server responded %d %s", e.Code, e.Text)
+}
+
+// Temporary indicates if the failure is transient and the exchange may be
+// retried later.
+func (e *StatusError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// ParseAuth splits an AUTH command line into the mechanism name and the
+// optional initial response argument.
+func ParseAuth(line string) (mechName, initialResponse string, ok bool) {
+	fields := strings.Fields(strings.TrimRight(line, "\r\n"))
+	if len(fields) < 2 || len(fields) > 3 || !strings.EqualFold(fields[0], "AUTH") {
+		return "", "", false
+	}
+
+	mechName = strings.ToUpper(fields[1])
+	if len(fields) == 3 {
+		initialResponse = fields[2]
+	}
+	return mechName, initialResponse, true
+}
+
+func encodeInitialResponse(b []byte) string {
+	if len(b) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeInitialResponse(s string) ([]byte, error) {
+	if s == "=" {
+		return []byte{}, nil
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// readLine reads a single line, discarding the remainder of lines longer than
+// MaxLineLength.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			return "", err
+		}
+
+		if !tooLong {
+			if len(line)+len(chunk) > MaxLineLength {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		if err == nil {
+			break
+		}
+	}
+
+	if tooLong {
+		return "", errLineTooLong
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// readReply reads a possibly multiline reply and returns its code and text.
+func readReply(r *bufio.Reader) (int, string, error) {
+	var text []string
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return 0, "", err
+		}
+
+		if len(line) < 3 {
+			return 0, "", fmt.Errorf("smtp: invalid reply %q", line)
+		}
+
+		code, err := strconv.Atoi(line[:3])
+		if err != nil {
+			return 0, "", fmt.Errorf("smtp: invalid reply %q", line)
+		}
+
+		if len(line) > 4 {
+			text = append(text, line[4:])
+		}
+
+		if len(line) == 3 || line[3] == ' ' {
+			return code, strings.Join(text, "\n"), nil
+		}
+	}
+}
+
+func writeLine(w *bufio.Writer, line string) error {
+	if _, err := w.WriteString(line + "\r\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,194 @@
+package smtp_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	netsmtp "net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+	"github.com/craiggwilson/go-sasl/smtp"
+)
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "directory unavailable" }
+func (temporaryError) Temporary() bool { return true }
+
+func userPassVerifier(_ context.Context, username, password string) error {
+	switch {
+	case username == "tls":
+		return fmt.Errorf("refusing cleartext: %w", smtp.ErrEncryptionRequired)
+	case username == "busy":
+		return temporaryError{}
+	case username != "jack" || password != "mcjack":
+		return errors.New("invalid username or password")
+	}
+	return nil
+}
+
+func storedUserProvider(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+	_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+	return &scramsha1.StoredUser{
+		Salt:       []byte("blah"),
+		Iterations: 100,
+		StoredKey:  storedKey,
+		ServerKey:  serverKey,
+	}, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		name      string
+		client    sasl.ClientMech
+		server    sasl.ServerMech
+		clientErr string
+		serverErr string
+	}{
+		{"plain", plain.NewClientMech("", "jack", "mcjack"), plain.NewServerMech(userPassVerifier, nil), "", ""},
+		{"plain-wrong", plain.NewClientMech("", "jack", "wrong"), plain.NewServerMech(userPassVerifier, nil),
+			"smtp: server responded 535 5.7.8 Authentication credentials invalid",
+			"smtp: sasl mechanism PLAIN: invalid username or password"},
+		{"plain-encryption", plain.NewClientMech("", "tls", "mcjack"), plain.NewServerMech(userPassVerifier, nil),
+			"smtp: server responded 538 5.7.11 Encryption required for requested authentication mechanism",
+			"smtp: sasl mechanism PLAIN: refusing cleartext: smtp: encryption required for requested authentication mechanism"},
+		{"plain-temporary", plain.NewClientMech("", "busy", "mcjack"), plain.NewServerMech(userPassVerifier, nil),
+			"smtp: server responded 454 4.7.0 Temporary authentication failure",
+			"smtp: sasl mechanism PLAIN: directory unavailable"},
+		{"scram", scramsha1.NewClientMech("", "jack", "mcjack", 16, mr), scramsha1.NewServerMech(storedUserProvider, nil, 16, mr), "", ""},
+		{"scram-wrong", scramsha1.NewClientMech("", "jack", "wrong", 16, mr), scramsha1.NewServerMech(storedUserProvider, nil, 16, mr),
+			"smtp: server responded 535 5.7.8 Authentication credentials invalid",
+			"smtp: sasl mechanism SCRAM-SHA-1: invalid response: client key mismatch"},
+		{"canceled", &testhelpers.FailingClientMech{}, &testhelpers.ChallengingServerMech{},
+			"smtp: sasl mechanism FAIL: client failed to provide response: no credentials",
+			"smtp: authentication canceled by client"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				defer serverConn.Close()
+				serverErr <- serveAuth(serverConn, test.server)
+			}()
+
+			rw := bufio.NewReadWriter(bufio.NewReader(clientConn), bufio.NewWriter(clientConn))
+			clientErr := smtp.Authenticate(context.Background(), rw, test.client)
+
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, <-serverErr)
+		})
+	}
+}
+
+func TestServeLineTooLong(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		serverErr <- serveAuth(serverConn, plain.NewServerMech(userPassVerifier, nil))
+	}()
+
+	rw := bufio.NewReadWriter(bufio.NewReader(clientConn), bufio.NewWriter(clientConn))
+	rw.WriteString("AUTH PLAIN\r\n")
+	rw.Flush()
+	line, _ := rw.ReadString('\n')
+	if line != "334 \r\n" {
+		t.Fatalf("expected an empty challenge, but got %q", line)
+	}
+
+	rw.WriteString(strings.Repeat("A", smtp.MaxLineLength) + "\r\n")
+	rw.Flush()
+	line, _ = rw.ReadString('\n')
+	if !strings.HasPrefix(line, "500 5.5.6 ") {
+		t.Fatalf("expected a 500 5.5.6 reply, but got %q", line)
+	}
+
+	testhelpers.VerifyError(t, "server", "smtp: authentication exchange line is too long", <-serverErr)
+}
+
+func TestNewAuth(t *testing.T) {
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		name   string
+		client sasl.ClientMech
+		server sasl.ServerMech
+		code   int
+	}{
+		{"plain", plain.NewClientMech("", "jack", "mcjack"), plain.NewServerMech(userPassVerifier, nil), 0},
+		{"plain-wrong", plain.NewClientMech("", "jack", "wrong"), plain.NewServerMech(userPassVerifier, nil), 535},
+		{"scram", scramsha1.NewClientMech("", "jack", "mcjack", 16, mr), scramsha1.NewServerMech(storedUserProvider, nil, 16, mr), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+
+			go func() {
+				defer serverConn.Close()
+				rw := bufio.NewReadWriter(bufio.NewReader(serverConn), bufio.NewWriter(serverConn))
+				rw.WriteString("220 localhost ESMTP\r\n")
+				rw.Flush()
+				if line, _ := rw.ReadString('\n'); !strings.HasPrefix(line, "EHLO ") {
+					return
+				}
+				rw.WriteString("250-localhost\r\n250 AUTH PLAIN SCRAM-SHA-1\r\n")
+				rw.Flush()
+				serveAuth(serverConn, test.server)
+				rw.ReadString('\n')
+			}()
+
+			c, err := netsmtp.NewClient(clientConn, "localhost")
+			if err != nil {
+				t.Fatalf("unable to create client: %v", err)
+			}
+			err = c.Auth(smtp.NewAuth(context.Background(), test.client))
+			var protoErr *textproto.Error
+			switch {
+			case test.code == 0 && err != nil:
+				t.Fatalf("expected no client error, but got '%v'", err)
+			case test.code != 0 && (!errors.As(err, &protoErr) || protoErr.Code != test.code):
+				t.Fatalf("expected a %d client error, but got '%v'", test.code, err)
+			}
+		})
+	}
+}
+
+// serveAuth runs an in-memory SMTP server that only understands the AUTH
+// command.
+func serveAuth(conn net.Conn, mech sasl.ServerMech) error {
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	line, err := rw.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	_, ir, ok := smtp.ParseAuth(line)
+	if !ok {
+		return fmt.Errorf("unexpected command %q", strings.TrimSpace(line))
+	}
+
+	return smtp.Serve(context.Background(), rw, mech, ir)
+}
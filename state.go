@@ -0,0 +1,17 @@
+package sasl
+
+// StatefulServerMech is a ServerMech able to export the state of an exchange
+// in progress and resume it later, possibly in another process. The exported
+// state is not protected in any way; a client able to alter it can complete
+// the exchange without proving anything, so it must be sealed, e.g. with the
+// sealing package, whenever it leaves the server.
+type StatefulServerMech interface {
+	ServerMech
+
+	// MarshalState returns the state of the exchange.
+	MarshalState() ([]byte, error)
+
+	// UnmarshalState restores state returned by MarshalState into a newly
+	// created mechanism.
+	UnmarshalState([]byte) error
+}
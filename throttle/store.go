@@ -0,0 +1,98 @@
+package throttle
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Record holds the failures counted for a key.
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store records failures. Implementations backed by a shared database let
+// several servers throttle together.
+type Store interface {
+	// Get returns the record for key, or the zero Record if there is none.
+	Get(ctx context.Context, key string) (Record, error)
+
+	// Fail counts a failure for key at now and returns the updated record.
+	Fail(ctx context.Context, key string, now time.Time) (Record, error)
+
+	// Reset forgets the failures for key.
+	Reset(ctx context.Context, key string) error
+}
+
+// NewMemoryStore creates a Store holding the records of the size most
+// recently failing keys in memory.
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// MemoryStore is a Store evicting the least recently failing key when full.
+type MemoryStore struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key    string
+	record Record
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		return e.Value.(*lruEntry).record, nil
+	}
+	return Record{}, nil
+}
+
+// Fail implements Store.
+func (s *MemoryStore) Fail(_ context.Context, key string, now time.Time) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if ok {
+		s.order.MoveToFront(e)
+	} else {
+		e = s.order.PushFront(&lruEntry{key: key})
+		s.entries[key] = e
+		for s.order.Len() > s.size {
+			oldest := s.order.Back()
+			s.order.Remove(oldest)
+			delete(s.entries, oldest.Value.(*lruEntry).key)
+		}
+	}
+
+	entry := e.Value.(*lruEntry)
+	entry.record.Failures++
+	entry.record.LastFailure = now
+	return entry.record, nil
+}
+
+// Reset implements Store.
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.order.Remove(e)
+		delete(s.entries, key)
+	}
+	return nil
+}
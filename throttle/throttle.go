@@ -0,0 +1,195 @@
+// Package throttle slows down and locks out clients repeatedly failing to
+// authenticate. Failures are counted both by authentication identity and by
+// client address, in a Store that may be shared by several servers.
+package throttle
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ErrLockedOut is returned when the identity or address has failed too many
+// times and is locked out.
+var ErrLockedOut = errors.New("throttle: too many failed authentication attempts")
+
+// Policy configures a Throttler.
+type Policy struct {
+	// BaseDelay is the delay imposed after the first failure. It doubles with
+	// every further failure, up to MaxDelay, or without bound when MaxDelay
+	// is zero. No delay is imposed when BaseDelay is zero.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// LockoutThreshold is the number of failures after which attempts are
+	// rejected for LockoutDuration. Lockouts are disabled when zero.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+
+	// ResetAfter is the time after which failures are forgotten. They are
+	// only forgotten on success when zero.
+	ResetAfter time.Duration
+}
+
+// NewThrottler creates a Throttler recording failures in store.
+func NewThrottler(store Store, policy Policy) *Throttler {
+	return &Throttler{
+		store:  store,
+		policy: policy,
+	}
+}
+
+// Throttler applies a Policy to the mechanisms it wraps.
+type Throttler struct {
+	store  Store
+	policy Policy
+}
+
+// Wrap returns a ServerMech throttling mech for a client connecting from
+// source, typically the client's IP address. The identity is taken from the
+// mechanism's Result once available, so it is only counted for mechanisms
+// implementing sasl.ResultProvider.
+func (t *Throttler) Wrap(mech sasl.ServerMech, source string) sasl.ServerMech {
+	return &serverMech{
+		throttler: t,
+		mech:      mech,
+		sourceKey: "source:" + source,
+	}
+}
+
+// check waits out the delay imposed on key, or returns ErrLockedOut.
+func (t *Throttler) check(ctx context.Context, key string) error {
+	r, err := t.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if r.Failures == 0 {
+		return nil
+	}
+	if t.policy.ResetAfter > 0 && now.Sub(r.LastFailure) > t.policy.ResetAfter {
+		return t.store.Reset(ctx, key)
+	}
+
+	if t.policy.LockoutThreshold > 0 && r.Failures >= t.policy.LockoutThreshold && now.Before(r.LastFailure.Add(t.policy.LockoutDuration)) {
+		return ErrLockedOut
+	}
+
+	delay := t.delay(r.Failures)
+	wait := r.LastFailure.Add(delay).Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *Throttler) delay(failures int) time.Duration {
+	if t.policy.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := t.policy.BaseDelay
+	for i := 1; i < failures; i++ {
+		if delay > math.MaxInt64/2 {
+			// doubling would overflow, so the delay saturates.
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+		if t.policy.MaxDelay > 0 && delay >= t.policy.MaxDelay {
+			return t.policy.MaxDelay
+		}
+	}
+	if t.policy.MaxDelay > 0 && delay > t.policy.MaxDelay {
+		return t.policy.MaxDelay
+	}
+	return delay
+}
+
+type serverMech struct {
+	throttler *Throttler
+	mech      sasl.ServerMech
+	sourceKey string
+	userKey   string
+}
+
+// Start initializes the mechanism and begins the authentication exchange.
+func (m *serverMech) Start(ctx context.Context, response []byte) (string, []byte, error) {
+	if err := m.throttler.check(ctx, m.sourceKey); err != nil {
+		return "", nil, err
+	}
+
+	mechName, challenge, err := m.mech.Start(ctx, response)
+	if err = m.after(ctx, err); err != nil {
+		return mechName, nil, err
+	}
+	return mechName, challenge, nil
+}
+
+// Next continues the exchange.
+func (m *serverMech) Next(ctx context.Context, response []byte) ([]byte, error) {
+	challenge, err := m.mech.Next(ctx, response)
+	if err = m.after(ctx, err); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// Completed indicates if the authentication exchange is complete from
+// the server's perspective.
+func (m *serverMech) Completed() bool {
+	return m.mech.Completed()
+}
+
+// Result returns the result of the completed exchange.
+func (m *serverMech) Result() *sasl.Result {
+	return sasl.ResultOf(m.mech, "")
+}
+
+// after records the outcome of a step of the exchange.
+func (m *serverMech) after(ctx context.Context, err error) error {
+	if m.userKey == "" {
+		if id := sasl.ResultOf(m.mech, "").AuthenticationID; id != "" {
+			m.userKey = "user:" + id
+			if cerr := m.throttler.check(ctx, m.userKey); cerr != nil {
+				return cerr
+			}
+		}
+	}
+
+	keys := []string{m.sourceKey}
+	if m.userKey != "" {
+		keys = append(keys, m.userKey)
+	}
+
+	if err != nil {
+		now := time.Now()
+		for _, key := range keys {
+			if _, serr := m.throttler.store.Fail(ctx, key, now); serr != nil {
+				return serr
+			}
+		}
+		return err
+	}
+
+	if m.mech.Completed() {
+		for _, key := range keys {
+			if serr := m.throttler.store.Reset(ctx, key); serr != nil {
+				return serr
+			}
+		}
+	}
+	return nil
+}
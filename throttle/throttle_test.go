@@ -0,0 +1,183 @@
+package throttle_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/throttle"
+)
+
+func TestThrottler(t *testing.T) {
+	userPassVerifier := func(_ context.Context, username, password string) error {
+		if password != "mcjack" {
+			return errors.New("invalid username or password")
+		}
+		return nil
+	}
+
+	type attempt struct {
+		source   string
+		username string
+		password string
+		err      string
+	}
+
+	tests := []struct {
+		name     string
+		policy   throttle.Policy
+		attempts []attempt
+	}{
+		{
+			name:   "user lockout",
+			policy: throttle.Policy{LockoutThreshold: 2, LockoutDuration: time.Hour},
+			attempts: []attempt{
+				{"10.0.0.1", "jack", "wrong", "invalid username or password"},
+				{"10.0.0.2", "jack", "wrong", "invalid username or password"},
+				{"10.0.0.3", "jack", "mcjack", "throttle: too many failed authentication attempts"},
+				{"10.0.0.3", "jane", "mcjack", ""},
+			},
+		},
+		{
+			name:   "source lockout",
+			policy: throttle.Policy{LockoutThreshold: 2, LockoutDuration: time.Hour},
+			attempts: []attempt{
+				{"10.0.0.1", "jack", "wrong", "invalid username or password"},
+				{"10.0.0.1", "jane", "wrong", "invalid username or password"},
+				{"10.0.0.1", "joe", "mcjack", "throttle: too many failed authentication attempts"},
+				{"10.0.0.2", "joe", "mcjack", ""},
+			},
+		},
+		{
+			name:   "lockout expired",
+			policy: throttle.Policy{LockoutThreshold: 1, LockoutDuration: time.Nanosecond},
+			attempts: []attempt{
+				{"10.0.0.1", "jack", "wrong", "invalid username or password"},
+				{"10.0.0.1", "jack", "mcjack", ""},
+			},
+		},
+		{
+			name:   "success resets",
+			policy: throttle.Policy{LockoutThreshold: 2, LockoutDuration: time.Hour},
+			attempts: []attempt{
+				{"10.0.0.1", "jack", "wrong", "invalid username or password"},
+				{"10.0.0.1", "jack", "mcjack", ""},
+				{"10.0.0.1", "jack", "wrong", "invalid username or password"},
+				{"10.0.0.1", "jack", "mcjack", ""},
+			},
+		},
+		{
+			name:   "failures forgotten",
+			policy: throttle.Policy{LockoutThreshold: 2, LockoutDuration: time.Hour, ResetAfter: time.Nanosecond},
+			attempts: []attempt{
+				{"10.0.0.1", "jack", "wrong", "invalid username or password"},
+				{"10.0.0.1", "jack", "wrong", "invalid username or password"},
+				{"10.0.0.1", "jack", "mcjack", ""},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			throttler := throttle.NewThrottler(throttle.NewMemoryStore(100), test.policy)
+			for i, a := range test.attempts {
+				mech := throttler.Wrap(plain.NewServerMech(userPassVerifier, nil), a.source)
+				time.Sleep(time.Millisecond)
+				_, _, err := mech.Start(context.Background(), []byte("\x00"+a.username+"\x00"+a.password))
+				testhelpers.VerifyError(t, fmt.Sprintf("attempt %d", i+1), a.err, err)
+			}
+		})
+	}
+}
+
+func TestThrottlerDelay(t *testing.T) {
+	userPassVerifier := func(_ context.Context, _, _ string) error {
+		return errors.New("invalid username or password")
+	}
+
+	throttler := throttle.NewThrottler(throttle.NewMemoryStore(100), throttle.Policy{BaseDelay: 50 * time.Millisecond, MaxDelay: 80 * time.Millisecond})
+	attempt := func(ctx context.Context) (time.Duration, error) {
+		start := time.Now()
+		_, _, err := throttler.Wrap(plain.NewServerMech(userPassVerifier, nil), "10.0.0.1").Start(ctx, []byte("\x00jack\x00wrong"))
+		return time.Since(start), err
+	}
+
+	if elapsed, _ := attempt(context.Background()); elapsed >= 50*time.Millisecond {
+		t.Fatalf("expected no delay on the first attempt, but took %v", elapsed)
+	}
+	if elapsed, _ := attempt(context.Background()); elapsed < 40*time.Millisecond {
+		t.Fatalf("expected a delay after a failure, but took %v", elapsed)
+	}
+
+	// the third attempt would wait 100ms but for MaxDelay.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := attempt(ctx)
+	testhelpers.VerifyError(t, "delayed", "context deadline exceeded", err)
+
+	if elapsed, _ := attempt(context.Background()); elapsed > time.Second {
+		t.Fatalf("expected the delay to be capped, but took %v", elapsed)
+	}
+}
+
+func TestThrottlerUnboundedDelay(t *testing.T) {
+	userPassVerifier := func(_ context.Context, _, _ string) error {
+		return errors.New("invalid username or password")
+	}
+
+	// with enough failures, doubling the delay goes past the largest
+	// time.Duration.
+	store := failedStore{throttle.Record{Failures: 100, LastFailure: time.Now()}}
+	throttler := throttle.NewThrottler(store, throttle.Policy{BaseDelay: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := throttler.Wrap(plain.NewServerMech(userPassVerifier, nil), "10.0.0.1").Start(ctx, []byte("\x00jack\x00wrong"))
+	testhelpers.VerifyError(t, "delayed", "context deadline exceeded", err)
+}
+
+// failedStore is a Store holding the same record for every key.
+type failedStore struct {
+	record throttle.Record
+}
+
+func (s failedStore) Get(context.Context, string) (throttle.Record, error) {
+	return s.record, nil
+}
+
+func (s failedStore) Fail(context.Context, string, time.Time) (throttle.Record, error) {
+	return s.record, nil
+}
+
+func (s failedStore) Reset(context.Context, string) error {
+	return nil
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := throttle.NewMemoryStore(2)
+	now := time.Now()
+
+	store.Fail(ctx, "a", now)
+	store.Fail(ctx, "b", now)
+	if r, _ := store.Fail(ctx, "a", now); r.Failures != 2 {
+		t.Fatalf("expected 2 failures, but got %d", r.Failures)
+	}
+	store.Fail(ctx, "c", now)
+
+	if r, _ := store.Get(ctx, "b"); r.Failures != 0 {
+		t.Fatalf("expected the least recently failing key to be evicted")
+	}
+	if r, _ := store.Get(ctx, "a"); r.Failures != 2 || !r.LastFailure.Equal(now) {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	store.Reset(ctx, "a")
+	if r, _ := store.Get(ctx, "a"); r.Failures != 0 {
+		t.Fatalf("expected the record to be reset")
+	}
+}
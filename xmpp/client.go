@@ -0,0 +1,91 @@
+package xmpp
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Authenticate conducts a RFC6120 SASL negotiation as the initiating entity.
+func Authenticate(ctx context.Context, dec *xml.Decoder, w io.Writer, mech sasl.ClientMech) error {
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("xmpp: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	auth := &Auth{Mechanism: mechName, Data: encodeInitialResponse(response)}
+	if err = xml.NewEncoder(w).Encode(auth); err != nil {
+		return err
+	}
+
+	_, err = converse(ctx, dec, w, NSSASL, mech, mechName, func(e *element) string {
+		return e.Text
+	})
+	return err
+}
+
+// converse continues an exchange started by the client until the server
+// reports success or failure, returning the <success/> element.
+func converse(ctx context.Context, dec *xml.Decoder, w io.Writer, space string, mech sasl.ClientMech, mechName string, successData func(*element) string) (*element, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		e, err := readElement(dec)
+		if err != nil {
+			return nil, err
+		}
+		if e.XMLName.Space != space {
+			return nil, fmt.Errorf("xmpp: unexpected element {%s}%s", e.XMLName.Space, e.XMLName.Local)
+		}
+
+		switch e.XMLName.Local {
+		case "challenge":
+			challenge, err := decodeData(e.Text)
+			if err != nil {
+				return nil, abort(dec, w, space, err)
+			}
+
+			response, err := mech.Next(ctx, challenge)
+			if err != nil {
+				return nil, abort(dec, w, space, fmt.Errorf("xmpp: sasl mechanism %s: client failed to provide response: %v", mechName, err))
+			}
+
+			if err = writeData(w, space, "response", encodeData(response)); err != nil {
+				return nil, err
+			}
+		case "success":
+			data, err := decodeData(successData(e))
+			if err != nil {
+				return nil, err
+			}
+
+			if len(data) > 0 || !mech.Completed() {
+				if _, err = mech.Next(ctx, data); err != nil {
+					return nil, fmt.Errorf("xmpp: sasl mechanism %s: unable to verify server: %v", mechName, err)
+				}
+			}
+			if !mech.Completed() {
+				return nil, fmt.Errorf("xmpp: sasl mechanism %s: server completed the exchange before the client", mechName)
+			}
+			return e, nil
+		case "failure":
+			return nil, e.failure()
+		default:
+			return nil, fmt.Errorf("xmpp: unexpected element %s", e.XMLName.Local)
+		}
+	}
+}
+
+// abort cancels the exchange and waits for the server's failure before
+// returning err.
+func abort(dec *xml.Decoder, w io.Writer, space string, err error) error {
+	if _, werr := fmt.Fprintf(w, "<abort xmlns='%s'/>", space); werr == nil {
+		readElement(dec)
+	}
+	return err
+}
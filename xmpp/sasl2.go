@@ -0,0 +1,135 @@
+package xmpp
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// Auth2 is the <authenticate/> element that starts a SASL2 negotiation.
+type Auth2 struct {
+	XMLName         xml.Name      `xml:"urn:xmpp:sasl:2 authenticate"`
+	Mechanism       string        `xml:"mechanism,attr"`
+	InitialResponse string        `xml:"initial-response,omitempty"`
+	UserAgent       *UserAgent    `xml:"user-agent"`
+	RequestToken    *RequestToken `xml:"urn:xmpp:fast:0 request-token"`
+	FAST            *FAST         `xml:"urn:xmpp:fast:0 fast"`
+}
+
+// UserAgent identifies the client software and device.
+type UserAgent struct {
+	ID       string `xml:"id,attr,omitempty"`
+	Software string `xml:"software,omitempty"`
+	Device   string `xml:"device,omitempty"`
+}
+
+// RequestToken asks the server to issue a FAST token for the named mechanism.
+type RequestToken struct {
+	Mechanism string `xml:"mechanism,attr"`
+}
+
+// FAST marks an authentication that uses a previously issued FAST token.
+type FAST struct {
+	Count      int  `xml:"count,attr,omitempty"`
+	Invalidate bool `xml:"invalidate,attr,omitempty"`
+}
+
+// Token is a FAST token issued by the server.
+type Token struct {
+	Expiry time.Time `xml:"expiry,attr"`
+	Token  string    `xml:"token,attr"`
+}
+
+// Result holds the outcome of a successful SASL2 negotiation.
+type Result struct {
+	AuthorizationIdentifier string
+	Token                   *Token
+}
+
+type success2 struct {
+	XMLName                 xml.Name `xml:"urn:xmpp:sasl:2 success"`
+	AdditionalData          string   `xml:"additional-data,omitempty"`
+	AuthorizationIdentifier string   `xml:"authorization-identifier"`
+	Token                   *Token   `xml:"urn:xmpp:fast:0 token"`
+}
+
+// Authenticate2 conducts a SASL2 negotiation as the initiating entity. The
+// optional user agent and FAST elements of req are sent along with the
+// mechanism name and initial response.
+func Authenticate2(ctx context.Context, dec *xml.Decoder, w io.Writer, mech sasl.ClientMech, req Auth2) (*Result, error) {
+	mechName, response, err := mech.Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("xmpp: sasl mechanism %s: unable to start exchange: %v", mechName, err)
+	}
+
+	req.Mechanism = mechName
+	req.InitialResponse = encodeInitialResponse(response)
+	if err = xml.NewEncoder(w).Encode(&req); err != nil {
+		return nil, err
+	}
+
+	e, err := converse(ctx, dec, w, NSSASL2, mech, mechName, func(e *element) string {
+		if data := e.child(NSSASL2, "additional-data"); data != nil {
+			return data.Text
+		}
+		return ""
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	if authzid := e.child(NSSASL2, "authorization-identifier"); authzid != nil {
+		result.AuthorizationIdentifier = authzid.Text
+	}
+	if token := e.child(NSFAST, "token"); token != nil {
+		result.Token = &Token{Token: token.attr("token")}
+		if result.Token.Expiry, err = time.Parse(time.RFC3339, token.attr("expiry")); err != nil {
+			return nil, fmt.Errorf("xmpp: invalid token expiry: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// CompleteFunc produces the result of a successful SASL2 negotiation, such as
+// the authorization identifier of the authenticated entity and, when req
+// requests one, a new FAST token.
+type CompleteFunc func(ctx context.Context, mech sasl.ServerMech, req *Auth2) (*Result, error)
+
+// Serve2 conducts a SASL2 negotiation as the receiving entity. The caller's
+// stream handler has already decoded the <authenticate/> element. Inline
+// tasks are not supported.
+func Serve2(ctx context.Context, dec *xml.Decoder, w io.Writer, req *Auth2, provider ServerMechProvider, complete CompleteFunc) (sasl.ServerMech, error) {
+	mech := provider(req.Mechanism)
+	if mech == nil {
+		writeFailure(w, NSSASL2, &Failure{Condition: InvalidMechanism})
+		return nil, fmt.Errorf("xmpp: sasl mechanism %s is not supported", req.Mechanism)
+	}
+
+	challenge, err := serve(ctx, dec, w, NSSASL2, mech, req.InitialResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := complete(ctx, mech, req)
+	if err != nil {
+		writeFailure(w, NSSASL2, failureFor(err))
+		return nil, err
+	}
+
+	success := &success2{
+		AuthorizationIdentifier: result.AuthorizationIdentifier,
+		Token:                   result.Token,
+	}
+	if len(challenge) > 0 {
+		success.AdditionalData = encodeData(challenge)
+	}
+	if err = xml.NewEncoder(w).Encode(success); err != nil {
+		return nil, err
+	}
+	return mech, nil
+}
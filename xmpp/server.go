@@ -0,0 +1,90 @@
+package xmpp
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/craiggwilson/go-sasl"
+)
+
+// ErrAborted is returned by Serve and Serve2 when the client aborts the
+// exchange.
+var ErrAborted = errors.New("xmpp: authentication aborted by client")
+
+// ServerMechProvider returns a new server mechanism for the named mechanism,
+// or nil if the mechanism is not supported.
+type ServerMechProvider func(mechName string) sasl.ServerMech
+
+// Serve conducts a RFC6120 SASL negotiation as the receiving entity. The
+// caller's stream handler has already decoded the <auth/> element. The
+// completed mechanism is returned so the caller can inspect the authenticated
+// identity.
+func Serve(ctx context.Context, dec *xml.Decoder, w io.Writer, auth *Auth, provider ServerMechProvider) (sasl.ServerMech, error) {
+	mech := provider(auth.Mechanism)
+	if mech == nil {
+		writeFailure(w, NSSASL, &Failure{Condition: InvalidMechanism})
+		return nil, fmt.Errorf("xmpp: sasl mechanism %s is not supported", auth.Mechanism)
+	}
+
+	challenge, err := serve(ctx, dec, w, NSSASL, mech, auth.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = writeData(w, NSSASL, "success", encodeData(challenge)); err != nil {
+		return nil, err
+	}
+	return mech, nil
+}
+
+// serve runs mech until it completes, returning its final challenge. Failures
+// are reported to the client before returning an error.
+func serve(ctx context.Context, dec *xml.Decoder, w io.Writer, space string, mech sasl.ServerMech, initialResponse string) ([]byte, error) {
+	var response []byte
+	if initialResponse != "" {
+		var err error
+		if response, err = decodeData(initialResponse); err != nil {
+			writeFailure(w, space, &Failure{Condition: IncorrectEncoding})
+			return nil, err
+		}
+	}
+
+	mechName, challenge, err := mech.Start(ctx, response)
+	for {
+		if err != nil {
+			writeFailure(w, space, failureFor(err))
+			return nil, fmt.Errorf("xmpp: sasl mechanism %s: %v", mechName, err)
+		}
+
+		if mech.Completed() {
+			return challenge, nil
+		}
+
+		if err = writeData(w, space, "challenge", encodeData(challenge)); err != nil {
+			return nil, err
+		}
+
+		var e *element
+		if e, err = readElement(dec); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case e.XMLName.Space == space && e.XMLName.Local == "response":
+			if response, err = decodeData(e.Text); err != nil {
+				writeFailure(w, space, &Failure{Condition: IncorrectEncoding})
+				return nil, err
+			}
+			challenge, err = mech.Next(ctx, response)
+		case e.XMLName.Space == space && e.XMLName.Local == "abort":
+			writeFailure(w, space, &Failure{Condition: Aborted})
+			return nil, ErrAborted
+		default:
+			writeFailure(w, space, &Failure{Condition: MalformedRequest})
+			return nil, fmt.Errorf("xmpp: unexpected element {%s}%s", e.XMLName.Space, e.XMLName.Local)
+		}
+	}
+}
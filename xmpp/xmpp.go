@@ -0,0 +1,183 @@
+// Package xmpp runs SASL mechanisms over XMPP streams using the SASL
+// negotiation of RFC6120 (https://tools.ietf.org/html/rfc6120#section-6) and
+// the SASL2 negotiation of XEP-0388 (https://xmpp.org/extensions/xep-0388.html),
+// including the FAST token extension of XEP-0484
+// (https://xmpp.org/extensions/xep-0484.html).
+package xmpp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Namespaces of the negotiation elements.
+const (
+	NSSASL  = "urn:ietf:params:xml:ns:xmpp-sasl"
+	NSSASL2 = "urn:xmpp:sasl:2"
+	NSFAST  = "urn:xmpp:fast:0"
+)
+
+// Condition is a defined SASL failure condition.
+type Condition string
+
+// Failure conditions defined by RFC6120.
+const (
+	Aborted              Condition = "aborted"
+	AccountDisabled      Condition = "account-disabled"
+	CredentialsExpired   Condition = "credentials-expired"
+	EncryptionRequired   Condition = "encryption-required"
+	IncorrectEncoding    Condition = "incorrect-encoding"
+	InvalidAuthzid       Condition = "invalid-authzid"
+	InvalidMechanism     Condition = "invalid-mechanism"
+	MalformedRequest     Condition = "malformed-request"
+	MechanismTooWeak     Condition = "mechanism-too-weak"
+	NotAuthorized        Condition = "not-authorized"
+	TemporaryAuthFailure Condition = "temporary-auth-failure"
+)
+
+// Failure is the error returned when the exchange ends with a <failure/>
+// element. Server mechanisms may return, or wrap, a *Failure to choose the
+// condition reported to the client; other errors are reported as
+// not-authorized.
+type Failure struct {
+	Condition Condition
+	Text      string
+}
+
+func (f *Failure) Error() string {
+	s := "xmpp: authentication failed: " + string(f.Condition)
+	if f.Text != "" {
+		s += ": " + f.Text
+	}
+	return s
+}
+
+// Auth is the <auth/> element that starts a RFC6120 negotiation.
+type Auth struct {
+	XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:xmpp-sasl auth"`
+	Mechanism string   `xml:"mechanism,attr"`
+	Data      string   `xml:",chardata"`
+}
+
+// element is a generic view of a received element.
+type element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []element  `xml:",any"`
+}
+
+func (e *element) child(space, local string) *element {
+	for i := range e.Children {
+		if e.Children[i].XMLName.Space == space && e.Children[i].XMLName.Local == local {
+			return &e.Children[i]
+		}
+	}
+	return nil
+}
+
+func (e *element) attr(local string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (e *element) failure() *Failure {
+	f := &Failure{Condition: NotAuthorized}
+	for _, c := range e.Children {
+		if c.XMLName.Local == "text" {
+			f.Text = c.Text
+		} else if c.XMLName.Space == NSSASL {
+			f.Condition = Condition(c.XMLName.Local)
+		}
+	}
+	return f
+}
+
+// readElement reads the next element of the stream, skipping character data
+// between elements.
+func readElement(dec *xml.Decoder) (*element, error) {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &element{}
+			if err = dec.DecodeElement(e, &t); err != nil {
+				return nil, err
+			}
+			return e, nil
+		case xml.EndElement:
+			return nil, io.ErrUnexpectedEOF
+		}
+	}
+}
+
+func encodeData(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func encodeInitialResponse(b []byte) string {
+	if b == nil {
+		return ""
+	}
+	if len(b) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+var errInvalidEncoding = errors.New("xmpp: invalid base64 data")
+
+func decodeData(s string) ([]byte, error) {
+	s = string(bytes.TrimSpace([]byte(s)))
+	if s == "=" {
+		return []byte{}, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidEncoding
+	}
+	return b, nil
+}
+
+// writeData writes <name xmlns='space'>data</name> with data already encoded.
+func writeData(w io.Writer, space, name, data string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%s xmlns='%s'>", name, space)
+	xml.EscapeText(&buf, []byte(data))
+	fmt.Fprintf(&buf, "</%s>", name)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeFailure(w io.Writer, space string, f *Failure) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<failure xmlns='%s'><%s xmlns='%s'/>", space, f.Condition, NSSASL)
+	if f.Text != "" {
+		buf.WriteString("<text>")
+		xml.EscapeText(&buf, []byte(f.Text))
+		buf.WriteString("</text>")
+	}
+	buf.WriteString("</failure>")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func failureFor(err error) *Failure {
+	var f *Failure
+	if errors.As(err, &f) {
+		return f
+	}
+	return &Failure{Condition: NotAuthorized}
+}
@@ -0,0 +1,196 @@
+package xmpp_test
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/craiggwilson/go-sasl"
+	"github.com/craiggwilson/go-sasl/internal/testhelpers"
+	"github.com/craiggwilson/go-sasl/plain"
+	"github.com/craiggwilson/go-sasl/scramsha1"
+	"github.com/craiggwilson/go-sasl/xmpp"
+)
+
+func userPassVerifier(_ context.Context, username, password string) error {
+	switch {
+	case username == "disabled":
+		return &xmpp.Failure{Condition: xmpp.AccountDisabled, Text: "account is disabled"}
+	case username != "jack" || password != "mcjack":
+		return errors.New("invalid username or password")
+	}
+	return nil
+}
+
+func storedUserProvider(_ context.Context, username string) (*scramsha1.StoredUser, error) {
+	_, storedKey, serverKey := scramsha1.GenerateKeys("mcjack", []byte("blah"), 100)
+	return &scramsha1.StoredUser{
+		Salt:       []byte("blah"),
+		Iterations: 100,
+		StoredKey:  storedKey,
+		ServerKey:  serverKey,
+	}, nil
+}
+
+func newProvider(mr *rand.Rand) xmpp.ServerMechProvider {
+	return func(mechName string) sasl.ServerMech {
+		switch mechName {
+		case plain.MechName:
+			return plain.NewServerMech(userPassVerifier, nil)
+		case scramsha1.MechName:
+			return scramsha1.NewServerMech(storedUserProvider, nil, 16, mr)
+		case "FAIL":
+			return &testhelpers.ChallengingServerMech{}
+		}
+		return nil
+	}
+}
+
+// stream connects a client and server with a pair of pipes.
+type stream struct {
+	clientDec *xml.Decoder
+	clientW   *io.PipeWriter
+	serverDec *xml.Decoder
+	serverW   *io.PipeWriter
+}
+
+func newStream() *stream {
+	c2sR, c2sW := io.Pipe()
+	s2cR, s2cW := io.Pipe()
+	return &stream{
+		clientDec: xml.NewDecoder(s2cR),
+		clientW:   c2sW,
+		serverDec: xml.NewDecoder(c2sR),
+		serverW:   s2cW,
+	}
+}
+
+func (s *stream) close() {
+	s.clientW.Close()
+	s.serverW.Close()
+}
+
+func decodeStart(dec *xml.Decoder, v interface{}) error {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return dec.DecodeElement(v, &start)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+	provider := newProvider(mr)
+
+	tests := []struct {
+		name      string
+		client    sasl.ClientMech
+		clientErr string
+		serverErr string
+	}{
+		{"plain", plain.NewClientMech("", "jack", "mcjack"), "", ""},
+		{"plain-wrong", plain.NewClientMech("", "jack", "wrong"),
+			"xmpp: authentication failed: not-authorized",
+			"xmpp: sasl mechanism PLAIN: invalid username or password"},
+		{"plain-disabled", plain.NewClientMech("", "disabled", "mcjack"),
+			"xmpp: authentication failed: account-disabled: account is disabled",
+			"xmpp: sasl mechanism PLAIN: xmpp: authentication failed: account-disabled: account is disabled"},
+		{"scram", scramsha1.NewClientMech("", "jack", "mcjack", 16, mr), "", ""},
+		{"scram-wrong", scramsha1.NewClientMech("", "jack", "wrong", 16, mr),
+			"xmpp: authentication failed: not-authorized",
+			"xmpp: sasl mechanism SCRAM-SHA-1: invalid response: client key mismatch"},
+		{"aborted", &testhelpers.FailingClientMech{},
+			"xmpp: sasl mechanism FAIL: client failed to provide response: no credentials",
+			"xmpp: authentication aborted by client"},
+		{"unsupported", plain.NewClientMech("", "jack", "mcjack"),
+			"xmpp: authentication failed: invalid-mechanism",
+			"xmpp: sasl mechanism PLAIN is not supported"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newStream()
+			defer s.close()
+
+			p := provider
+			if test.name == "unsupported" {
+				p = func(string) sasl.ServerMech { return nil }
+			}
+
+			serverErr := make(chan error, 1)
+			go func() {
+				defer s.serverW.Close()
+				var auth xmpp.Auth
+				if err := decodeStart(s.serverDec, &auth); err != nil {
+					serverErr <- err
+					return
+				}
+				_, err := xmpp.Serve(context.Background(), s.serverDec, s.serverW, &auth, p)
+				serverErr <- err
+			}()
+
+			clientErr := xmpp.Authenticate(context.Background(), s.clientDec, s.clientW, test.client)
+			testhelpers.VerifyError(t, "client", test.clientErr, clientErr)
+			testhelpers.VerifyError(t, "server", test.serverErr, <-serverErr)
+		})
+	}
+}
+
+func TestAuthenticate2(t *testing.T) {
+
+	// using math/rand to make the nonce's predicatable. Actual implementation should use crypto/rand.
+	mr := rand.New(rand.NewSource(1))
+	expiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := newStream()
+	defer s.close()
+
+	var received xmpp.Auth2
+	serverErr := make(chan error, 1)
+	go func() {
+		defer s.serverW.Close()
+		if err := decodeStart(s.serverDec, &received); err != nil {
+			serverErr <- err
+			return
+		}
+
+		_, err := xmpp.Serve2(context.Background(), s.serverDec, s.serverW, &received, newProvider(mr),
+			func(_ context.Context, mech sasl.ServerMech, req *xmpp.Auth2) (*xmpp.Result, error) {
+				result := &xmpp.Result{AuthorizationIdentifier: mech.(*scramsha1.ServerMech).Username + "@example.com/" + req.UserAgent.ID}
+				if req.RequestToken != nil {
+					result.Token = &xmpp.Token{Expiry: expiry, Token: "s3cr3t"}
+				}
+				return result, nil
+			})
+		serverErr <- err
+	}()
+
+	result, err := xmpp.Authenticate2(context.Background(), s.clientDec, s.clientW,
+		scramsha1.NewClientMech("", "jack", "mcjack", 16, mr),
+		xmpp.Auth2{
+			UserAgent:    &xmpp.UserAgent{ID: "d4565fa7", Software: "go-sasl", Device: "test"},
+			RequestToken: &xmpp.RequestToken{Mechanism: "HT-SHA-256-NONE"},
+		})
+	testhelpers.VerifyError(t, "client", "", err)
+	testhelpers.VerifyError(t, "server", "", <-serverErr)
+
+	if received.UserAgent == nil || received.UserAgent.Software != "go-sasl" || received.UserAgent.Device != "test" {
+		t.Fatalf("expected the server to receive the user agent, but got %+v", received.UserAgent)
+	}
+	if result.AuthorizationIdentifier != "jack@example.com/d4565fa7" {
+		t.Fatalf("expected authorization identifier jack@example.com/d4565fa7, but got %s", result.AuthorizationIdentifier)
+	}
+	if result.Token == nil || result.Token.Token != "s3cr3t" || !result.Token.Expiry.Equal(expiry) {
+		t.Fatalf("expected a FAST token, but got %+v", result.Token)
+	}
+}